@@ -0,0 +1,125 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+)
+
+// DefaultSmoothing is the default weight of a new clock interval in the tempo estimate.
+const DefaultSmoothing = 0.1
+
+// maxPulseInterval is the longest clock interval used for the tempo estimate (10 BPM).
+const maxPulseInterval = time.Minute / (10 * PulsesPerQuarter)
+
+// Follower estimates the tempo and the transport state from a received MIDI clock.
+//
+// The Follower is used as handler of a session:
+//
+//	f := clock.NewFollower()
+//	s.Handle(f.HandleMIDI)
+type Follower struct {
+	// Smoothing is the weight between 0 and 1 of a new clock interval in the
+	// exponential moving average of the interval.
+	Smoothing float64
+
+	mutex     sync.Mutex
+	interval  float64
+	last      time.Time
+	state     Transport
+	position  int64
+	startNext bool
+}
+
+// NewFollower creates a Follower with the default smoothing.
+func NewFollower() *Follower {
+	return &Follower{Smoothing: DefaultSmoothing}
+}
+
+// HandleMIDI follows the clock commands of the received message.
+func (f *Follower) HandleMIDI(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
+	f.HandleCommands(msg.Commands)
+}
+
+// HandleCommands follows the clock commands at the time given by their delta times.
+func (f *Follower) HandleCommands(mcs rtp.MIDICommands) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	t := mcs.Timestamp
+	for _, mc := range mcs.Commands {
+		t = t.Add(mc.DeltaTime)
+		if len(mc.Payload) == 0 {
+			continue
+		}
+		switch mc.Payload[0] {
+		case byte(midi.Clock):
+			f.pulse(t)
+		case byte(midi.Start):
+			f.position = 0
+			f.state = Playing
+			f.startNext = true
+		case byte(midi.Continue):
+			f.state = Playing
+			f.startNext = true
+		case byte(midi.Stop):
+			f.state = Stopped
+		default:
+			if msg, err := mc.Payload.Message(); err == nil {
+				if spp, ok := msg.(midi.SongPosition); ok {
+					f.position = int64(spp.Position) * pulsesPerBeat
+				}
+			}
+		}
+	}
+}
+
+func (f *Follower) pulse(t time.Time) {
+	if !f.last.IsZero() {
+		d := t.Sub(f.last)
+		if d > 0 && d <= maxPulseInterval {
+			if f.interval == 0 {
+				f.interval = float64(d)
+			} else {
+				f.interval += f.Smoothing * (float64(d) - f.interval)
+			}
+		}
+	}
+	f.last = t
+	if f.state != Playing {
+		return
+	}
+	// the first clock after start or continue marks the current position
+	if f.startNext {
+		f.startNext = false
+		return
+	}
+	f.position++
+}
+
+// BPM returns the estimated tempo in beats per minute, or 0 before two clocks were received.
+func (f *Follower) BPM() float64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.interval == 0 {
+		return 0
+	}
+	return float64(time.Minute) / (f.interval * PulsesPerQuarter)
+}
+
+// Transport returns the state of the transport.
+func (f *Follower) Transport() Transport {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.state
+}
+
+// SongPosition returns the position in MIDI beats (sixteenth notes).
+func (f *Follower) SongPosition() uint16 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return uint16(f.position / pulsesPerBeat)
+}
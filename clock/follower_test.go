@@ -0,0 +1,67 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func clocks(start time.Time, period time.Duration, n int) rtp.MIDICommands {
+	mcs := rtp.MIDICommands{Timestamp: start}
+	for i := 0; i < n; i++ {
+		d := period
+		if i == 0 {
+			d = 0
+		}
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{DeltaTime: d, Payload: rtp.MIDIPayload{0xf8}})
+	}
+	return mcs
+}
+
+func Test_follower_estimates_tempo(t *testing.T) {
+	// given
+	f := NewFollower()
+	start := time.Now()
+	// when
+	f.HandleCommands(clocks(start, 20833*time.Microsecond, 48)) // 120 BPM
+	// then
+	assert.InDelta(t, 120.0, f.BPM(), 0.01)
+	assert.Equal(t, Stopped, f.Transport())
+}
+
+func Test_follower_smooths_jitter(t *testing.T) {
+	// given
+	f := NewFollower()
+	mcs := rtp.MIDICommands{Timestamp: time.Now()}
+	// when
+	for i := 0; i < 96; i++ {
+		d := 10 * time.Millisecond
+		if i%2 == 0 {
+			d = 15 * time.Millisecond
+		}
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{DeltaTime: d, Payload: rtp.MIDIPayload{0xf8}})
+	}
+	f.HandleCommands(mcs)
+	// then 12.5ms per clock
+	assert.InDelta(t, 200.0, f.BPM(), 10)
+}
+
+func Test_follower_transport_and_song_position(t *testing.T) {
+	// given
+	f := NewFollower()
+	start := time.Now()
+	// when
+	f.HandleCommands(rtp.MIDICommands{Timestamp: start, Commands: []rtp.MIDICommand{
+		{Payload: rtp.MIDIPayload{0xf2, 0x08, 0x00}},
+		{Payload: rtp.MIDIPayload{0xfb}},
+	}})
+	f.HandleCommands(clocks(start, 10*time.Millisecond, 13))
+	playing := f.Transport()
+	f.HandleCommands(rtp.MIDICommands{Timestamp: start, Commands: []rtp.MIDICommand{{Payload: rtp.MIDIPayload{0xfc}}}})
+	// then
+	assert.Equal(t, Playing, playing)
+	assert.Equal(t, Stopped, f.Transport())
+	assert.Equal(t, uint16(10), f.SongPosition())
+}
@@ -0,0 +1,214 @@
+// Package clock generates and follows the MIDI clock used to synchronize sequencers.
+package clock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+)
+
+// PulsesPerQuarter is the resolution of the MIDI clock.
+const PulsesPerQuarter = 24
+
+// pulsesPerBeat is the number of clocks per MIDI beat (a sixteenth note) of the song position.
+const pulsesPerBeat = PulsesPerQuarter / 4
+
+// Sender sends MIDI commands, e.g. a MIDINetworkSession.
+type Sender interface {
+	SendMIDICommands(rtp.MIDICommands)
+}
+
+// Transport is the state of a sequencer controlled by the MIDI clock.
+type Transport uint8
+
+const (
+	// Stopped sequencers ignore the clock.
+	Stopped Transport = iota
+	// Playing sequencers advance with the clock.
+	Playing
+)
+
+func (t Transport) String() string {
+	if t == Playing {
+		return "playing"
+	}
+	return "stopped"
+}
+
+// Master sends the MIDI clock at a tempo in beats per minute.
+//
+// The time of each clock is derived from the time of the last tempo change, so the
+// clock does not drift because of late timers. The clock is sent until the Master is
+// closed, Start, Stop and Continue control the transport of the receivers.
+type Master struct {
+	out Sender
+
+	mutex    sync.Mutex
+	bpm      float64
+	base     time.Time
+	pulses   int64
+	position int64
+	state    Transport
+	// startNext is true until the first clock after start or continue, which marks the position
+	startNext bool
+	changed   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewMaster creates a Master and starts sending the clock. The tempo must be positive.
+func NewMaster(out Sender, bpm float64) (*Master, error) {
+	if bpm <= 0 {
+		return nil, fmt.Errorf("invalid tempo of %v bpm", bpm)
+	}
+	m := &Master{
+		out:     out,
+		bpm:     bpm,
+		base:    time.Now(),
+		changed: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go m.run()
+	return m, nil
+}
+
+// BPM returns the tempo in beats per minute.
+func (m *Master) BPM() float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.bpm
+}
+
+// SetBPM changes the tempo starting with the next clock.
+func (m *Master) SetBPM(bpm float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if bpm <= 0 || bpm == m.bpm {
+		return
+	}
+	m.base = m.next()
+	m.pulses = 0
+	m.bpm = bpm
+	m.notify()
+}
+
+// Transport returns the state of the transport.
+func (m *Master) Transport() Transport {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.state
+}
+
+// SongPosition returns the position in MIDI beats (sixteenth notes).
+func (m *Master) SongPosition() uint16 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return uint16(m.position / pulsesPerBeat)
+}
+
+// Start starts the receivers at the beginning of the song.
+func (m *Master) Start() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.position = 0
+	m.state = Playing
+	m.startNext = true
+	m.send(midi.Start)
+}
+
+// Stop stops the receivers at the current position.
+func (m *Master) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.state = Stopped
+	m.send(midi.Stop)
+}
+
+// Continue starts the receivers at the current position.
+func (m *Master) Continue() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.state = Playing
+	m.startNext = true
+	m.send(midi.Continue)
+}
+
+// SetSongPosition moves the stopped receivers to the position in MIDI beats (sixteenth notes).
+func (m *Master) SetSongPosition(beats uint16) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.position = int64(beats) * pulsesPerBeat
+	m.out.SendMIDICommands(rtp.MIDICommands{
+		Timestamp: time.Now(),
+		Commands:  []rtp.MIDICommand{{Payload: midi.Encode(midi.SongPosition{Position: beats})}},
+	})
+}
+
+// Close stops sending the clock.
+func (m *Master) Close() {
+	m.closeOnce.Do(func() { close(m.closed) })
+	<-m.done
+}
+
+func (m *Master) send(r midi.Realtime) {
+	m.out.SendMIDICommands(rtp.MIDICommands{
+		Timestamp: time.Now(),
+		Commands:  []rtp.MIDICommand{{Payload: rtp.MIDIPayload{byte(r)}}},
+	})
+}
+
+func (m *Master) notify() {
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the time of the next clock.
+func (m *Master) next() time.Time {
+	period := time.Duration(float64(time.Minute) / (m.bpm * PulsesPerQuarter))
+	return m.base.Add(time.Duration(m.pulses) * period)
+}
+
+func (m *Master) run() {
+	defer close(m.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	for {
+		m.mutex.Lock()
+		due := m.next()
+		m.mutex.Unlock()
+
+		timer.Reset(time.Until(due))
+		select {
+		case <-m.closed:
+			return
+		case <-m.changed:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			continue
+		case <-timer.C:
+		}
+
+		m.mutex.Lock()
+		if m.next().Equal(due) {
+			m.pulses++
+			if m.state == Playing && !m.startNext {
+				m.position++
+			}
+			m.startNext = false
+			m.out.SendMIDICommands(rtp.MIDICommands{
+				Timestamp: due,
+				Commands:  []rtp.MIDICommand{{Payload: rtp.MIDIPayload{byte(midi.Clock)}}},
+			})
+		}
+		m.mutex.Unlock()
+	}
+}
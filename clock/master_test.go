@@ -0,0 +1,112 @@
+package clock
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSender struct {
+	mutex sync.Mutex
+	lists []rtp.MIDICommands
+}
+
+func (r *recordingSender) SendMIDICommands(mcs rtp.MIDICommands) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lists = append(r.lists, mcs)
+}
+
+func (r *recordingSender) sent() []rtp.MIDICommands {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]rtp.MIDICommands(nil), r.lists...)
+}
+
+func clockTimes(lists []rtp.MIDICommands) []time.Time {
+	times := []time.Time{}
+	for _, mcs := range lists {
+		if mcs.Commands[0].Payload[0] == 0xf8 {
+			times = append(times, mcs.Timestamp)
+		}
+	}
+	return times
+}
+
+func Test_master_sends_clock_without_drift(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	// when
+	m, err := NewMaster(out, 625) // 4ms per clock
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	m.Close()
+	// then
+	times := clockTimes(out.sent())
+	assert.True(t, len(times) > 10)
+	for i := 1; i < len(times); i++ {
+		assert.Equal(t, time.Duration(i)*4*time.Millisecond, times[i].Sub(times[0]))
+	}
+}
+
+func Test_master_transport_and_song_position(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	m, err := NewMaster(out, 625)
+	assert.NoError(t, err)
+	defer m.Close()
+	// when
+	m.SetSongPosition(4)
+	m.Continue()
+	time.Sleep(50 * time.Millisecond)
+	m.Stop()
+	position := m.SongPosition()
+	// then
+	assert.Equal(t, Stopped, m.Transport())
+	assert.True(t, position > 4)
+	lists := out.sent()
+	payloads := []rtp.MIDIPayload{}
+	for _, mcs := range lists {
+		if p := mcs.Commands[0].Payload; p[0] != 0xf8 {
+			payloads = append(payloads, p)
+		}
+	}
+	assert.Equal(t, []rtp.MIDIPayload{{0xf2, 0x04, 0x00}, {0xfb}, {0xfc}}, payloads)
+}
+
+func Test_master_changes_tempo_at_next_clock(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	m, err := NewMaster(out, 625)
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	// when
+	m.SetBPM(1250) // 2ms per clock
+	time.Sleep(20 * time.Millisecond)
+	m.Close()
+	// then
+	times := clockTimes(out.sent())
+	last := len(times) - 1
+	assert.Equal(t, 2*time.Millisecond, times[last].Sub(times[last-1]))
+	assert.Equal(t, 1250.0, m.BPM())
+}
+
+func Test_master_rejects_invalid_tempo(t *testing.T) {
+	for _, bpm := range []float64{0, -120} {
+		_, err := NewMaster(&recordingSender{}, bpm)
+		assert.Error(t, err, "%v", bpm)
+	}
+}
+
+func Test_master_close_twice(t *testing.T) {
+	// given
+	m, err := NewMaster(&recordingSender{}, 120)
+	assert.NoError(t, err)
+	// when
+	m.Close()
+	// then
+	assert.NotPanics(t, m.Close)
+}
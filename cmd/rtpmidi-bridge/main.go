@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// reconnectInterval is the time between invitations to a disconnected peer
+	reconnectInterval = 5 * time.Second
+	// streamTimeout ends streams of remote participants which stopped sending, it exceeds
+	// the clock synchronization interval of common implementations
+	streamTimeout = time.Minute
+)
+
+// Config is the JSON or YAML configuration of the bridge, e.g.
+//
+//	{
+//	  "sessions": [
+//	    {"name": "bridge-stage", "port": 5004, "advertise": true},
+//	    {"name": "bridge-foh", "port": 5006, "peers": ["10.0.2.15:5004"]}
+//	  ]
+//	}
+//
+// or
+//
+//	sessions:
+//	  - name: bridge-stage
+//	    port: 5004
+//	    advertise: true
+//	  - name: bridge-foh
+//	    port: 5006
+//	    peers: ["10.0.2.15:5004"]
+type Config struct {
+	Sessions []SessionConfig `json:"sessions" yaml:"sessions"`
+}
+
+// SessionConfig configures one side of the bridge.
+type SessionConfig struct {
+	// Name is the Bonjour name of the session.
+	Name string `json:"name" yaml:"name"`
+	// Port is the control port of the session (the data port is port+1).
+	Port uint16 `json:"port" yaml:"port"`
+	// Advertise registers the session with Bonjour.
+	Advertise bool `json:"advertise" yaml:"advertise"`
+	// Peers are the control addresses (host:port) of remote sessions which are invited.
+	Peers []string `json:"peers" yaml:"peers"`
+}
+
+func main() {
+	configFile := flag.String("config", "bridge.json", "JSON or YAML (.yaml, .yml) configuration of the bridged sessions")
+	flag.Parse()
+
+	config, err := readConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(config.Sessions) < 2 {
+		log.Fatalf("%s configures %d sessions, at least 2 are needed", *configFile, len(config.Sessions))
+	}
+
+	b, err := open(config.Sessions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, c := range config.Sessions {
+		if c.Advertise {
+			server, err := zeroconf.Register(c.Name, "_apple-midi._udp", "local.", int(c.Port), []string{"txtv=0", "lo=1", "la=2"}, nil)
+			if err != nil {
+				panic(err)
+			}
+			defer server.Shutdown()
+		}
+		for _, peer := range c.Peers {
+			go connect(b.sessions[i], peer)
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	log.Println("Shutting down.")
+	b.close()
+}
+
+func readConfig(name string) (Config, error) {
+	config := Config{}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return config, err
+	}
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &config)
+	default:
+		err = json.Unmarshal(b, &config)
+	}
+	return config, err
+}
+
+// bridge relays the commands between its sessions.
+//
+// The SSRCs of the sessions share the id of the bridge in their upper 24 bits, the lower
+// 8 bits are the index of the session. This allows other bridges to recognize the sessions
+// of the bridge on each side.
+type bridge struct {
+	id       uint32
+	sessions []*session.MIDINetworkSession
+}
+
+// open starts the sessions of the bridge.
+func open(configs []SessionConfig) (*bridge, error) {
+	b := &bridge{id: rand.Uint32() >> 8}
+	for i, c := range configs {
+		s, err := session.Open(c.Name, c.Port, session.WithStreamTimeout(streamTimeout), session.WithSSRC(b.id<<8|uint32(i)))
+		if err != nil {
+			b.close()
+			return nil, err
+		}
+		b.sessions = append(b.sessions, s)
+	}
+	for _, s := range b.sessions {
+		s.Handle(b.relay)
+	}
+	return b, nil
+}
+
+// close ends the streams and closes the ports of the sessions.
+func (b *bridge) close() {
+	for _, s := range b.sessions {
+		s.Close()
+	}
+}
+
+// relay forwards the received commands to the other sessions.
+//
+// The SSRCs of the streams of each session are the participants seen on its side. Commands
+// received from the bridge itself are dropped, as well as commands re-entering the bridge:
+// commands of a participant, or of another bridge, which is seen on another side too. That
+// side receives them directly, relaying them would make two bridges between the same sides
+// pass them back and forth.
+func (b *bridge) relay(msg rtp.MIDIMessage, from *session.MIDINetworkSession) {
+	if bridgeID(msg.SSRC) == b.id || len(msg.Commands.Commands) == 0 {
+		return
+	}
+	for _, s := range b.sessions {
+		if s != from && seen(s, msg.SSRC) {
+			return
+		}
+	}
+	for _, s := range b.sessions {
+		if s != from {
+			s.SendMIDICommands(msg.Commands)
+		}
+	}
+}
+
+// seen returns true if the session has a stream to the sender of the SSRC, or to another
+// session of the same bridge.
+func seen(s *session.MIDINetworkSession, ssrc uint32) bool {
+	for _, conn := range s.Streams() {
+		if bridgeID(conn.RemoteSSRC) == bridgeID(ssrc) {
+			return true
+		}
+	}
+	return false
+}
+
+// bridgeID returns the id of the bridge of a session SSRC.
+func bridgeID(ssrc uint32) uint32 {
+	return ssrc >> 8
+}
+
+// connect invites the peer and invites it again when the stream ended.
+func connect(s *session.MIDINetworkSession, peer string) {
+	for {
+		addr, err := net.ResolveUDPAddr("udp", peer)
+		if err != nil {
+			log.Printf("Invalid peer %s: %v", peer, err)
+			return
+		}
+		conn, err := s.Invite(addr)
+		if err != nil {
+			log.Printf("Connecting %s to %s failed: %v", s.BonjourName, peer, err)
+			time.Sleep(reconnectInterval)
+			continue
+		}
+		for {
+			time.Sleep(reconnectInterval)
+			if current, found := s.Stream(conn.RemoteSSRC); !found || current != conn {
+				break
+			}
+		}
+		log.Printf("Connection of %s to %s ended", s.BonjourName, peer)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_read_yaml_config(t *testing.T) {
+	// given
+	name := filepath.Join(t.TempDir(), "bridge.yaml")
+	assert.NoError(t, os.WriteFile(name, []byte(`
+sessions:
+  - name: bridge-stage
+    port: 5004
+    advertise: true
+  - name: bridge-foh
+    port: 5006
+    peers: ["10.0.2.15:5004"]
+`), 0o600))
+	// when
+	config, err := readConfig(name)
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, Config{Sessions: []SessionConfig{
+		{Name: "bridge-stage", Port: 5004, Advertise: true},
+		{Name: "bridge-foh", Port: 5006, Peers: []string{"10.0.2.15:5004"}},
+	}}, config)
+}
+
+func Test_relay_between_sides(t *testing.T) {
+	// given
+	b, err := open([]SessionConfig{{Name: "bridge-stage", Port: 15400}, {Name: "bridge-foh", Port: 15402}})
+	assert.NoError(t, err)
+	defer b.close()
+	stage := openSession(t, "stage", 15404)
+	foh := openSession(t, "foh", 15406)
+	received := make(chan uint32, 16)
+	foh.Handle(func(msg rtp.MIDIMessage, _ *session.MIDINetworkSession) {
+		received <- msg.SSRC
+	})
+	invite(t, stage, 15400)
+	invite(t, foh, 15402)
+	// when
+	stage.SendMIDIPayload(rtp.MIDIPayload{0x90, 0x3c, 0x40})
+	// then
+	select {
+	case ssrc := <-received:
+		assert.Equal(t, b.sessions[1].SSRC, ssrc)
+	case <-time.After(time.Second):
+		t.Fatal("payload not relayed")
+	}
+}
+
+func Test_no_relay_between_bridges_of_the_same_sides(t *testing.T) {
+	// given
+	b1, err := open([]SessionConfig{{Name: "bridge1-stage", Port: 15410}, {Name: "bridge1-foh", Port: 15412}})
+	assert.NoError(t, err)
+	defer b1.close()
+	b2, err := open([]SessionConfig{{Name: "bridge2-stage", Port: 15414}, {Name: "bridge2-foh", Port: 15416}})
+	assert.NoError(t, err)
+	defer b2.close()
+	stage := openSession(t, "stage", 15418)
+	foh := openSession(t, "foh", 15420)
+	received := make(chan uint32, 16)
+	foh.Handle(func(msg rtp.MIDIMessage, _ *session.MIDINetworkSession) {
+		received <- msg.SSRC
+	})
+	// both bridges are connected to each other and to the participants on each side
+	invite(t, stage, 15410)
+	invite(t, stage, 15414)
+	invite(t, b1.sessions[0], 15414)
+	invite(t, foh, 15412)
+	invite(t, foh, 15416)
+	invite(t, b1.sessions[1], 15416)
+	// when
+	stage.SendMIDIPayload(rtp.MIDIPayload{0x90, 0x3c, 0x40})
+	// then
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 2, len(received))
+	assert.ElementsMatch(t, []uint32{b1.sessions[1].SSRC, b2.sessions[1].SSRC}, []uint32{<-received, <-received})
+}
+
+func openSession(t *testing.T, name string, port uint16) *session.MIDINetworkSession {
+	s, err := session.Open(name, port)
+	assert.NoError(t, err)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func invite(t *testing.T, s *session.MIDINetworkSession, port int) {
+	_, err := s.Invite(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	assert.NoError(t, err)
+}
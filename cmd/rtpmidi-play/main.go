@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+	"github.com/laenzlinger/go-midi-rtp/player"
+	"github.com/laenzlinger/go-midi-rtp/session"
+	"github.com/laenzlinger/go-midi-rtp/smf"
+)
+
+func main() {
+	port := flag.Int("port", 5004, "control port of the session (the data port is port+1)")
+	bonjourName := flag.String("name", "rtpmidi-player", "name of the session advertised with Bonjour")
+	file := flag.String("file", "", "Standard MIDI File to play")
+	loop := flag.Bool("loop", false, "restart the playback at the end of the file")
+	clock := flag.Bool("clock", false, "send MIDI clock and song position")
+	to := flag.String("to", "", "comma separated Bonjour names of the participants to play to (default all)")
+	flag.Parse()
+
+	in, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := smf.Read(in)
+	in.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, err := zeroconf.Register(*bonjourName, "_apple-midi._udp", "local.", *port, []string{"txtv=0", "lo=1", "la=2"}, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer server.Shutdown()
+
+	s := session.Start(*bonjourName, uint16(*port))
+	var out player.Sender = s
+	if *to != "" {
+		out = s.Select(strings.Split(*to, ",")...)
+	}
+
+	log.Println("Waiting for a participant to connect.")
+	for len(s.Streams()) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	p := player.New(f, out)
+	p.SetLoop(*loop)
+	p.SetClock(*clock)
+	log.Printf("Playing %s (%v)", *file, p.Length())
+	p.Start()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sig:
+	case <-p.Done():
+	}
+
+	log.Println("Shutting down.")
+	p.Stop()
+	s.End()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+	"github.com/laenzlinger/go-midi-rtp/recorder"
+	"github.com/laenzlinger/go-midi-rtp/session"
+)
+
+func main() {
+	port := flag.Int("port", 5004, "control port of the session (the data port is port+1)")
+	bonjourName := flag.String("name", "rtpmidi-recorder", "name of the session advertised with Bonjour")
+	out := flag.String("out", "recording.mid", "Standard MIDI File to write")
+	flag.Parse()
+
+	server, err := zeroconf.Register(*bonjourName, "_apple-midi._udp", "local.", *port, []string{"txtv=0", "lo=1", "la=2"}, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer server.Shutdown()
+
+	rec := recorder.New(time.Now())
+	s := session.Start(*bonjourName, uint16(*port))
+	s.Handle(rec.HandleMIDI)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	log.Println("Shutting down.")
+	s.End()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := rec.Finish(f); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Recording written to %s", *out)
+}
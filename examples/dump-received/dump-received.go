@@ -25,7 +25,12 @@ func main() {
 	s := session.Start(bonjourName, uint16(port))
 	s.Handle(func(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
 		for _, cmd := range msg.Commands.Commands {
-			fmt.Printf("Received MIDI command:\n%s", hex.Dump(cmd.Payload))
+			m, err := cmd.Payload.Message()
+			if err != nil {
+				fmt.Printf("Received MIDI command:\n%s", hex.Dump(cmd.Payload))
+				continue
+			}
+			fmt.Printf("Received MIDI command: %v\n", m)
 		}
 	})
 
@@ -4,6 +4,7 @@ require (
 	github.com/go-test/deep v1.0.1
 	github.com/grandcat/zeroconf v1.0.1-0.20220623170244-e1d6e579e89f
 	github.com/stretchr/testify v1.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
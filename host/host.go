@@ -0,0 +1,162 @@
+// Package host manages several named sessions of one host, e.g. one network MIDI port per
+// virtual instrument.
+package host
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/grandcat/zeroconf"
+	"github.com/laenzlinger/go-midi-rtp/session"
+)
+
+// DefaultFirstPort is the first control port allocated by default.
+const DefaultFirstPort = 5004
+
+// maxPortAttempts is the number of port pairs tried when opening a session
+const maxPortAttempts = 100
+
+// Host opens and closes named sessions with allocated port pairs.
+//
+// Each session uses a control port and the following data port. Ports are allocated in
+// pairs from FirstPort on, skipping ports in use.
+type Host struct {
+	// FirstPort is the first allocated control port.
+	FirstPort uint16
+	// Advertise registers the opened sessions with Bonjour.
+	Advertise bool
+
+	mutex    sync.Mutex
+	sessions map[string]*entry
+}
+
+type entry struct {
+	session *session.MIDINetworkSession
+	server  *zeroconf.Server
+}
+
+// New creates a Host allocating ports from DefaultFirstPort on.
+func New() *Host {
+	return &Host{FirstPort: DefaultFirstPort, sessions: map[string]*entry{}}
+}
+
+// Open starts a new session with the Bonjour name on the next free port pair.
+func (h *Host) Open(name string, options ...session.Option) (*session.MIDINetworkSession, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.sessions == nil {
+		h.sessions = map[string]*entry{}
+	}
+	if _, found := h.sessions[name]; found {
+		return nil, fmt.Errorf("session %s is already open", name)
+	}
+	for attempt, port := 0, h.FirstPort; attempt < maxPortAttempts && port < 0xffff; attempt, port = attempt+1, port+2 {
+		if h.allocated(port) {
+			continue
+		}
+		s, err := session.Open(name, port, options...)
+		if errors.Is(err, syscall.EADDRINUSE) {
+			// the port pair is in use by another process
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := &entry{session: s}
+		if h.Advertise {
+			e.server, err = zeroconf.Register(name, "_apple-midi._udp", "local.", int(port), []string{"txtv=0", "lo=1", "la=2"}, nil)
+			if err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+		h.sessions[name] = e
+		log.Printf("Session %s opened on port %d", name, port)
+		return s, nil
+	}
+	return nil, fmt.Errorf("no free port pair for session %s from port %d", name, h.FirstPort)
+}
+
+// Close closes the session with the name.
+func (h *Host) Close(name string) error {
+	h.mutex.Lock()
+	e, found := h.sessions[name]
+	delete(h.sessions, name)
+	h.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("session %s is not open", name)
+	}
+	e.close()
+	return nil
+}
+
+// CloseAll closes all sessions.
+func (h *Host) CloseAll() {
+	h.mutex.Lock()
+	sessions := h.sessions
+	h.sessions = map[string]*entry{}
+	h.mutex.Unlock()
+	for _, e := range sessions {
+		e.close()
+	}
+}
+
+// Session returns the session with the name.
+func (h *Host) Session(name string) (*session.MIDINetworkSession, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	e, found := h.sessions[name]
+	if !found {
+		return nil, false
+	}
+	return e.session, true
+}
+
+// Sessions returns the open sessions ordered by name.
+func (h *Host) Sessions() []*session.MIDINetworkSession {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	sessions := make([]*session.MIDINetworkSession, 0, len(h.sessions))
+	for _, e := range h.sessions {
+		sessions = append(sessions, e.session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].BonjourName < sessions[j].BonjourName
+	})
+	return sessions
+}
+
+// Streams returns the streams of all open sessions by session name.
+func (h *Host) Streams() map[string][]*session.MIDINetworkStream {
+	streams := map[string][]*session.MIDINetworkStream{}
+	for _, s := range h.Sessions() {
+		streams[s.BonjourName] = s.Streams()
+	}
+	return streams
+}
+
+// allocated returns true if the control or data port of an open session is in the port
+// pair starting at port.
+func (h *Host) allocated(port uint16) bool {
+	for _, e := range h.sessions {
+		for _, p := range []uint16{e.session.Port, e.session.DataPort} {
+			if p == port || p == port+1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *entry) close() {
+	if e.server != nil {
+		e.server.Shutdown()
+	}
+	e.session.Close()
+	log.Printf("Session %s closed", e.session.BonjourName)
+}
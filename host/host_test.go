@@ -0,0 +1,80 @@
+package host
+
+import (
+	"net"
+	"testing"
+
+	"github.com/laenzlinger/go-midi-rtp/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_open_sessions_on_allocated_ports(t *testing.T) {
+	// given
+	h := New()
+	h.FirstPort = 15300
+	defer h.CloseAll()
+	// when
+	piano, err1 := h.Open("piano")
+	organ, err2 := h.Open("organ")
+	_, err3 := h.Open("piano")
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Error(t, err3)
+	assert.Equal(t, uint16(15300), piano.Port)
+	assert.Equal(t, uint16(15302), organ.Port)
+	names := []string{}
+	for _, s := range h.Sessions() {
+		names = append(names, s.BonjourName)
+	}
+	assert.Equal(t, []string{"organ", "piano"}, names)
+}
+
+func Test_skip_ports_in_use(t *testing.T) {
+	// given
+	pc, err := net.ListenPacket("udp", ":15311")
+	assert.NoError(t, err)
+	defer pc.Close()
+	h := New()
+	h.FirstPort = 15310
+	defer h.CloseAll()
+	// when
+	s, err := h.Open("strings")
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(15312), s.Port)
+}
+
+func Test_close_releases_ports(t *testing.T) {
+	// given
+	h := New()
+	h.FirstPort = 15320
+	defer h.CloseAll()
+	h.Open("bass")
+	// when
+	err := h.Close("bass")
+	s, reopenErr := h.Open("drums")
+	// then
+	assert.NoError(t, err)
+	assert.Error(t, h.Close("bass"))
+	assert.NoError(t, reopenErr)
+	assert.Equal(t, uint16(15320), s.Port)
+	_, found := h.Session("bass")
+	assert.False(t, found)
+}
+
+func Test_skip_data_ports_of_open_sessions(t *testing.T) {
+	// given
+	h := New()
+	h.FirstPort = 15330
+	defer h.CloseAll()
+	brass, err := h.Open("brass", session.WithDataPort(15333))
+	assert.NoError(t, err)
+	// when
+	s, err := h.Open("winds")
+	// then
+	assert.NoError(t, err)
+	assert.True(t, h.allocated(15332))
+	assert.Equal(t, uint16(15333), brass.DataPort)
+	assert.Equal(t, uint16(15334), s.Port)
+}
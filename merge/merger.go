@@ -0,0 +1,330 @@
+// Package merge combines the MIDI commands received from several remote participants into
+// one time ordered output.
+package merge
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+)
+
+// Sender sends MIDI commands, e.g. a MIDINetworkSession or a Selection of its streams.
+type Sender interface {
+	SendMIDICommands(rtp.MIDICommands)
+}
+
+// DefaultLatency is the default time the commands are delayed to order them by time.
+const DefaultLatency = 5 * time.Millisecond
+
+// controllers which end all notes of a channel
+const (
+	allSoundOff = 120
+	allNotesOff = 123
+	omniOff     = 124
+	polyOn      = 127
+)
+
+// Merger merges the commands of several sources into one output.
+//
+// The commands are ordered by the time they were sent, which is given by the RTP timestamp
+// of synchronized streams, and delayed by the latency to wait for commands of other sources.
+// Each output command is a complete message: SysEx segments are reassembled and running
+// status is resolved per source.
+//
+// Notes played on the same key and channel by several sources are only stopped when the
+// last source releases its note, all notes off of one source only stop the notes of that
+// source.
+//
+// The Merger is used as handler of a session:
+//
+//	m := merge.New(s.Select("sound-module"), merge.DefaultLatency)
+//	s.Handle(m.HandleMIDI)
+type Merger struct {
+	out     Sender
+	latency time.Duration
+
+	mutex   sync.Mutex
+	queue   eventQueue
+	serial  uint64
+	sources map[uint32]*source
+	// playing counts the sources playing a key per channel
+	playing  [16][128]int
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type source struct {
+	sysEx  rtp.SysExReassembler
+	status byte
+	notes  [16][128]bool
+}
+
+type event struct {
+	at      time.Time
+	serial  uint64
+	source  uint32
+	payload rtp.MIDIPayload
+}
+
+// New creates a Merger sending the merged commands to out.
+func New(out Sender, latency time.Duration) *Merger {
+	m := &Merger{
+		out:     out,
+		latency: latency,
+		sources: map[uint32]*source{},
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	go m.loop()
+	return m
+}
+
+// HandleMIDI merges the commands of the message received from the stream of a remote participant.
+func (m *Merger) HandleMIDI(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
+	m.HandleCommands(msg.SSRC, msg.Commands)
+}
+
+// HandleCommands merges the commands of the source, e.g. the SSRC of a stream.
+// The time of the commands is given by their Timestamp and delta times.
+func (m *Merger) HandleCommands(id uint32, mcs rtp.MIDICommands) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	src := m.source(id)
+	at := mcs.Timestamp
+	now := time.Now()
+	for _, mc := range mcs.Commands {
+		at = at.Add(mc.DeltaTime)
+		mc.Payload = src.resolveRunningStatus(mc.Payload)
+		if len(mc.Payload) == 0 {
+			continue
+		}
+		mc, complete := src.sysEx.Reassemble(mc, now)
+		if !complete {
+			continue
+		}
+		m.serial++
+		heap.Push(&m.queue, &event{
+			at:      at,
+			serial:  m.serial,
+			source:  id,
+			payload: append(rtp.MIDIPayload(nil), mc.Payload...),
+		})
+	}
+	m.notify()
+}
+
+// Remove forgets the source and sends note offs for its notes which are not played by
+// another source, e.g. after its stream ended.
+func (m *Merger) Remove(id uint32) {
+	m.mutex.Lock()
+	src, found := m.sources[id]
+	if !found {
+		m.mutex.Unlock()
+		return
+	}
+	delete(m.sources, id)
+	mcs := rtp.MIDICommands{Timestamp: time.Now()}
+	for ch := range src.notes {
+		for _, off := range m.release(src, uint8(ch)) {
+			mcs.Commands = append(mcs.Commands, rtp.MIDICommand{Payload: off})
+		}
+	}
+	m.mutex.Unlock()
+	if len(mcs.Commands) > 0 {
+		m.out.SendMIDICommands(mcs)
+	}
+}
+
+// Stop stops the merger. Pending commands are discarded.
+// Stopping a stopped merger has no effect.
+func (m *Merger) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+}
+
+func (m *Merger) source(id uint32) *source {
+	src, found := m.sources[id]
+	if !found {
+		src = &source{}
+		m.sources[id] = src
+	}
+	return src
+}
+
+func (m *Merger) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Merger) loop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		mcs, wait := m.due(time.Now())
+		if len(mcs.Commands) > 0 {
+			m.out.SendMIDICommands(mcs)
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-m.stop:
+			return
+		case <-m.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// due removes the commands which are due at now, or returns the time to wait for the next command.
+func (m *Merger) due(now time.Time) (rtp.MIDICommands, time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	mcs := rtp.MIDICommands{}
+	for len(m.queue) > 0 {
+		next := m.queue[0]
+		if wait := next.at.Add(m.latency).Sub(now); wait > 0 {
+			if len(mcs.Commands) == 0 {
+				return mcs, wait
+			}
+			break
+		}
+		heap.Pop(&m.queue)
+		if len(mcs.Commands) == 0 {
+			mcs.Timestamp = next.at.Add(m.latency)
+		}
+		last := mcs.Timestamp
+		for _, mc := range mcs.Commands {
+			last = last.Add(mc.DeltaTime)
+		}
+		delta := next.at.Add(m.latency).Sub(last)
+		if delta < 0 {
+			// commands arriving later than the latency are sent as soon as possible
+			delta = 0
+		}
+		for _, payload := range m.filter(next) {
+			mcs.Commands = append(mcs.Commands, rtp.MIDICommand{DeltaTime: delta, Payload: payload})
+			delta = 0
+		}
+	}
+	if len(mcs.Commands) == 0 {
+		return mcs, time.Hour
+	}
+	return mcs, 0
+}
+
+// filter returns the payloads to send for the event, considering the notes of the other sources.
+func (m *Merger) filter(e *event) []rtp.MIDIPayload {
+	src, found := m.sources[e.source]
+	if !found {
+		return []rtp.MIDIPayload{e.payload}
+	}
+	msg, err := e.payload.Message()
+	if err != nil {
+		return []rtp.MIDIPayload{e.payload}
+	}
+	switch msg := msg.(type) {
+	case midi.NoteOn:
+		if msg.IsNoteOff() {
+			return m.noteOff(src, msg.Channel, msg.Key, e.payload)
+		}
+		if !src.notes[msg.Channel][msg.Key] {
+			src.notes[msg.Channel][msg.Key] = true
+			m.playing[msg.Channel][msg.Key]++
+		}
+	case midi.NoteOff:
+		return m.noteOff(src, msg.Channel, msg.Key, e.payload)
+	case midi.ControlChange:
+		if msg.Controller == allSoundOff || msg.Controller == allNotesOff ||
+			(msg.Controller >= omniOff && msg.Controller <= polyOn) {
+			return m.release(src, msg.Channel)
+		}
+	}
+	return []rtp.MIDIPayload{e.payload}
+}
+
+// noteOff returns the payload if the source is the last one playing the key.
+func (m *Merger) noteOff(src *source, channel, key uint8, payload rtp.MIDIPayload) []rtp.MIDIPayload {
+	if !src.notes[channel][key] {
+		return nil
+	}
+	src.notes[channel][key] = false
+	m.playing[channel][key]--
+	if m.playing[channel][key] > 0 {
+		return nil
+	}
+	return []rtp.MIDIPayload{payload}
+}
+
+// release returns the note offs of the notes played by the source on the channel which
+// are not played by another source.
+func (m *Merger) release(src *source, channel uint8) []rtp.MIDIPayload {
+	offs := []rtp.MIDIPayload{}
+	for key, playing := range src.notes[channel] {
+		if !playing {
+			continue
+		}
+		off := midi.Encode(midi.NoteOff{Channel: channel, Key: uint8(key)})
+		offs = append(offs, m.noteOff(src, channel, uint8(key), off)...)
+	}
+	return offs
+}
+
+// resolveRunningStatus prepends the running status to payloads starting with a data octet.
+func (src *source) resolveRunningStatus(p rtp.MIDIPayload) rtp.MIDIPayload {
+	if len(p) == 0 {
+		return p
+	}
+	switch {
+	case midi.IsRealtime(p[0]):
+	case p[0] >= 0xf0:
+		src.status = 0
+	case p[0] >= 0x80:
+		src.status = p[0]
+	case src.status != 0:
+		return append(rtp.MIDIPayload{src.status}, p...)
+	default:
+		// data octets without status are dropped
+		return nil
+	}
+	return p
+}
+
+// eventQueue is a heap of events ordered by time.
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].serial < q[j].serial
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,127 @@
+package merge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+type channelSender chan rtp.MIDICommands
+
+func (c channelSender) SendMIDICommands(mcs rtp.MIDICommands) {
+	c <- mcs
+}
+
+// newTestMerger creates a Merger without the loop, its commands are taken with due.
+func newTestMerger(latency time.Duration) *Merger {
+	return &Merger{latency: latency, sources: map[uint32]*source{}, wake: make(chan struct{}, 1)}
+}
+
+func commands(at time.Time, payloads ...rtp.MIDIPayload) rtp.MIDICommands {
+	mcs := rtp.MIDICommands{Timestamp: at}
+	for _, p := range payloads {
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{Payload: p})
+	}
+	return mcs
+}
+
+func payloads(mcs rtp.MIDICommands) []rtp.MIDIPayload {
+	result := []rtp.MIDIPayload{}
+	for _, mc := range mcs.Commands {
+		result = append(result, mc.Payload)
+	}
+	return result
+}
+
+func Test_merge_orders_by_time(t *testing.T) {
+	// given
+	m := newTestMerger(10 * time.Millisecond)
+	start := time.Now()
+	m.HandleCommands(1, commands(start.Add(2*time.Millisecond), rtp.MIDIPayload{0x90, 60, 100}))
+	m.HandleCommands(2, commands(start, rtp.MIDIPayload{0x90, 64, 100}))
+	// when
+	early, wait := m.due(start.Add(5 * time.Millisecond))
+	mcs, _ := m.due(start.Add(20 * time.Millisecond))
+	// then
+	assert.Empty(t, early.Commands)
+	assert.Equal(t, 5*time.Millisecond, wait)
+	assert.Equal(t, []rtp.MIDIPayload{{0x90, 64, 100}, {0x90, 60, 100}}, payloads(mcs))
+	assert.Equal(t, start.Add(10*time.Millisecond), mcs.Timestamp)
+	assert.Equal(t, 2*time.Millisecond, mcs.Commands[1].DeltaTime)
+}
+
+func Test_overlapping_notes_of_sources(t *testing.T) {
+	// given
+	m := newTestMerger(0)
+	now := time.Now()
+	m.HandleCommands(1, commands(now, rtp.MIDIPayload{0x90, 60, 100}))
+	m.HandleCommands(2, commands(now, rtp.MIDIPayload{0x90, 60, 90}))
+	// when
+	m.HandleCommands(1, commands(now, rtp.MIDIPayload{0x80, 60, 0}))
+	first, _ := m.due(now)
+	m.HandleCommands(2, commands(now, rtp.MIDIPayload{0x90, 60, 0}))
+	second, _ := m.due(now)
+	// then
+	assert.Equal(t, []rtp.MIDIPayload{{0x90, 60, 100}, {0x90, 60, 90}}, payloads(first))
+	assert.Equal(t, []rtp.MIDIPayload{{0x90, 60, 0}}, payloads(second))
+}
+
+func Test_all_notes_off_of_one_source(t *testing.T) {
+	// given
+	m := newTestMerger(0)
+	now := time.Now()
+	m.HandleCommands(1, commands(now, rtp.MIDIPayload{0x90, 60, 100}, rtp.MIDIPayload{0x90, 62, 100}))
+	m.HandleCommands(2, commands(now, rtp.MIDIPayload{0x90, 62, 100}))
+	// when
+	m.HandleCommands(1, commands(now, rtp.MIDIPayload{0xb0, 123, 0}))
+	mcs, _ := m.due(now)
+	// then
+	assert.Equal(t, []rtp.MIDIPayload{{0x90, 60, 100}, {0x90, 62, 100}, {0x90, 62, 100}, {0x80, 60, 0}}, payloads(mcs))
+}
+
+func Test_running_status_and_sysex_of_sources(t *testing.T) {
+	// given
+	m := newTestMerger(0)
+	now := time.Now()
+	// when
+	m.HandleCommands(1, commands(now, rtp.MIDIPayload{0x91, 60, 100}, rtp.MIDIPayload{0xf0, 0x7e, 0xf0}))
+	m.HandleCommands(2, commands(now, rtp.MIDIPayload{0xb2, 1, 10}))
+	m.HandleCommands(1, commands(now, rtp.MIDIPayload{0xf7, 0x01, 0xf7}, rtp.MIDIPayload{62, 100}))
+	m.HandleCommands(2, commands(now, rtp.MIDIPayload{1, 11}))
+	mcs, _ := m.due(now)
+	// then
+	assert.Equal(t, []rtp.MIDIPayload{
+		{0x91, 60, 100},
+		{0xb2, 1, 10},
+		{0xf0, 0x7e, 0x01, 0xf7},
+		{0xb2, 1, 11},
+	}, payloads(mcs))
+}
+
+func Test_merger_sends_commands(t *testing.T) {
+	// given
+	out := make(channelSender, 1)
+	m := New(out, time.Millisecond)
+	defer m.Stop()
+	// when
+	m.HandleMIDI(rtp.MIDIMessage{SSRC: 1, Commands: commands(time.Now(), rtp.MIDIPayload{0xf8})}, nil)
+	// then
+	select {
+	case mcs := <-out:
+		assert.Equal(t, []rtp.MIDIPayload{{0xf8}}, payloads(mcs))
+	case <-time.After(time.Second):
+		t.Fatal("commands not sent")
+	}
+}
+
+func Test_merger_stop_twice(t *testing.T) {
+	// given
+	m := New(make(channelSender, 1), time.Millisecond)
+	m.Stop()
+	// when
+	stop := func() { m.Stop() }
+	// then
+	assert.NotPanics(t, stop)
+}
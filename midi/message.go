@@ -0,0 +1,382 @@
+package midi
+
+import (
+	"fmt"
+)
+
+// Message is a typed MIDI 1.0 message.
+type Message interface {
+	// Append appends the MIDI 1.0 bytes of the message to dst and returns the extended buffer.
+	Append(dst []byte) []byte
+	String() string
+}
+
+// ChannelMessage is a Channel Voice message addressed to one of the 16 MIDI channels.
+type ChannelMessage interface {
+	Message
+	// GetChannel returns the MIDI channel (0-15).
+	GetChannel() uint8
+}
+
+// NoteOff stops a note.
+type NoteOff struct {
+	Channel  uint8
+	Key      uint8
+	Velocity uint8
+}
+
+// NoteOn starts a note. A NoteOn with velocity 0 is equivalent to a NoteOff.
+type NoteOn struct {
+	Channel  uint8
+	Key      uint8
+	Velocity uint8
+}
+
+// PolyPressure is the polyphonic aftertouch of a single note.
+type PolyPressure struct {
+	Channel  uint8
+	Key      uint8
+	Pressure uint8
+}
+
+// ControlChange sets the value of a controller.
+type ControlChange struct {
+	Channel    uint8
+	Controller uint8
+	Value      uint8
+}
+
+// ProgramChange selects a program.
+type ProgramChange struct {
+	Channel uint8
+	Program uint8
+}
+
+// ChannelPressure is the aftertouch of a whole channel.
+type ChannelPressure struct {
+	Channel  uint8
+	Pressure uint8
+}
+
+// PitchBend changes the pitch of a channel.
+type PitchBend struct {
+	Channel uint8
+	// Value is the signed 14 bit pitch bend value (-8192 to 8191), 0 is the center.
+	Value int16
+}
+
+// SysEx is a System Exclusive message.
+type SysEx struct {
+	// Data contains the message without the enclosing 0xf0 and 0xf7 bytes.
+	Data []byte
+}
+
+// QuarterFrame is a MIDI Time Code quarter frame message.
+type QuarterFrame struct {
+	// Type is the piece of the time code (0-7).
+	Type uint8
+	// Value is the 4 bit value of the piece.
+	Value uint8
+}
+
+// SongPosition sets the song position pointer.
+type SongPosition struct {
+	// Position is the number of MIDI beats (sixteenth notes) since the start of the song.
+	Position uint16
+}
+
+// SongSelect selects a song.
+type SongSelect struct {
+	Song uint8
+}
+
+// TuneRequest requests analog synthesizers to tune their oscillators.
+type TuneRequest struct{}
+
+// Realtime is a System Real-Time message, represented by its status byte.
+type Realtime uint8
+
+// System Real-Time messages
+const (
+	Clock         Realtime = 0xf8
+	Start         Realtime = 0xfa
+	Continue      Realtime = 0xfb
+	Stop          Realtime = 0xfc
+	ActiveSensing Realtime = 0xfe
+	Reset         Realtime = 0xff
+)
+
+const (
+	noteOffStatus         = 0x80
+	noteOnStatus          = 0x90
+	polyPressureStatus    = 0xa0
+	controlChangeStatus   = 0xb0
+	programChangeStatus   = 0xc0
+	channelPressureStatus = 0xd0
+	pitchBendStatus       = 0xe0
+	sysExStatus           = 0xf0
+	quarterFrameStatus    = 0xf1
+	songPositionStatus    = 0xf2
+	songSelectStatus      = 0xf3
+	tuneRequestStatus     = 0xf6
+	sysExEndStatus        = 0xf7
+
+	channelMask = 0x0f
+	dataMask    = 0x7f
+
+	pitchBendCenter = 0x2000
+)
+
+// Parse parses the bytes of a single complete MIDI message including its status byte.
+func Parse(b []byte) (Message, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty MIDI message")
+	}
+	status := b[0]
+	info := GetCommandInfo(status)
+	if info == nil {
+		return nil, fmt.Errorf("undefined MIDI status %X", status)
+	}
+	if status == sysExStatus {
+		if len(b) < 2 || b[len(b)-1] != sysExEndStatus {
+			return nil, fmt.Errorf("SysEx message is not terminated")
+		}
+		data := b[1 : len(b)-1]
+		for _, d := range data {
+			if IsStatus(d) {
+				return nil, fmt.Errorf("unexpected status %X in SysEx message", d)
+			}
+		}
+		return SysEx{Data: data}, nil
+	}
+	if len(b) != info.dataLength+1 {
+		return nil, fmt.Errorf("%s expects %d data bytes, got %d", info.name, info.dataLength, len(b)-1)
+	}
+	for _, d := range b[1:] {
+		if IsStatus(d) {
+			return nil, fmt.Errorf("unexpected status %X in %s", d, info.name)
+		}
+	}
+
+	channel := status & channelMask
+	switch status & 0xf0 {
+	case noteOffStatus:
+		return NoteOff{Channel: channel, Key: b[1], Velocity: b[2]}, nil
+	case noteOnStatus:
+		return NoteOn{Channel: channel, Key: b[1], Velocity: b[2]}, nil
+	case polyPressureStatus:
+		return PolyPressure{Channel: channel, Key: b[1], Pressure: b[2]}, nil
+	case controlChangeStatus:
+		return ControlChange{Channel: channel, Controller: b[1], Value: b[2]}, nil
+	case programChangeStatus:
+		return ProgramChange{Channel: channel, Program: b[1]}, nil
+	case channelPressureStatus:
+		return ChannelPressure{Channel: channel, Pressure: b[1]}, nil
+	case pitchBendStatus:
+		return PitchBend{Channel: channel, Value: int16(uint16(b[2])<<7|uint16(b[1])) - pitchBendCenter}, nil
+	}
+
+	switch status {
+	case quarterFrameStatus:
+		return QuarterFrame{Type: b[1] >> 4 & 0x07, Value: b[1] & 0x0f}, nil
+	case songPositionStatus:
+		return SongPosition{Position: uint16(b[2])<<7 | uint16(b[1])}, nil
+	case songSelectStatus:
+		return SongSelect{Song: b[1]}, nil
+	case tuneRequestStatus:
+		return TuneRequest{}, nil
+	}
+	return Realtime(status), nil
+}
+
+// Encode returns the MIDI 1.0 bytes of the message.
+func Encode(m Message) []byte {
+	return m.Append(nil)
+}
+
+// WithChannel returns the channel message addressed to another channel (0-15).
+func WithChannel(m ChannelMessage, channel uint8) ChannelMessage {
+	switch msg := m.(type) {
+	case NoteOff:
+		msg.Channel = channel
+		return msg
+	case NoteOn:
+		msg.Channel = channel
+		return msg
+	case PolyPressure:
+		msg.Channel = channel
+		return msg
+	case ControlChange:
+		msg.Channel = channel
+		return msg
+	case ProgramChange:
+		msg.Channel = channel
+		return msg
+	case ChannelPressure:
+		msg.Channel = channel
+		return msg
+	case PitchBend:
+		msg.Channel = channel
+		return msg
+	case ParameterChange:
+		msg.Channel = channel
+		return msg
+	case ControlChange14:
+		msg.Channel = channel
+		return msg
+	}
+	return m
+}
+
+// Name returns the name of the message with the given status byte.
+func Name(status byte) string {
+	info := GetCommandInfo(status)
+	if info == nil {
+		return fmt.Sprintf("undefined(%X)", status)
+	}
+	return info.name
+}
+
+// Append appends the MIDI bytes of the message.
+func (m NoteOff) Append(dst []byte) []byte {
+	return append(dst, noteOffStatus|m.Channel&channelMask, m.Key&dataMask, m.Velocity&dataMask)
+}
+
+// GetChannel returns the MIDI channel.
+func (m NoteOff) GetChannel() uint8 { return m.Channel }
+
+func (m NoteOff) String() string {
+	return fmt.Sprintf("%s ch=%d key=%d vel=%d", Name(noteOffStatus), m.Channel, m.Key, m.Velocity)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m NoteOn) Append(dst []byte) []byte {
+	return append(dst, noteOnStatus|m.Channel&channelMask, m.Key&dataMask, m.Velocity&dataMask)
+}
+
+// GetChannel returns the MIDI channel.
+func (m NoteOn) GetChannel() uint8 { return m.Channel }
+
+// IsNoteOff returns true if the velocity is 0.
+func (m NoteOn) IsNoteOff() bool { return m.Velocity == 0 }
+
+func (m NoteOn) String() string {
+	return fmt.Sprintf("%s ch=%d key=%d vel=%d", Name(noteOnStatus), m.Channel, m.Key, m.Velocity)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m PolyPressure) Append(dst []byte) []byte {
+	return append(dst, polyPressureStatus|m.Channel&channelMask, m.Key&dataMask, m.Pressure&dataMask)
+}
+
+// GetChannel returns the MIDI channel.
+func (m PolyPressure) GetChannel() uint8 { return m.Channel }
+
+func (m PolyPressure) String() string {
+	return fmt.Sprintf("%s ch=%d key=%d pressure=%d", Name(polyPressureStatus), m.Channel, m.Key, m.Pressure)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m ControlChange) Append(dst []byte) []byte {
+	return append(dst, controlChangeStatus|m.Channel&channelMask, m.Controller&dataMask, m.Value&dataMask)
+}
+
+// GetChannel returns the MIDI channel.
+func (m ControlChange) GetChannel() uint8 { return m.Channel }
+
+func (m ControlChange) String() string {
+	return fmt.Sprintf("%s ch=%d controller=%d value=%d", Name(controlChangeStatus), m.Channel, m.Controller, m.Value)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m ProgramChange) Append(dst []byte) []byte {
+	return append(dst, programChangeStatus|m.Channel&channelMask, m.Program&dataMask)
+}
+
+// GetChannel returns the MIDI channel.
+func (m ProgramChange) GetChannel() uint8 { return m.Channel }
+
+func (m ProgramChange) String() string {
+	return fmt.Sprintf("%s ch=%d program=%d", Name(programChangeStatus), m.Channel, m.Program)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m ChannelPressure) Append(dst []byte) []byte {
+	return append(dst, channelPressureStatus|m.Channel&channelMask, m.Pressure&dataMask)
+}
+
+// GetChannel returns the MIDI channel.
+func (m ChannelPressure) GetChannel() uint8 { return m.Channel }
+
+func (m ChannelPressure) String() string {
+	return fmt.Sprintf("%s ch=%d pressure=%d", Name(channelPressureStatus), m.Channel, m.Pressure)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m PitchBend) Append(dst []byte) []byte {
+	value := uint16(m.Value + pitchBendCenter)
+	return append(dst, pitchBendStatus|m.Channel&channelMask, byte(value)&dataMask, byte(value>>7)&dataMask)
+}
+
+// GetChannel returns the MIDI channel.
+func (m PitchBend) GetChannel() uint8 { return m.Channel }
+
+func (m PitchBend) String() string {
+	return fmt.Sprintf("%s ch=%d value=%d", Name(pitchBendStatus), m.Channel, m.Value)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m SysEx) Append(dst []byte) []byte {
+	dst = append(dst, sysExStatus)
+	dst = append(dst, m.Data...)
+	return append(dst, sysExEndStatus)
+}
+
+func (m SysEx) String() string {
+	return fmt.Sprintf("%s len=%d", Name(sysExStatus), len(m.Data))
+}
+
+// Append appends the MIDI bytes of the message.
+func (m QuarterFrame) Append(dst []byte) []byte {
+	return append(dst, quarterFrameStatus, (m.Type&0x07)<<4|m.Value&0x0f)
+}
+
+func (m QuarterFrame) String() string {
+	return fmt.Sprintf("%s type=%d value=%d", Name(quarterFrameStatus), m.Type, m.Value)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m SongPosition) Append(dst []byte) []byte {
+	return append(dst, songPositionStatus, byte(m.Position)&dataMask, byte(m.Position>>7)&dataMask)
+}
+
+func (m SongPosition) String() string {
+	return fmt.Sprintf("%s position=%d", Name(songPositionStatus), m.Position)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m SongSelect) Append(dst []byte) []byte {
+	return append(dst, songSelectStatus, m.Song&dataMask)
+}
+
+func (m SongSelect) String() string {
+	return fmt.Sprintf("%s song=%d", Name(songSelectStatus), m.Song)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m TuneRequest) Append(dst []byte) []byte {
+	return append(dst, tuneRequestStatus)
+}
+
+func (m TuneRequest) String() string {
+	return Name(tuneRequestStatus)
+}
+
+// Append appends the MIDI bytes of the message.
+func (m Realtime) Append(dst []byte) []byte {
+	return append(dst, byte(m))
+}
+
+func (m Realtime) String() string {
+	return Name(byte(m))
+}
@@ -0,0 +1,77 @@
+package midi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Parse_and_Encode_of_messages(t *testing.T) {
+	messages := map[string]Message{
+		"\x93\x3c\x40":     NoteOn{Channel: 3, Key: 0x3c, Velocity: 0x40},
+		"\x83\x3c\x00":     NoteOff{Channel: 3, Key: 0x3c},
+		"\xa1\x3c\x22":     PolyPressure{Channel: 1, Key: 0x3c, Pressure: 0x22},
+		"\xbf\x07\x64":     ControlChange{Channel: 15, Controller: 7, Value: 100},
+		"\xc0\x05":         ProgramChange{Program: 5},
+		"\xd2\x33":         ChannelPressure{Channel: 2, Pressure: 0x33},
+		"\xe0\x00\x40":     PitchBend{Value: 0},
+		"\xe0\x00\x00":     PitchBend{Value: -8192},
+		"\xe0\x7f\x7f":     PitchBend{Value: 8191},
+		"\xf0\x7e\x01\xf7": SysEx{Data: []byte{0x7e, 0x01}},
+		"\xf1\x35":         QuarterFrame{Type: 3, Value: 5},
+		"\xf2\x10\x01":     SongPosition{Position: 0x90},
+		"\xf3\x02":         SongSelect{Song: 2},
+		"\xf6":             TuneRequest{},
+		"\xf8":             Clock,
+		"\xfc":             Stop,
+	}
+	for raw, expected := range messages {
+		// when
+		actual, err := Parse([]byte(raw))
+		// then
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+		assert.Equal(t, []byte(raw), Encode(expected))
+	}
+}
+
+func Test_Parse_of_invalid_messages(t *testing.T) {
+	invalid := [][]byte{
+		{},
+		{0x3c, 0x40},
+		{0x90, 0x3c},
+		{0x90, 0x3c, 0x40, 0x00},
+		{0x90, 0x3c, 0xf8},
+		{0xf0, 0x01},
+		{0xf0, 0x01, 0x90, 0xf7},
+		{0xf4},
+	}
+	for _, b := range invalid {
+		_, err := Parse(b)
+		assert.NotNil(t, err, "%X", b)
+	}
+}
+
+func Test_channel_accessor(t *testing.T) {
+	// given
+	m, _ := Parse([]byte{0x9a, 0x3c, 0x40})
+	// when
+	cm, ok := m.(ChannelMessage)
+	// then
+	assert.True(t, ok)
+	assert.Equal(t, uint8(10), cm.GetChannel())
+}
+
+func Test_String_of_messages(t *testing.T) {
+	assert.Equal(t, "noteOn ch=0 key=60 vel=64", NoteOn{Key: 60, Velocity: 64}.String())
+	assert.Equal(t, "pitchBend ch=1 value=-100", PitchBend{Channel: 1, Value: -100}.String())
+	assert.Equal(t, "clock", Clock.String())
+	assert.Equal(t, "undefined(F9)", Realtime(0xf9).String())
+}
+
+func Test_WithChannel(t *testing.T) {
+	// when
+	m := WithChannel(NoteOn{Channel: 1, Key: 60, Velocity: 100}, 9)
+	// then
+	assert.Equal(t, NoteOn{Channel: 9, Key: 60, Velocity: 100}, m)
+}
@@ -14,12 +14,34 @@ func GetCommandInfo(command byte) *commandInfo {
 	if info, ok := commandsInfos[command]; ok {
 		return &info
 	}
+	if command >= 0xf0 {
+		return nil
+	}
 	if info, ok := commandsInfos[command&0xf0]; ok {
 		return &info
 	}
 	return nil
 }
 
+// IsStatus returns true if the byte is a status byte.
+func IsStatus(b byte) bool {
+	return b&0x80 != 0
+}
+
+// IsRealtime returns true if the byte is a System Real-Time status byte (0xf8-0xff).
+// Real-Time messages consist of a single byte and may be interleaved anywhere in the
+// MIDI byte stream, even inside SysEx or between a status byte and its data bytes.
+// They do not affect the running status.
+func IsRealtime(b byte) bool {
+	return b >= 0xf8
+}
+
+// IsSystemCommon returns true if the byte is a System Common status byte (0xf0-0xf7),
+// including the SysEx start and end bytes. System Common messages cancel the running status.
+func IsSystemCommon(b byte) bool {
+	return b >= 0xf0 && b < 0xf8
+}
+
 type commandInfo struct {
 	dataLength int
 	name       string
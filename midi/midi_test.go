@@ -0,0 +1,26 @@
+package midi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_status_classification(t *testing.T) {
+	assert.False(t, IsStatus(0x7f))
+	assert.True(t, IsStatus(0x80))
+	assert.True(t, IsRealtime(0xf8))
+	assert.True(t, IsRealtime(0xfe))
+	assert.False(t, IsRealtime(0xf7))
+	assert.True(t, IsSystemCommon(0xf0))
+	assert.True(t, IsSystemCommon(0xf7))
+	assert.False(t, IsSystemCommon(0xf8))
+}
+
+func Test_command_info_of_undefined_status(t *testing.T) {
+	assert.Nil(t, GetCommandInfo(0xf4))
+	assert.Nil(t, GetCommandInfo(0xf9))
+	assert.Nil(t, GetCommandInfo(0xfd))
+	assert.Equal(t, 2, GetDataLength(0x9f))
+	assert.Equal(t, 0, GetDataLength(0xf8))
+}
@@ -0,0 +1,259 @@
+package midi
+
+import (
+	"fmt"
+)
+
+// controllers used to select and change parameters
+const (
+	dataEntryMSB      = 6
+	dataEntryLSB      = 38
+	dataIncrement     = 96
+	dataDecrement     = 97
+	nrpnLSB           = 98
+	nrpnMSB           = 99
+	rpnLSB            = 100
+	rpnMSB            = 101
+	highResolutionLSB = 32
+	// nullParameter deselects the current parameter if sent as RPN
+	nullParameter = 0x3fff
+)
+
+// ParameterKind distinguishes registered and non-registered parameters.
+type ParameterKind uint8
+
+const (
+	// RPN is a Registered Parameter Number.
+	RPN ParameterKind = iota
+	// NRPN is a Non-Registered Parameter Number.
+	NRPN
+)
+
+func (k ParameterKind) String() string {
+	if k == NRPN {
+		return "NRPN"
+	}
+	return "RPN"
+}
+
+// ParameterOp is the change applied to a parameter.
+type ParameterOp uint8
+
+const (
+	// SetValue sets the value of the parameter.
+	SetValue ParameterOp = iota
+	// Increment increments the value of the parameter.
+	Increment
+	// Decrement decrements the value of the parameter.
+	Decrement
+)
+
+// ParameterChange changes a registered or non-registered parameter of a channel.
+//
+// A ParameterChange is a Message, its MIDI bytes are the sequence of control changes
+// selecting the parameter followed by the data entry, increment or decrement. Each
+// control change is a MIDI command of its own, see Messages.
+type ParameterChange struct {
+	Channel uint8
+	Kind    ParameterKind
+	// Parameter is the 14 bit parameter number.
+	Parameter uint16
+	Op        ParameterOp
+	// Value is the 14 bit value for SetValue, or the 7 bit step for Increment and Decrement.
+	Value uint16
+}
+
+// Append appends the control changes of the parameter change.
+func (m ParameterChange) Append(dst []byte) []byte {
+	return appendAll(dst, m.Messages())
+}
+
+// AppendTerminated appends the control changes of the parameter change followed by
+// the null RPN, which protects the parameter from later data entries.
+func (m ParameterChange) AppendTerminated(dst []byte) []byte {
+	return appendAll(dst, m.TerminatedMessages())
+}
+
+// Messages returns the control changes of the parameter change.
+func (m ParameterChange) Messages() []Message {
+	msb, lsb := uint8(rpnMSB), uint8(rpnLSB)
+	if m.Kind == NRPN {
+		msb, lsb = nrpnMSB, nrpnLSB
+	}
+	messages := []Message{m.cc(msb, uint8(m.Parameter>>7)), m.cc(lsb, uint8(m.Parameter))}
+	switch m.Op {
+	case Increment:
+		return append(messages, m.cc(dataIncrement, uint8(m.Value)))
+	case Decrement:
+		return append(messages, m.cc(dataDecrement, uint8(m.Value)))
+	default:
+		return append(messages, m.cc(dataEntryMSB, uint8(m.Value>>7)), m.cc(dataEntryLSB, uint8(m.Value)))
+	}
+}
+
+// TerminatedMessages returns the control changes of the parameter change followed by
+// the null RPN.
+func (m ParameterChange) TerminatedMessages() []Message {
+	return append(m.Messages(), m.cc(rpnMSB, nullParameter>>7), m.cc(rpnLSB, nullParameter&dataMask))
+}
+
+func (m ParameterChange) cc(controller, value uint8) ControlChange {
+	return ControlChange{Channel: m.Channel, Controller: controller, Value: value & dataMask}
+}
+
+// GetChannel returns the MIDI channel.
+func (m ParameterChange) GetChannel() uint8 { return m.Channel }
+
+func (m ParameterChange) String() string {
+	op := "value"
+	switch m.Op {
+	case Increment:
+		op = "increment"
+	case Decrement:
+		op = "decrement"
+	}
+	return fmt.Sprintf("%s ch=%d parameter=%d %s=%d", m.Kind, m.Channel, m.Parameter, op, m.Value)
+}
+
+// ControlChange14 sets the 14 bit value of one of the controllers 0-31 with the
+// controllers 32-63 as least significant bits.
+type ControlChange14 struct {
+	Channel    uint8
+	Controller uint8
+	// Value is the 14 bit value of the controller.
+	Value uint16
+}
+
+// Append appends the control changes of the most and least significant bits.
+func (m ControlChange14) Append(dst []byte) []byte {
+	return appendAll(dst, m.Messages())
+}
+
+// Messages returns the control changes of the most and least significant bits.
+func (m ControlChange14) Messages() []Message {
+	return []Message{
+		ControlChange{Channel: m.Channel, Controller: m.Controller, Value: uint8(m.Value>>7) & dataMask},
+		ControlChange{Channel: m.Channel, Controller: m.Controller + highResolutionLSB, Value: uint8(m.Value) & dataMask},
+	}
+}
+
+// Split returns the control changes of parameter changes and 14 bit control changes, which
+// are sent as separate MIDI commands, or the message itself.
+//
+// A receiver parses the first control change of a MIDI command only, so the encoding of a
+// parameter change must not be sent as a single command.
+func Split(m Message) []Message {
+	switch msg := m.(type) {
+	case ParameterChange:
+		return msg.Messages()
+	case ControlChange14:
+		return msg.Messages()
+	}
+	return []Message{m}
+}
+
+func appendAll(dst []byte, messages []Message) []byte {
+	for _, m := range messages {
+		dst = m.Append(dst)
+	}
+	return dst
+}
+
+// GetChannel returns the MIDI channel.
+func (m ControlChange14) GetChannel() uint8 { return m.Channel }
+
+func (m ControlChange14) String() string {
+	return fmt.Sprintf("%s ch=%d controller=%d value=%d", Name(controlChangeStatus), m.Channel, m.Controller, m.Value)
+}
+
+// ParameterAssembler assembles the control changes of each channel into parameter changes
+// and 14 bit control changes.
+type ParameterAssembler struct {
+	channels       [16]channelParameters
+	highResolution [highResolutionLSB]bool
+}
+
+type channelParameters struct {
+	kind     ParameterKind
+	msb      int
+	lsb      int
+	valueMSB uint8
+	msbs     [highResolutionLSB]uint8
+}
+
+// NewParameterAssembler creates a ParameterAssembler which assembles 14 bit control changes
+// of the given controllers (0-31). Other controllers are passed as 7 bit control changes.
+func NewParameterAssembler(highResolution ...uint8) *ParameterAssembler {
+	a := &ParameterAssembler{}
+	for i := range a.channels {
+		a.channels[i].msb, a.channels[i].lsb = -1, -1
+	}
+	for _, c := range highResolution {
+		if c < highResolutionLSB {
+			a.highResolution[c] = true
+		}
+	}
+	return a
+}
+
+// Assemble returns the message resulting from the control change.
+//
+// Parameter selections do not result in a message and return false. Data entries return
+// a ParameterChange of the selected parameter, or false if no parameter is selected.
+// Controllers configured for high resolution return a ControlChange14 for each of the
+// most and least significant bits. Other control changes are returned unchanged.
+func (a *ParameterAssembler) Assemble(m ControlChange) (Message, bool) {
+	ch := &a.channels[m.Channel&channelMask]
+	switch m.Controller {
+	case rpnMSB, nrpnMSB:
+		ch.selectParameter(m.Controller == nrpnMSB)
+		ch.msb = int(m.Value & dataMask)
+		ch.valueMSB = 0
+		return nil, false
+	case rpnLSB, nrpnLSB:
+		ch.selectParameter(m.Controller == nrpnLSB)
+		ch.lsb = int(m.Value & dataMask)
+		ch.valueMSB = 0
+		return nil, false
+	case dataEntryMSB:
+		ch.valueMSB = m.Value & dataMask
+		return ch.change(m.Channel, SetValue, uint16(ch.valueMSB)<<7)
+	case dataEntryLSB:
+		return ch.change(m.Channel, SetValue, uint16(ch.valueMSB)<<7|uint16(m.Value&dataMask))
+	case dataIncrement:
+		return ch.change(m.Channel, Increment, uint16(m.Value&dataMask))
+	case dataDecrement:
+		return ch.change(m.Channel, Decrement, uint16(m.Value&dataMask))
+	}
+	if m.Controller < highResolutionLSB && a.highResolution[m.Controller] {
+		ch.msbs[m.Controller] = m.Value & dataMask
+		return ControlChange14{Channel: m.Channel, Controller: m.Controller, Value: uint16(m.Value&dataMask) << 7}, true
+	}
+	if c := m.Controller - highResolutionLSB; m.Controller >= highResolutionLSB && c < highResolutionLSB && a.highResolution[c] {
+		return ControlChange14{Channel: m.Channel, Controller: c, Value: uint16(ch.msbs[c])<<7 | uint16(m.Value&dataMask)}, true
+	}
+	return m, true
+}
+
+// selectParameter starts a new selection if the kind of parameter changes.
+func (ch *channelParameters) selectParameter(nrpn bool) {
+	kind := RPN
+	if nrpn {
+		kind = NRPN
+	}
+	if kind != ch.kind {
+		ch.kind = kind
+		ch.msb, ch.lsb = -1, -1
+	}
+}
+
+func (ch *channelParameters) change(channel uint8, op ParameterOp, value uint16) (Message, bool) {
+	if ch.msb < 0 || ch.lsb < 0 {
+		return nil, false
+	}
+	parameter := uint16(ch.msb)<<7 | uint16(ch.lsb)
+	if ch.kind == RPN && parameter == nullParameter {
+		return nil, false
+	}
+	return ParameterChange{Channel: channel, Kind: ch.kind, Parameter: parameter, Op: op, Value: value}, true
+}
@@ -0,0 +1,93 @@
+package midi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assembleAll(a *ParameterAssembler, b []byte) []Message {
+	messages := []Message{}
+	for i := 0; i+2 < len(b); i += 3 {
+		m, ok := a.Assemble(ControlChange{Channel: b[i] & 0x0f, Controller: b[i+1], Value: b[i+2]})
+		if ok {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+func Test_assemble_nrpn_value(t *testing.T) {
+	// given
+	a := NewParameterAssembler()
+	expected := ParameterChange{Channel: 2, Kind: NRPN, Parameter: 0x0123, Value: 0x1fff}
+	// when
+	messages := assembleAll(a, expected.Append(nil))
+	// then
+	assert.Equal(t, []byte{0xb2, 99, 0x02, 0xb2, 98, 0x23, 0xb2, 6, 0x3f, 0xb2, 38, 0x7f}, expected.Append(nil))
+	assert.Equal(t, []Message{
+		ParameterChange{Channel: 2, Kind: NRPN, Parameter: 0x0123, Value: 0x1f80},
+		expected,
+	}, messages)
+}
+
+func Test_assemble_rpn_increment_decrement_and_null(t *testing.T) {
+	// given
+	a := NewParameterAssembler()
+	increment := ParameterChange{Kind: RPN, Parameter: 0, Op: Increment, Value: 1}
+	// when
+	b := increment.AppendTerminated(nil)
+	b = append(b, 0xb0, 96, 1)
+	b = append(b, 0xb0, 101, 0, 0xb0, 100, 1, 0xb0, 97, 2)
+	messages := assembleAll(a, b)
+	// then
+	assert.Equal(t, []Message{
+		increment,
+		ParameterChange{Kind: RPN, Parameter: 1, Op: Decrement, Value: 2},
+	}, messages)
+}
+
+func Test_data_entry_without_parameter_is_ignored(t *testing.T) {
+	// given
+	a := NewParameterAssembler()
+	// when
+	messages := assembleAll(a, []byte{0xb0, 6, 0x40, 0xb0, 101, 0x00, 0xb0, 6, 0x40})
+	// then
+	assert.Empty(t, messages)
+}
+
+func Test_assemble_14_bit_control_changes(t *testing.T) {
+	// given
+	a := NewParameterAssembler(1)
+	expected := ControlChange14{Channel: 5, Controller: 1, Value: 0x2abc}
+	// when
+	messages := assembleAll(a, append(expected.Append(nil), 0xb5, 7, 100))
+	// then
+	assert.Equal(t, []Message{
+		ControlChange14{Channel: 5, Controller: 1, Value: 0x2a80},
+		expected,
+		ControlChange{Channel: 5, Controller: 7, Value: 100},
+	}, messages)
+}
+
+func Test_split_parameter_and_14_bit_control_changes(t *testing.T) {
+	// given
+	p := ParameterChange{Channel: 2, Kind: NRPN, Parameter: 0x0123, Value: 0x1fff}
+	cc := ControlChange14{Channel: 3, Controller: 7, Value: 0x0101}
+	note := NoteOn{Channel: 1, Key: 60, Velocity: 100}
+	// when
+	parameter, controller, single := Split(p), Split(cc), Split(note)
+	// then
+	assert.Equal(t, []Message{
+		ControlChange{Channel: 2, Controller: nrpnMSB, Value: 0x02},
+		ControlChange{Channel: 2, Controller: nrpnLSB, Value: 0x23},
+		ControlChange{Channel: 2, Controller: dataEntryMSB, Value: 0x3f},
+		ControlChange{Channel: 2, Controller: dataEntryLSB, Value: 0x7f},
+	}, parameter)
+	assert.Equal(t, []Message{
+		ControlChange{Channel: 3, Controller: 7, Value: 0x02},
+		ControlChange{Channel: 3, Controller: 39, Value: 0x01},
+	}, controller)
+	assert.Equal(t, []Message{note}, single)
+	assert.Equal(t, appendAll(nil, p.TerminatedMessages()), p.AppendTerminated(nil))
+}
@@ -0,0 +1,134 @@
+package midi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Reader parses a MIDI 1.0 byte stream into typed messages, e.g. the bytes
+// received from a DIN MIDI port over a serial line or a pipe.
+//
+// The Reader supports running status and System Real-Time messages interleaved
+// anywhere in the stream, even inside SysEx or between a status byte and its
+// data bytes. Undefined status bytes (0xf4, 0xf5, 0xf9, 0xfd) are ignored and data
+// bytes without a status are dropped until the next status byte resynchronizes the stream.
+type Reader struct {
+	// MaxSysExSize limits the size of SysEx messages in bytes (0: unlimited).
+	// Larger SysEx messages are dropped.
+	MaxSysExSize int
+
+	r        io.ByteReader
+	status   byte
+	data     [2]byte
+	count    int
+	inSysEx  bool
+	overflow bool
+	sysEx    []byte
+}
+
+// NewReader returns a Reader parsing the MIDI bytes read from r.
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{r: br}
+}
+
+// Read returns the next complete message of the stream.
+//
+// System Real-Time messages are returned as soon as they are read, the interrupted
+// message is continued by the succeeding calls.
+func (r *Reader) Read() (Message, error) {
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if IsRealtime(b) {
+			if GetCommandInfo(b) != nil {
+				return Realtime(b), nil
+			}
+			continue
+		}
+
+		if !IsStatus(b) {
+			if m := r.handleData(b); m != nil {
+				return m, nil
+			}
+			continue
+		}
+
+		if r.inSysEx {
+			r.inSysEx = false
+			if b == sysExEndStatus {
+				if r.overflow {
+					continue
+				}
+				return SysEx{Data: append([]byte(nil), r.sysEx...)}, nil
+			}
+			// SysEx is aborted by any other status byte, which starts the next message
+		}
+
+		if m := r.handleStatus(b); m != nil {
+			return m, nil
+		}
+	}
+}
+
+func (r *Reader) handleStatus(b byte) Message {
+	r.count = 0
+	if IsSystemCommon(b) {
+		// System Common messages cancel the running status
+		r.status = 0
+	} else {
+		r.status = b
+	}
+
+	switch b {
+	case sysExStatus:
+		r.inSysEx = true
+		r.overflow = false
+		r.sysEx = r.sysEx[:0]
+	case tuneRequestStatus:
+		return TuneRequest{}
+	case quarterFrameStatus, songPositionStatus, songSelectStatus:
+		r.status = b
+	}
+	// undefined System Common status bytes and a stray end of SysEx are ignored
+	return nil
+}
+
+func (r *Reader) handleData(b byte) Message {
+	if r.inSysEx {
+		if r.MaxSysExSize > 0 && len(r.sysEx) >= r.MaxSysExSize {
+			r.overflow = true
+			return nil
+		}
+		r.sysEx = append(r.sysEx, b)
+		return nil
+	}
+	if r.status == 0 {
+		// data without status, wait for the next status byte
+		return nil
+	}
+
+	r.data[r.count] = b
+	r.count++
+	if r.count < GetDataLength(r.status) {
+		return nil
+	}
+
+	m, err := Parse(append([]byte{r.status}, r.data[:r.count]...))
+	r.count = 0
+	if IsSystemCommon(r.status) {
+		r.status = 0
+	}
+	if err != nil {
+		fmt.Printf("[INFO] Dropping invalid MIDI message: %s\n", err)
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,106 @@
+package midi
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, r *Reader) []Message {
+	messages := []Message{}
+	for {
+		m, err := r.Read()
+		if err == io.EOF {
+			return messages
+		}
+		assert.Nil(t, err)
+		messages = append(messages, m)
+	}
+}
+
+func Test_Reader_with_running_status(t *testing.T) {
+	// given
+	r := NewReader(bytes.NewReader([]byte{0x90, 0x3c, 0x40, 0x3e, 0x40, 0x3c, 0x00, 0xc1, 0x05, 0x06}))
+	// when
+	messages := readAll(t, r)
+	// then
+	assert.Equal(t, []Message{
+		NoteOn{Key: 0x3c, Velocity: 0x40},
+		NoteOn{Key: 0x3e, Velocity: 0x40},
+		NoteOn{Key: 0x3c},
+		ProgramChange{Channel: 1, Program: 5},
+		ProgramChange{Channel: 1, Program: 6},
+	}, messages)
+}
+
+func Test_Reader_with_interleaved_realtime(t *testing.T) {
+	// given
+	r := NewReader(bytes.NewReader([]byte{
+		0x90, 0xf8, 0x3c, 0xfe, 0x40, // note on interrupted by clock and active sensing
+		0xf0, 0x7e, 0xf8, 0x01, 0xf7, // SysEx interrupted by clock
+		0x3e, 0x40, // running status is cancelled by SysEx
+		0xf8,
+	}))
+	// when
+	messages := readAll(t, r)
+	// then
+	assert.Equal(t, []Message{
+		Clock,
+		ActiveSensing,
+		NoteOn{Key: 0x3c, Velocity: 0x40},
+		Clock,
+		SysEx{Data: []byte{0x7e, 0x01}},
+		Clock,
+	}, messages)
+}
+
+func Test_Reader_ignores_undefined_status(t *testing.T) {
+	// given
+	r := NewReader(bytes.NewReader([]byte{
+		0xb0, 0x07, 0x64, 0xf4, 0x07, 0x64, // undefined status cancels running status
+		0xf9, 0xfd, 0xf5, 0xf7, // undefined and stray status bytes
+		0xf2, 0x10, 0x01, 0x05, // song position, data without status
+		0xf6,
+	}))
+	// when
+	messages := readAll(t, r)
+	// then
+	assert.Equal(t, []Message{
+		ControlChange{Controller: 7, Value: 100},
+		SongPosition{Position: 0x90},
+		TuneRequest{},
+	}, messages)
+}
+
+func Test_Reader_resynchronizes_after_garbage(t *testing.T) {
+	// given
+	r := NewReader(bytes.NewReader([]byte{
+		0x3c, 0x40, 0x12, // garbage without status
+		0x90, 0x3c, // incomplete note on
+		0xf0, 0x01, 0x02, // incomplete SysEx
+		0x80, 0x3c, 0x00,
+	}))
+	// when
+	messages := readAll(t, r)
+	// then
+	assert.Equal(t, []Message{
+		NoteOff{Key: 0x3c},
+	}, messages)
+}
+
+func Test_Reader_limits_SysEx_size(t *testing.T) {
+	// given
+	r := NewReader(bytes.NewReader([]byte{
+		0xf0, 0x01, 0x02, 0x03, 0xf7,
+		0xf0, 0x01, 0x02, 0xf7,
+	}))
+	r.MaxSysExSize = 2
+	// when
+	messages := readAll(t, r)
+	// then
+	assert.Equal(t, []Message{
+		SysEx{Data: []byte{0x01, 0x02}},
+	}, messages)
+}
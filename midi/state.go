@@ -0,0 +1,175 @@
+package midi
+
+import "sync"
+
+// controllers used to silence a channel
+const (
+	sustainController   = 64
+	allSoundOff         = 120
+	resetAllControllers = 121
+	allNotesOff         = 123
+	// sustainOn is the smallest value of the sustain controller which holds the notes
+	sustainOn = 64
+)
+
+// StateTracker tracks the sounding notes, the sustain pedal and the changed controllers of
+// each channel, e.g. to silence a remote participant which disappears while playing.
+type StateTracker struct {
+	mutex    sync.Mutex
+	channels [16]channelState
+}
+
+type channelState struct {
+	notes    [128]bool
+	sounding int
+	sustain  bool
+	// controllers is true after a controller, pitch bend or pressure was changed
+	controllers bool
+}
+
+// NewStateTracker creates a StateTracker without sounding notes.
+func NewStateTracker() *StateTracker {
+	return &StateTracker{}
+}
+
+// Track updates the state with the message.
+func (t *StateTracker) Track(m Message) {
+	cm, ok := m.(ChannelMessage)
+	if !ok {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ch := &t.channels[cm.GetChannel()&0x0f]
+	switch msg := m.(type) {
+	case NoteOn:
+		if msg.IsNoteOff() {
+			ch.release(msg.Key)
+		} else {
+			ch.play(msg.Key)
+		}
+	case NoteOff:
+		ch.release(msg.Key)
+	case ControlChange:
+		switch {
+		case msg.Controller == sustainController:
+			ch.sustain = msg.Value >= sustainOn
+			ch.controllers = true
+		case msg.Controller == resetAllControllers:
+			ch.sustain = false
+			ch.controllers = false
+		case msg.Controller == allSoundOff || msg.Controller >= allNotesOff:
+			ch.notes = [128]bool{}
+			ch.sounding = 0
+		case msg.Controller < allSoundOff:
+			ch.controllers = true
+		}
+	case PitchBend:
+		ch.controllers = ch.controllers || msg.Value != 0
+	case ChannelPressure:
+		ch.controllers = ch.controllers || msg.Pressure != 0
+	case PolyPressure:
+		ch.controllers = ch.controllers || msg.Pressure != 0
+	}
+}
+
+// TrackPayload updates the state with the MIDI 1.0 bytes of a message.
+// Invalid messages are ignored.
+func (t *StateTracker) TrackPayload(b []byte) {
+	if m, err := Parse(b); err == nil {
+		t.Track(m)
+	}
+}
+
+// Sounding returns true if a note of the key is sounding on the channel.
+func (t *StateTracker) Sounding(channel, key uint8) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.channels[channel&0x0f].notes[key&0x7f]
+}
+
+// Active returns true if a note is sounding or a controller was changed on any channel.
+func (t *StateTracker) Active() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, ch := range t.channels {
+		if ch.active() {
+			return true
+		}
+	}
+	return false
+}
+
+// Release returns the messages which stop the sounding notes and reset the changed
+// controllers: a note off for each sounding note, a sustain off and a reset all
+// controllers. The state is reset.
+func (t *StateTracker) Release() []Message {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	messages := []Message{}
+	for i := range t.channels {
+		ch := &t.channels[i]
+		if !ch.active() {
+			continue
+		}
+		messages = ch.appendNoteOffs(messages, uint8(i))
+		if ch.sustain {
+			messages = append(messages, ControlChange{Channel: uint8(i), Controller: sustainController})
+		}
+		if ch.controllers {
+			messages = append(messages, ControlChange{Channel: uint8(i), Controller: resetAllControllers})
+		}
+		*ch = channelState{}
+	}
+	return messages
+}
+
+// Panic returns the messages of Release followed by a sustain off, a reset all controllers
+// and an all notes off on every channel, which also silence the notes not tracked.
+// The state is reset.
+func (t *StateTracker) Panic() []Message {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	messages := []Message{}
+	for i := range t.channels {
+		ch := &t.channels[i]
+		messages = ch.appendNoteOffs(messages, uint8(i))
+		messages = append(messages,
+			ControlChange{Channel: uint8(i), Controller: sustainController},
+			ControlChange{Channel: uint8(i), Controller: resetAllControllers},
+			ControlChange{Channel: uint8(i), Controller: allNotesOff},
+		)
+		*ch = channelState{}
+	}
+	return messages
+}
+
+func (ch *channelState) active() bool {
+	return ch.sounding > 0 || ch.sustain || ch.controllers
+}
+
+func (ch *channelState) play(key uint8) {
+	if !ch.notes[key&0x7f] {
+		ch.notes[key&0x7f] = true
+		ch.sounding++
+	}
+}
+
+func (ch *channelState) release(key uint8) {
+	if ch.notes[key&0x7f] {
+		ch.notes[key&0x7f] = false
+		ch.sounding--
+	}
+}
+
+func (ch *channelState) appendNoteOffs(messages []Message, channel uint8) []Message {
+	for key, sounding := range ch.notes {
+		if sounding {
+			messages = append(messages, NoteOff{Channel: channel, Key: uint8(key)})
+		}
+	}
+	return messages
+}
@@ -0,0 +1,67 @@
+package midi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_release_of_sounding_notes_and_sustain(t *testing.T) {
+	// given
+	s := NewStateTracker()
+	s.Track(NoteOn{Channel: 1, Key: 60, Velocity: 100})
+	s.Track(NoteOn{Channel: 1, Key: 64, Velocity: 100})
+	s.Track(NoteOn{Channel: 1, Key: 64, Velocity: 0})
+	s.Track(ControlChange{Channel: 1, Controller: 64, Value: 127})
+	s.Track(NoteOn{Channel: 3, Key: 40, Velocity: 90})
+	// when
+	messages := s.Release()
+	// then
+	assert.Equal(t, []Message{
+		NoteOff{Channel: 1, Key: 60},
+		ControlChange{Channel: 1, Controller: 64},
+		ControlChange{Channel: 1, Controller: 121},
+		NoteOff{Channel: 3, Key: 40},
+	}, messages)
+	assert.False(t, s.Active())
+	assert.Empty(t, s.Release())
+}
+
+func Test_track_controllers(t *testing.T) {
+	// given
+	s := NewStateTracker()
+	// when
+	s.TrackPayload([]byte{0xe2, 0x00, 0x40})
+	centered := s.Active()
+	s.TrackPayload([]byte{0xe2, 0x00, 0x50})
+	bent := s.Active()
+	s.TrackPayload([]byte{0xb2, 121, 0})
+	// then
+	assert.False(t, centered)
+	assert.True(t, bent)
+	assert.False(t, s.Active())
+}
+
+func Test_all_notes_off_releases_notes(t *testing.T) {
+	// given
+	s := NewStateTracker()
+	s.Track(NoteOn{Channel: 0, Key: 60, Velocity: 100})
+	// when
+	s.Track(ControlChange{Channel: 0, Controller: 123})
+	// then
+	assert.False(t, s.Sounding(0, 60))
+	assert.False(t, s.Active())
+}
+
+func Test_panic_silences_all_channels(t *testing.T) {
+	// given
+	s := NewStateTracker()
+	s.Track(NoteOn{Channel: 15, Key: 72, Velocity: 100})
+	// when
+	messages := s.Panic()
+	// then
+	assert.Equal(t, 16*3+1, len(messages))
+	assert.Equal(t, ControlChange{Channel: 0, Controller: 123}, messages[2])
+	assert.Equal(t, NoteOff{Channel: 15, Key: 72}, messages[45])
+	assert.False(t, s.Active())
+}
@@ -0,0 +1,69 @@
+package mpe
+
+// Allocator assigns a member channel of a zone to each played note.
+//
+// A note gets the free member channel which was released the longest time ago, so the
+// release phase of the previous note on the channel is not affected by the expression
+// of the new note. If all channels are in use, the channel of the oldest note is reused.
+type Allocator struct {
+	zone     Zone
+	notes    []int
+	lastUsed []uint64
+	clock    uint64
+}
+
+// NewAllocator creates an Allocator for the member channels of the zone.
+func NewAllocator(zone Zone) *Allocator {
+	a := &Allocator{zone: zone, notes: make([]int, zone.Members), lastUsed: make([]uint64, zone.Members)}
+	return a
+}
+
+// NoteOn returns the member channel to play the note on, and true if the channel was
+// taken from a playing note which has to be stopped first.
+func (a *Allocator) NoteOn(key uint8) (uint8, bool) {
+	if len(a.notes) == 0 {
+		return a.zone.ManagerChannel(), false
+	}
+	a.clock++
+	best, stolen := -1, false
+	for i := range a.notes {
+		if a.notes[i] == 0 && (best < 0 || a.lastUsed[i] < a.lastUsed[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		stolen = true
+		best = 0
+		for i := range a.notes {
+			if a.lastUsed[i] < a.lastUsed[best] {
+				best = i
+			}
+		}
+		a.notes[best] = 0
+	}
+	a.notes[best]++
+	a.lastUsed[best] = a.clock
+	return a.zone.Member(best), stolen
+}
+
+// NoteOff releases the member channel of a note.
+func (a *Allocator) NoteOff(channel uint8) {
+	i, member := a.zone.MemberIndex(channel)
+	if !member || i >= len(a.notes) || a.notes[i] == 0 {
+		return
+	}
+	a.notes[i]--
+	a.clock++
+	a.lastUsed[i] = a.clock
+}
+
+// Active returns the number of channels with playing notes.
+func (a *Allocator) Active() int {
+	active := 0
+	for _, n := range a.notes {
+		if n > 0 {
+			active++
+		}
+	}
+	return active
+}
@@ -0,0 +1,36 @@
+package mpe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_allocator_uses_least_recently_released_channel(t *testing.T) {
+	// given
+	a := NewAllocator(LowerZone(3))
+	// when
+	first, _ := a.NoteOn(60)
+	second, _ := a.NoteOn(62)
+	a.NoteOff(first)
+	third, _ := a.NoteOn(64)
+	fourth, _ := a.NoteOn(65)
+	// then
+	assert.Equal(t, uint8(1), first)
+	assert.Equal(t, uint8(2), second)
+	assert.Equal(t, uint8(3), third)
+	assert.Equal(t, uint8(1), fourth)
+	assert.Equal(t, 3, a.Active())
+}
+
+func Test_allocator_steals_oldest_note(t *testing.T) {
+	// given
+	a := NewAllocator(UpperZone(2))
+	a.NoteOn(60)
+	a.NoteOn(62)
+	// when
+	channel, stolen := a.NoteOn(64)
+	// then
+	assert.True(t, stolen)
+	assert.Equal(t, uint8(14), channel)
+}
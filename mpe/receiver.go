@@ -0,0 +1,215 @@
+package mpe
+
+import (
+	"sync"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+)
+
+// defaultTimbre is the center value of the timbre controller
+const defaultTimbre = 64
+
+// Note is a note played on a member channel with its per note expression.
+type Note struct {
+	Channel  uint8
+	Key      uint8
+	Velocity uint8
+	// PitchBend is the signed 14 bit pitch bend of the member channel.
+	PitchBend int16
+	// Pressure is the channel pressure of the member channel.
+	Pressure uint8
+	// Timbre is the value of controller 74 of the member channel.
+	Timbre uint8
+	// ZonePitchBend is the signed 14 bit pitch bend of the manager channel, which is
+	// added to the PitchBend of the member channel.
+	ZonePitchBend int16
+	// ZonePressure is the channel pressure of the manager channel.
+	ZonePressure uint8
+	// Playing is false after the note off, ReleaseVelocity is the velocity of the note off.
+	Playing         bool
+	ReleaseVelocity uint8
+}
+
+// Receiver groups the messages of the member channels into notes with their expression.
+//
+// The expression sent on a member channel before the note on is the initial expression of
+// the note. Pitch bend and channel pressure of the manager channel apply to all notes of
+// the zone. The layout of the zones is updated with received MPE Configuration Messages.
+//
+// The Receiver is used as handler of a session:
+//
+//	r := mpe.NewReceiver(mpe.Layout{Lower: mpe.LowerZone(15)})
+//	r.OnNote = func(n mpe.Note) { ... }
+//	s.Handle(r.HandleMIDI)
+type Receiver struct {
+	// OnNote is called with each note changed by a message received with HandleMIDI.
+	OnNote func(Note)
+
+	mutex      sync.Mutex
+	layout     Layout
+	parameters *midi.ParameterAssembler
+	channels   [16]memberChannel
+}
+
+type memberChannel struct {
+	pitchBend int16
+	pressure  uint8
+	timbre    uint8
+	notes     []Note
+}
+
+// NewReceiver creates a Receiver with the initial layout of the zones.
+func NewReceiver(layout Layout) *Receiver {
+	r := &Receiver{layout: layout, parameters: midi.NewParameterAssembler()}
+	r.layout.Upper.Upper = true
+	for i := range r.channels {
+		r.channels[i].timbre = defaultTimbre
+	}
+	return r
+}
+
+// Layout returns the current layout of the zones.
+func (r *Receiver) Layout() Layout {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.layout
+}
+
+// Notes returns the playing notes.
+func (r *Receiver) Notes() []Note {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	notes := []Note{}
+	for _, ch := range r.channels {
+		notes = append(notes, ch.notes...)
+	}
+	return notes
+}
+
+// HandleMIDI handles the commands of the received message and calls OnNote for changed notes.
+func (r *Receiver) HandleMIDI(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
+	for _, mc := range msg.Commands.Commands {
+		m, err := mc.Payload.Message()
+		if err != nil {
+			continue
+		}
+		for _, n := range r.Handle(m) {
+			if r.OnNote != nil {
+				r.OnNote(n)
+			}
+		}
+	}
+}
+
+// Handle returns the notes changed by the message.
+// Messages of channels outside the zones do not change notes.
+func (r *Receiver) Handle(m midi.Message) []Note {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if cc, ok := m.(midi.ControlChange); ok {
+		if m, ok = r.parameters.Assemble(cc); !ok {
+			return nil
+		}
+	}
+	if p, ok := m.(midi.ParameterChange); ok {
+		r.layout.Apply(p)
+		return nil
+	}
+	cm, ok := m.(midi.ChannelMessage)
+	if !ok {
+		return nil
+	}
+	zone, found := r.layout.Zone(cm.GetChannel())
+	if !found {
+		return nil
+	}
+	manager := &r.channels[zone.ManagerChannel()]
+	if cm.GetChannel() == zone.ManagerChannel() {
+		return r.manage(zone, m)
+	}
+
+	ch := &r.channels[cm.GetChannel()]
+	switch msg := m.(type) {
+	case midi.NoteOn:
+		if msg.IsNoteOff() {
+			return ch.release(msg.Key, 0)
+		}
+		n := Note{
+			Channel:   msg.Channel,
+			Key:       msg.Key,
+			Velocity:  msg.Velocity,
+			PitchBend: ch.pitchBend,
+			Pressure:  ch.pressure,
+			Timbre:    ch.timbre,
+			Playing:   true,
+
+			ZonePitchBend: manager.pitchBend,
+			ZonePressure:  manager.pressure,
+		}
+		ch.notes = append(ch.notes, n)
+		return []Note{n}
+	case midi.NoteOff:
+		return ch.release(msg.Key, msg.Velocity)
+	case midi.PitchBend:
+		ch.pitchBend = msg.Value
+	case midi.ChannelPressure:
+		ch.pressure = msg.Pressure
+	case midi.ControlChange:
+		if msg.Controller != timbreController {
+			return nil
+		}
+		ch.timbre = msg.Value
+	default:
+		return nil
+	}
+	return ch.express()
+}
+
+// manage applies the pitch bend and the channel pressure of the manager channel to the
+// notes of all member channels of the zone.
+func (r *Receiver) manage(zone Zone, m midi.Message) []Note {
+	manager := &r.channels[zone.ManagerChannel()]
+	switch msg := m.(type) {
+	case midi.PitchBend:
+		manager.pitchBend = msg.Value
+	case midi.ChannelPressure:
+		manager.pressure = msg.Pressure
+	default:
+		return nil
+	}
+	var notes []Note
+	for i := 0; i < zone.Members; i++ {
+		ch := &r.channels[zone.Member(i)]
+		for j := range ch.notes {
+			ch.notes[j].ZonePitchBend = manager.pitchBend
+			ch.notes[j].ZonePressure = manager.pressure
+		}
+		notes = append(notes, ch.notes...)
+	}
+	return notes
+}
+
+// express applies the expression of the channel to its notes.
+func (ch *memberChannel) express() []Note {
+	for i := range ch.notes {
+		ch.notes[i].PitchBend = ch.pitchBend
+		ch.notes[i].Pressure = ch.pressure
+		ch.notes[i].Timbre = ch.timbre
+	}
+	return append([]Note(nil), ch.notes...)
+}
+
+func (ch *memberChannel) release(key, velocity uint8) []Note {
+	for i, n := range ch.notes {
+		if n.Key == key {
+			ch.notes = append(ch.notes[:i], ch.notes[i+1:]...)
+			n.Playing = false
+			n.ReleaseVelocity = velocity
+			return []Note{n}
+		}
+	}
+	return nil
+}
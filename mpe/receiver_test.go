@@ -0,0 +1,63 @@
+package mpe
+
+import (
+	"testing"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_receiver_groups_expression_with_note(t *testing.T) {
+	// given
+	r := NewReceiver(Layout{Lower: LowerZone(15)})
+	// when
+	r.Handle(midi.PitchBend{Channel: 2, Value: -100})
+	r.Handle(midi.ControlChange{Channel: 2, Controller: 74, Value: 30})
+	on := r.Handle(midi.NoteOn{Channel: 2, Key: 60, Velocity: 90})
+	pressure := r.Handle(midi.ChannelPressure{Channel: 2, Pressure: 50})
+	manager := r.Handle(midi.ChannelPressure{Channel: 0, Pressure: 10})
+	off := r.Handle(midi.NoteOff{Channel: 2, Key: 60, Velocity: 20})
+	// then
+	assert.Equal(t, []Note{{Channel: 2, Key: 60, Velocity: 90, PitchBend: -100, Timbre: 30, Playing: true}}, on)
+	assert.Equal(t, uint8(50), pressure[0].Pressure)
+	assert.Equal(t, []Note{{Channel: 2, Key: 60, Velocity: 90, PitchBend: -100, Pressure: 50, Timbre: 30, Playing: true, ZonePressure: 10}}, manager)
+	assert.Equal(t, []Note{{Channel: 2, Key: 60, Velocity: 90, PitchBend: -100, Pressure: 50, Timbre: 30, ReleaseVelocity: 20, ZonePressure: 10}}, off)
+	assert.Empty(t, r.Notes())
+}
+
+func Test_receiver_applies_manager_channel_to_zone(t *testing.T) {
+	// given
+	r := NewReceiver(Layout{Lower: LowerZone(7), Upper: UpperZone(7)})
+	r.Handle(midi.PitchBend{Channel: 0, Value: 200})
+	r.Handle(midi.NoteOn{Channel: 1, Key: 60, Velocity: 90})
+	r.Handle(midi.NoteOn{Channel: 2, Key: 64, Velocity: 90})
+	r.Handle(midi.NoteOn{Channel: 14, Key: 67, Velocity: 90})
+	// when
+	bend := r.Handle(midi.PitchBend{Channel: 0, Value: -300})
+	pressure := r.Handle(midi.ChannelPressure{Channel: 15, Pressure: 40})
+	// then
+	assert.Equal(t, []Note{
+		{Channel: 1, Key: 60, Velocity: 90, Timbre: 64, Playing: true, ZonePitchBend: -300},
+		{Channel: 2, Key: 64, Velocity: 90, Timbre: 64, Playing: true, ZonePitchBend: -300},
+	}, bend)
+	assert.Equal(t, []Note{
+		{Channel: 14, Key: 67, Velocity: 90, Timbre: 64, Playing: true, ZonePressure: 40},
+	}, pressure)
+}
+
+func Test_receiver_applies_configuration_message(t *testing.T) {
+	// given
+	r := NewReceiver(Layout{})
+	notes := []Note{}
+	r.OnNote = func(n Note) { notes = append(notes, n) }
+	commands := append(UpperZone(3).ConfigurationCommands(),
+		rtp.MIDICommand{Payload: rtp.MIDIPayload{0x9d, 60, 100}},
+		rtp.MIDICommand{Payload: rtp.MIDIPayload{0x9a, 62, 100}},
+	)
+	// when
+	r.HandleMIDI(rtp.MIDIMessage{Commands: rtp.MIDICommands{Commands: commands}}, nil)
+	// then
+	assert.Equal(t, Layout{Upper: UpperZone(3)}, r.Layout())
+	assert.Equal(t, []Note{{Channel: 13, Key: 60, Velocity: 100, Timbre: 64, Playing: true}}, notes)
+}
@@ -0,0 +1,164 @@
+// Package mpe supports MIDI Polyphonic Expression, where each note is played on its own
+// member channel of a zone to control its pitch bend, pressure and timbre individually.
+package mpe
+
+import (
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+)
+
+// configurationRPN is the registered parameter of the MPE Configuration Message
+const configurationRPN = 6
+
+// timbreController is the controller used for the per note timbre (CC74)
+const timbreController = 74
+
+const (
+	lowerManager = 0
+	upperManager = 15
+	// maxMembers is the number of member channels of a zone using all channels
+	maxMembers = 15
+)
+
+// Zone is a group of member channels controlled by a manager channel.
+// The lower zone is managed on channel 0 (MIDI channel 1) with members counting up,
+// the upper zone is managed on channel 15 (MIDI channel 16) with members counting down.
+type Zone struct {
+	Upper bool
+	// Members is the number of member channels, 0 disables the zone.
+	Members int
+}
+
+// LowerZone returns the lower zone with the given number of member channels.
+func LowerZone(members int) Zone {
+	return Zone{Members: members}
+}
+
+// UpperZone returns the upper zone with the given number of member channels.
+func UpperZone(members int) Zone {
+	return Zone{Upper: true, Members: members}
+}
+
+// Enabled returns true if the zone has member channels.
+func (z Zone) Enabled() bool {
+	return z.Members > 0
+}
+
+// ManagerChannel returns the channel (0-15) of the zone wide messages.
+func (z Zone) ManagerChannel() uint8 {
+	if z.Upper {
+		return upperManager
+	}
+	return lowerManager
+}
+
+// Member returns the channel of the member with the given index, starting next to the manager channel.
+func (z Zone) Member(i int) uint8 {
+	if z.Upper {
+		return uint8(upperManager - 1 - i)
+	}
+	return uint8(lowerManager + 1 + i)
+}
+
+// MemberIndex returns the index of the member channel, or false if the channel is no member.
+func (z Zone) MemberIndex(channel uint8) (int, bool) {
+	i := int(channel) - lowerManager - 1
+	if z.Upper {
+		i = upperManager - 1 - int(channel)
+	}
+	return i, i >= 0 && i < z.Members
+}
+
+// Contains returns true if the channel is the manager or a member channel of an enabled zone.
+func (z Zone) Contains(channel uint8) bool {
+	_, member := z.MemberIndex(channel)
+	return z.Enabled() && (member || channel == z.ManagerChannel())
+}
+
+// ConfigurationMessage returns the MPE Configuration Message which sets up the zone.
+// It is sent with ConfigurationCommands.
+func (z Zone) ConfigurationMessage() midi.ParameterChange {
+	return midi.ParameterChange{
+		Channel:   z.ManagerChannel(),
+		Kind:      midi.RPN,
+		Parameter: configurationRPN,
+		Value:     uint16(z.Members) << 7,
+	}
+}
+
+// ConfigurationCommands returns the control changes of the MPE Configuration Message, one
+// command per control change.
+func (z Zone) ConfigurationCommands() []rtp.MIDICommand {
+	return rtp.Commands(z.ConfigurationMessage())
+}
+
+// Layout is the configuration of the lower and upper zone.
+type Layout struct {
+	Lower Zone
+	Upper Zone
+}
+
+// Zone returns the zone containing the channel, or false if the channel is not part of a zone.
+func (l Layout) Zone(channel uint8) (Zone, bool) {
+	switch {
+	case l.Lower.Contains(channel):
+		return l.Lower, true
+	case l.Upper.Contains(channel):
+		return l.Upper, true
+	}
+	return Zone{}, false
+}
+
+// Apply updates the layout with the MPE Configuration Message.
+// A zone which is configured shrinks the other zone to the remaining channels.
+// Returns false if the parameter change is no MPE Configuration Message.
+func (l *Layout) Apply(p midi.ParameterChange) bool {
+	if p.Kind != midi.RPN || p.Parameter != configurationRPN || p.Op != midi.SetValue {
+		return false
+	}
+	members := int(p.Value >> 7)
+	if members > maxMembers {
+		members = maxMembers
+	}
+	switch p.Channel {
+	case lowerManager:
+		l.Lower.Members = members
+		l.Upper.Members = shrink(l.Upper.Members, members)
+	case upperManager:
+		l.Upper.Members = members
+		l.Lower.Members = shrink(l.Lower.Members, members)
+	default:
+		return false
+	}
+	// the zero Layout has to be marked as upper zone
+	l.Upper.Upper = true
+	return true
+}
+
+// shrink returns the number of members left next to a zone with the given members.
+func shrink(members, other int) int {
+	if other == 0 {
+		return members
+	}
+	if left := maxMembers - 1 - other; members > left {
+		if left < 0 {
+			return 0
+		}
+		return left
+	}
+	return members
+}
+
+// Translate moves the channel message from a zone to the corresponding channel of another zone.
+// Member channels are mapped by their index, wrapping around if the other zone has less members.
+// Returns false if the message is not part of the zone.
+func Translate(m midi.ChannelMessage, from, to Zone) (midi.ChannelMessage, bool) {
+	if !to.Enabled() || !from.Contains(m.GetChannel()) {
+		return nil, false
+	}
+	if m.GetChannel() == from.ManagerChannel() {
+		return midi.WithChannel(m, to.ManagerChannel()), true
+	}
+	i, _ := from.MemberIndex(m.GetChannel())
+	return midi.WithChannel(m, to.Member(i%to.Members)), true
+}
@@ -0,0 +1,74 @@
+package mpe
+
+import (
+	"testing"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_zone_channels(t *testing.T) {
+	// given
+	lower, upper := LowerZone(7), UpperZone(3)
+	// then
+	assert.Equal(t, uint8(1), lower.Member(0))
+	assert.Equal(t, uint8(14), upper.Member(0))
+	assert.Equal(t, uint8(12), upper.Member(2))
+	assert.True(t, lower.Contains(0))
+	assert.True(t, lower.Contains(7))
+	assert.False(t, lower.Contains(8))
+	assert.True(t, upper.Contains(12))
+	assert.False(t, upper.Contains(11))
+	assert.False(t, LowerZone(0).Contains(0))
+}
+
+func Test_configuration_message(t *testing.T) {
+	// given
+	zone := UpperZone(5)
+	// when
+	b := zone.ConfigurationMessage().Append(nil)
+	// then
+	assert.Equal(t, []byte{0xbf, 101, 0, 0xbf, 100, 6, 0xbf, 6, 5, 0xbf, 38, 0}, b)
+}
+
+func Test_configuration_commands(t *testing.T) {
+	// given
+	zone := LowerZone(7)
+	// when
+	commands := zone.ConfigurationCommands()
+	// then
+	assert.Equal(t, []rtp.MIDICommand{
+		{Payload: rtp.MIDIPayload{0xb0, 101, 0}},
+		{Payload: rtp.MIDIPayload{0xb0, 100, 6}},
+		{Payload: rtp.MIDIPayload{0xb0, 6, 7}},
+		{Payload: rtp.MIDIPayload{0xb0, 38, 0}},
+	}, commands)
+}
+
+func Test_layout_apply_shrinks_other_zone(t *testing.T) {
+	// given
+	l := Layout{}
+	// when
+	l.Apply(LowerZone(15).ConfigurationMessage())
+	all := l
+	l.Apply(UpperZone(4).ConfigurationMessage())
+	// then
+	assert.Equal(t, Layout{Lower: LowerZone(15), Upper: UpperZone(0)}, all)
+	assert.Equal(t, Layout{Lower: LowerZone(10), Upper: UpperZone(4)}, l)
+	assert.False(t, l.Apply(midi.ParameterChange{Channel: 3, Parameter: configurationRPN}))
+}
+
+func Test_translate_between_zones(t *testing.T) {
+	// given
+	from, to := LowerZone(6), UpperZone(4)
+	// when
+	note, ok := Translate(midi.NoteOn{Channel: 5, Key: 60, Velocity: 100}, from, to)
+	manager, _ := Translate(midi.PitchBend{Channel: 0, Value: 100}, from, to)
+	_, outside := Translate(midi.NoteOn{Channel: 9}, from, to)
+	// then
+	assert.True(t, ok)
+	assert.Equal(t, midi.NoteOn{Channel: 14, Key: 60, Velocity: 100}, note)
+	assert.Equal(t, midi.PitchBend{Channel: 15, Value: 100}, manager)
+	assert.False(t, outside)
+}
@@ -0,0 +1,160 @@
+package mtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+)
+
+// Direction is the direction in which the received timecode moves.
+type Direction int8
+
+const (
+	// Reverse timecode decreases.
+	Reverse Direction = -1
+	// Unknown direction before consecutive quarter frames were received.
+	Unknown Direction = 0
+	// Forward timecode increases.
+	Forward Direction = 1
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Forward:
+		return "forward"
+	case Reverse:
+		return "reverse"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultTimeout is the default time without quarter frames after which the lock is lost.
+const DefaultTimeout = 100 * time.Millisecond
+
+// Decoder reassembles received quarter frames and full frame messages into timecode positions.
+//
+// The Decoder is locked after a complete sequence of eight consecutive quarter frames was
+// received, until a quarter frame is missing or no quarter frame is received for Timeout.
+//
+// The Decoder is used as handler of a session:
+//
+//	d := mtc.NewDecoder()
+//	s.Handle(d.HandleMIDI)
+type Decoder struct {
+	// Timeout is the time without quarter frames after which the lock is lost.
+	Timeout time.Duration
+
+	mutex       sync.Mutex
+	pieces      [8]uint8
+	lastPiece   int
+	consecutive int
+	direction   Direction
+	quarters    int
+	position    Timecode
+	valid       bool
+	last        time.Time
+}
+
+// NewDecoder creates a Decoder with the default timeout.
+func NewDecoder() *Decoder {
+	return &Decoder{Timeout: DefaultTimeout, lastPiece: -1}
+}
+
+// HandleMIDI decodes the time code commands of the received message.
+func (d *Decoder) HandleMIDI(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
+	d.HandleCommands(msg.Commands)
+}
+
+// HandleCommands decodes the time code commands at the time given by their delta times.
+func (d *Decoder) HandleCommands(mcs rtp.MIDICommands) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	t := mcs.Timestamp
+	for _, mc := range mcs.Commands {
+		t = t.Add(mc.DeltaTime)
+		msg, err := mc.Payload.Message()
+		if err != nil {
+			continue
+		}
+		switch m := msg.(type) {
+		case midi.QuarterFrame:
+			d.quarterFrame(m, t)
+		case midi.SysEx:
+			if tc, ok := ParseFullFrame(m); ok {
+				d.position, d.valid = tc, true
+				d.lastPiece, d.consecutive, d.direction = -1, 0, Unknown
+			}
+		}
+	}
+}
+
+func (d *Decoder) quarterFrame(m midi.QuarterFrame, t time.Time) {
+	piece := int(m.Type)
+	direction := Unknown
+	if d.lastPiece >= 0 && t.Sub(d.last) <= d.Timeout {
+		switch piece {
+		case (d.lastPiece + 1) % 8:
+			direction = Forward
+		case (d.lastPiece + 7) % 8:
+			direction = Reverse
+		}
+	}
+	switch {
+	case direction == Unknown:
+		d.consecutive = 0
+		d.quarters = 0
+	case d.direction != Unknown && direction != d.direction:
+		// the previous piece starts the sequence in the new direction
+		d.consecutive = 1
+		d.quarters = 0
+	}
+	d.direction = direction
+	d.lastPiece = piece
+	d.last = t
+	d.pieces[piece] = m.Value
+	d.consecutive++
+
+	// a sequence is complete with the last piece in the direction of the timecode
+	if d.consecutive >= 8 && (direction == Forward && piece == 7 || direction == Reverse && piece == 0) {
+		tc := fromPieces(d.pieces)
+		if direction == Forward {
+			// the sequence took two frames to transmit
+			tc = tc.Add(2)
+		}
+		d.position, d.valid = tc, true
+		d.quarters = 0
+		return
+	}
+	if d.consecutive > 8 {
+		d.quarters++
+		if d.quarters%4 == 0 {
+			d.position = d.position.Add(int(direction))
+		}
+	}
+}
+
+// Position returns the last decoded timecode, false if no timecode was received yet.
+func (d *Decoder) Position() (Timecode, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.position, d.valid
+}
+
+// Direction returns the direction of the received quarter frames.
+func (d *Decoder) Direction() Direction {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.direction
+}
+
+// Locked returns true if the Decoder follows a running timecode at the given time.
+func (d *Decoder) Locked(now time.Time) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.consecutive >= 8 && d.direction != Unknown && now.Sub(d.last) <= d.Timeout
+}
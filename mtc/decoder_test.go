@@ -0,0 +1,97 @@
+package mtc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+type decodingSender struct {
+	mutex   sync.Mutex
+	decoder *Decoder
+}
+
+func (s *decodingSender) SendMIDICommands(mcs rtp.MIDICommands) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.decoder.HandleCommands(mcs)
+}
+
+func quarterFrames(start time.Time, tc Timecode, order []int) rtp.MIDICommands {
+	qf := tc.QuarterFrames()
+	mcs := rtp.MIDICommands{Timestamp: start}
+	quarter := tc.Rate.FrameDuration() / 4
+	for i, piece := range order {
+		d := quarter
+		if i == 0 {
+			d = 0
+		}
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{DeltaTime: d, Payload: midi.Encode(qf[piece])})
+	}
+	return mcs
+}
+
+func Test_decode_forward_quarter_frames(t *testing.T) {
+	// given
+	d := NewDecoder()
+	tc := Timecode{Minutes: 1, Seconds: 2, Frames: 10, Rate: Rate25}
+	start := time.Now()
+	mcs := quarterFrames(start, tc, []int{0, 1, 2, 3, 4, 5, 6})
+	// when
+	d.HandleCommands(mcs)
+	_, valid := d.Position()
+	d.HandleCommands(quarterFrames(start.Add(7*10*time.Millisecond), tc, []int{7}))
+	// then
+	assert.False(t, valid)
+	position, valid := d.Position()
+	assert.True(t, valid)
+	assert.Equal(t, tc.Add(2), position)
+	assert.Equal(t, Forward, d.Direction())
+	assert.True(t, d.Locked(start.Add(80*time.Millisecond)))
+	assert.False(t, d.Locked(start.Add(time.Second)))
+}
+
+func Test_decode_reverse_quarter_frames(t *testing.T) {
+	// given
+	d := NewDecoder()
+	tc := Timecode{Hours: 2, Frames: 20, Rate: Rate24}
+	start := time.Now()
+	// when
+	d.HandleCommands(quarterFrames(start, tc, []int{7, 6, 5, 4, 3, 2, 1, 0}))
+	// then
+	position, _ := d.Position()
+	assert.Equal(t, tc, position)
+	assert.Equal(t, Reverse, d.Direction())
+}
+
+func Test_decode_loses_lock_on_missing_quarter_frame(t *testing.T) {
+	// given
+	d := NewDecoder()
+	tc := Timecode{Rate: Rate30}
+	start := time.Now()
+	d.HandleCommands(quarterFrames(start, tc, []int{0, 1, 2, 3, 4, 5, 6, 7}))
+	// when
+	d.HandleCommands(quarterFrames(start.Add(30*time.Millisecond), tc, []int{1}))
+	// then
+	assert.False(t, d.Locked(start.Add(30*time.Millisecond)))
+	assert.Equal(t, Unknown, d.Direction())
+}
+
+func Test_decode_full_frame(t *testing.T) {
+	// given
+	d := NewDecoder()
+	tc := Timecode{Hours: 10, Rate: Rate30}
+	// when
+	d.HandleCommands(rtp.MIDICommands{Timestamp: time.Now(), Commands: []rtp.MIDICommand{
+		{Payload: midi.Encode(tc.FullFrame())},
+	}})
+	// then
+	position, valid := d.Position()
+	assert.True(t, valid)
+	assert.Equal(t, tc, position)
+	assert.False(t, d.Locked(time.Now()))
+}
@@ -0,0 +1,226 @@
+package mtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+)
+
+// Sender sends MIDI commands, e.g. a MIDINetworkSession.
+type Sender interface {
+	SendMIDICommands(rtp.MIDICommands)
+}
+
+// Source is a playback position chased by a Generator, e.g. a player.Player.
+type Source interface {
+	// Position returns the current playback position.
+	Position() time.Duration
+	// Speed returns the playback speed, 1 is the normal speed and 0 is stopped.
+	Speed() float64
+}
+
+// chaseTolerance is the number of frames the Generator may differ from its Source before
+// it locates to the position of the Source.
+const chaseTolerance = 2
+
+// Generator sends MIDI Time Code.
+//
+// While running, four quarter frame messages are sent per frame. Each sequence of eight
+// quarter frames spans two frames and describes the timecode of its first frame.
+// The time of each quarter frame is derived from the start time, so the timecode does not drift.
+//
+// The Generator runs from its internal clock, or chases a Source to follow its playback.
+type Generator struct {
+	out  Sender
+	rate Rate
+
+	mutex    sync.Mutex
+	position Timecode
+	started  time.Time
+	speed    float64
+	running  bool
+	stop     chan struct{}
+	stopped  chan struct{}
+
+	chaseMutex   sync.Mutex
+	chaseStop    chan struct{}
+	chaseStopped chan struct{}
+}
+
+// NewGenerator creates a stopped Generator at 00:00:00:00.
+func NewGenerator(out Sender, rate Rate) *Generator {
+	return &Generator{out: out, rate: rate, position: Timecode{Rate: rate}}
+}
+
+// Position returns the current timecode.
+func (g *Generator) Position() Timecode {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.current()
+}
+
+// Running returns true while quarter frames are sent.
+func (g *Generator) Running() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.running
+}
+
+// Locate moves to the timecode and sends a full frame message.
+// A running Generator continues at the new position.
+func (g *Generator) Locate(tc Timecode) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	running := g.running
+	if running {
+		g.halt()
+	}
+	g.locate(tc)
+	if running {
+		g.start(g.speed)
+	}
+}
+
+// Start starts sending quarter frames at the current position.
+func (g *Generator) Start() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !g.running {
+		g.start(1)
+	}
+}
+
+// Chase follows the position and speed of the source instead of the internal clock.
+//
+// The source is polled once per frame. The Generator starts and stops with the source and
+// locates to its position when they differ by more than two frames, e.g. after a seek.
+// Speeds below or equal to 0 stop the Generator. Chase(nil) stops chasing, a running
+// Generator continues from its internal clock.
+func (g *Generator) Chase(src Source) {
+	g.chaseMutex.Lock()
+	defer g.chaseMutex.Unlock()
+	if g.chaseStop != nil {
+		close(g.chaseStop)
+		<-g.chaseStopped
+		g.chaseStop, g.chaseStopped = nil, nil
+	}
+	if src != nil {
+		g.chaseStop, g.chaseStopped = make(chan struct{}), make(chan struct{})
+		go g.chase(src, g.chaseStop, g.chaseStopped)
+	}
+}
+
+// Stop stops sending quarter frames and keeps the current position.
+func (g *Generator) Stop() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.running {
+		g.halt()
+	}
+}
+
+func (g *Generator) current() Timecode {
+	if !g.running {
+		return g.position
+	}
+	elapsed := float64(time.Since(g.started)) * g.speed
+	return g.position.Add(int(elapsed / float64(g.rate.FrameDuration())))
+}
+
+// locate moves the stopped Generator to the timecode and sends a full frame message.
+func (g *Generator) locate(tc Timecode) {
+	g.position = FromFrame(tc.Frame(), g.rate)
+	g.out.SendMIDICommands(rtp.MIDICommands{
+		Timestamp: time.Now(),
+		Commands:  []rtp.MIDICommand{{Payload: midi.Encode(g.position.FullFrame())}},
+	})
+}
+
+func (g *Generator) start(speed float64) {
+	g.running = true
+	g.speed = speed
+	g.started = time.Now()
+	g.stop = make(chan struct{})
+	g.stopped = make(chan struct{})
+	go g.run(g.position, g.started, speed, g.stop, g.stopped)
+}
+
+// halt stops the goroutine sending the quarter frames.
+func (g *Generator) halt() {
+	g.position = g.current()
+	g.running = false
+	close(g.stop)
+	g.mutex.Unlock()
+	<-g.stopped
+	g.mutex.Lock()
+}
+
+func (g *Generator) run(from Timecode, started time.Time, speed float64, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	quarter := time.Duration(float64(g.rate.FrameDuration()) / 4 / speed)
+	var pieces [8]midi.QuarterFrame
+	for n := 0; ; n++ {
+		if n%8 == 0 {
+			pieces = from.Add(n / 4).QuarterFrames()
+		}
+		due := started.Add(time.Duration(n) * quarter)
+		timer.Reset(time.Until(due))
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		g.out.SendMIDICommands(rtp.MIDICommands{
+			Timestamp: due,
+			Commands:  []rtp.MIDICommand{{Payload: midi.Encode(pieces[n%8])}},
+		})
+	}
+}
+
+// chase follows the source until stop is closed.
+func (g *Generator) chase(src Source, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(g.rate.FrameDuration())
+	defer ticker.Stop()
+	for {
+		g.follow(src.Position(), src.Speed())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// follow starts, stops or locates the Generator to match the position and speed of the source.
+func (g *Generator) follow(position time.Duration, speed float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	tc := FromDuration(position, g.rate)
+	if speed <= 0 {
+		if g.running {
+			g.halt()
+		}
+		if g.position.Frame() != tc.Frame() {
+			g.locate(tc)
+		}
+		return
+	}
+	if g.running && g.speed == speed {
+		drift := g.current().Frame() - tc.Frame()
+		if drift >= -chaseTolerance && drift <= chaseTolerance {
+			return
+		}
+	}
+	if g.running {
+		g.halt()
+	}
+	g.locate(tc)
+	g.start(speed)
+}
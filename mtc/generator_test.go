@@ -0,0 +1,106 @@
+package mtc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_generator_is_followed_by_decoder(t *testing.T) {
+	// given
+	d := NewDecoder()
+	g := NewGenerator(&decodingSender{decoder: d}, Rate30)
+	g.Locate(Timecode{Hours: 1, Rate: Rate30})
+	// when
+	g.Start()
+	time.Sleep(200 * time.Millisecond)
+	expected := g.Position()
+	g.Stop()
+	// then
+	position, valid := d.Position()
+	assert.True(t, valid)
+	assert.Equal(t, Forward, d.Direction())
+	assert.InDelta(t, expected.Frame(), position.Frame(), 2)
+	assert.True(t, position.Frame() > (Timecode{Hours: 1, Rate: Rate30}).Frame())
+}
+
+type testSource struct {
+	mutex    sync.Mutex
+	position time.Duration
+	started  time.Time
+	speed    float64
+}
+
+func (s *testSource) Position() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.speed == 0 {
+		return s.position
+	}
+	return s.position + time.Duration(float64(time.Since(s.started))*s.speed)
+}
+
+func (s *testSource) Speed() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.speed
+}
+
+func (s *testSource) play(position time.Duration, speed float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.position, s.started, s.speed = position, time.Now(), speed
+}
+
+func Test_generator_chases_source(t *testing.T) {
+	// given
+	d := NewDecoder()
+	g := NewGenerator(&decodingSender{decoder: d}, Rate30)
+	src := &testSource{}
+	src.play(time.Hour, 1)
+	// when
+	g.Chase(src)
+	defer g.Chase(nil)
+	time.Sleep(200 * time.Millisecond)
+	// then
+	assert.True(t, g.Running())
+	position, valid := d.Position()
+	assert.True(t, valid)
+	assert.InDelta(t, FromDuration(src.Position(), Rate30).Frame(), position.Frame(), 3)
+}
+
+func Test_generator_follows_seek_and_stop_of_source(t *testing.T) {
+	// given
+	d := NewDecoder()
+	g := NewGenerator(&decodingSender{decoder: d}, Rate30)
+	src := &testSource{}
+	src.play(time.Hour, 1)
+	g.Chase(src)
+	defer g.Chase(nil)
+	time.Sleep(100 * time.Millisecond)
+	// when
+	src.play(2*time.Hour, 0)
+	time.Sleep(100 * time.Millisecond)
+	// then
+	assert.False(t, g.Running())
+	assert.Equal(t, FromDuration(2*time.Hour, Rate30), g.Position())
+	position, valid := d.Position()
+	assert.True(t, valid)
+	assert.Equal(t, FromDuration(2*time.Hour, Rate30), position)
+}
+
+func Test_generator_chases_source_at_double_speed(t *testing.T) {
+	// given
+	g := NewGenerator(&decodingSender{decoder: NewDecoder()}, Rate30)
+	src := &testSource{}
+	src.play(0, 2)
+	// when
+	g.Chase(src)
+	time.Sleep(300 * time.Millisecond)
+	g.Chase(nil)
+	// then
+	assert.InDelta(t, FromDuration(src.Position(), Rate30).Frame(), g.Position().Frame(), 3)
+	g.Stop()
+}
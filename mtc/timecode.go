@@ -0,0 +1,199 @@
+// Package mtc generates and decodes MIDI Time Code (MTC).
+package mtc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+)
+
+// Rate is the SMPTE frame rate with the code used in MTC messages.
+type Rate uint8
+
+const (
+	// Rate24 has 24 frames per second.
+	Rate24 Rate = iota
+	// Rate25 has 25 frames per second.
+	Rate25
+	// Rate2997DF has 29.97 frames per second with drop frame numbering.
+	Rate2997DF
+	// Rate30 has 30 frames per second.
+	Rate30
+)
+
+// drop frame numbering skips the frames 0 and 1 of each minute except every tenth minute
+const (
+	droppedFrames      = 2
+	dropFramesPerMin   = 60*30 - droppedFrames
+	dropFramesPer10Min = 10*dropFramesPerMin + droppedFrames
+)
+
+// Nominal returns the number of frames counted per second.
+func (r Rate) Nominal() int {
+	switch r {
+	case Rate24:
+		return 24
+	case Rate25:
+		return 25
+	default:
+		return 30
+	}
+}
+
+// DropFrame returns true if the rate uses drop frame numbering.
+func (r Rate) DropFrame() bool {
+	return r == Rate2997DF
+}
+
+// FrameDuration returns the duration of a frame.
+func (r Rate) FrameDuration() time.Duration {
+	if r.DropFrame() {
+		return 1001 * time.Second / 30000
+	}
+	return time.Second / time.Duration(r.Nominal())
+}
+
+func (r Rate) String() string {
+	switch r {
+	case Rate24:
+		return "24"
+	case Rate25:
+		return "25"
+	case Rate2997DF:
+		return "29.97df"
+	default:
+		return "30"
+	}
+}
+
+// Timecode is a SMPTE position.
+type Timecode struct {
+	Hours   uint8
+	Minutes uint8
+	Seconds uint8
+	Frames  uint8
+	Rate    Rate
+}
+
+// FromFrame returns the timecode of the frame counted from 00:00:00:00.
+// The frame number wraps around after 24 hours.
+func FromFrame(frame int, rate Rate) Timecode {
+	perDay := framesPerDay(rate)
+	frame %= perDay
+	if frame < 0 {
+		frame += perDay
+	}
+	if rate.DropFrame() {
+		tens, rest := frame/dropFramesPer10Min, frame%dropFramesPer10Min
+		frame += 9 * droppedFrames * tens
+		if rest >= droppedFrames {
+			frame += droppedFrames * ((rest - droppedFrames) / dropFramesPerMin)
+		}
+	}
+	fps := rate.Nominal()
+	return Timecode{
+		Hours:   uint8(frame / (3600 * fps)),
+		Minutes: uint8(frame / (60 * fps) % 60),
+		Seconds: uint8(frame / fps % 60),
+		Frames:  uint8(frame % fps),
+		Rate:    rate,
+	}
+}
+
+// FromDuration returns the timecode of the frame at the given time from 00:00:00:00.
+func FromDuration(d time.Duration, rate Rate) Timecode {
+	return FromFrame(int(d/rate.FrameDuration()), rate)
+}
+
+// Frame returns the number of the frame counted from 00:00:00:00.
+func (tc Timecode) Frame() int {
+	fps := tc.Rate.Nominal()
+	frame := ((int(tc.Hours)*60+int(tc.Minutes))*60+int(tc.Seconds))*fps + int(tc.Frames)
+	if tc.Rate.DropFrame() {
+		minutes := int(tc.Hours)*60 + int(tc.Minutes)
+		frame -= droppedFrames * (minutes - minutes/10)
+	}
+	return frame
+}
+
+// Duration returns the time from 00:00:00:00 to the frame.
+func (tc Timecode) Duration() time.Duration {
+	return time.Duration(tc.Frame()) * tc.Rate.FrameDuration()
+}
+
+// Add returns the timecode the given number of frames later.
+func (tc Timecode) Add(frames int) Timecode {
+	return FromFrame(tc.Frame()+frames, tc.Rate)
+}
+
+func (tc Timecode) String() string {
+	separator := ":"
+	if tc.Rate.DropFrame() {
+		separator = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", tc.Hours, tc.Minutes, tc.Seconds, separator, tc.Frames)
+}
+
+func framesPerDay(rate Rate) int {
+	if rate.DropFrame() {
+		return 24 * 6 * dropFramesPer10Min
+	}
+	return 24 * 3600 * rate.Nominal()
+}
+
+// QuarterFrames returns the eight quarter frame messages describing the timecode.
+func (tc Timecode) QuarterFrames() [8]midi.QuarterFrame {
+	return [8]midi.QuarterFrame{
+		{Type: 0, Value: tc.Frames & 0x0f},
+		{Type: 1, Value: tc.Frames >> 4 & 0x01},
+		{Type: 2, Value: tc.Seconds & 0x0f},
+		{Type: 3, Value: tc.Seconds >> 4 & 0x03},
+		{Type: 4, Value: tc.Minutes & 0x0f},
+		{Type: 5, Value: tc.Minutes >> 4 & 0x03},
+		{Type: 6, Value: tc.Hours & 0x0f},
+		{Type: 7, Value: tc.Hours>>4&0x01 | uint8(tc.Rate)<<1},
+	}
+}
+
+// fromPieces returns the timecode of the values of the eight quarter frame messages.
+func fromPieces(pieces [8]uint8) Timecode {
+	return Timecode{
+		Frames:  pieces[0] | (pieces[1]&0x01)<<4,
+		Seconds: pieces[2] | (pieces[3]&0x03)<<4,
+		Minutes: pieces[4] | (pieces[5]&0x03)<<4,
+		Hours:   pieces[6] | (pieces[7]&0x01)<<4,
+		Rate:    Rate(pieces[7] >> 1 & 0x03),
+	}
+}
+
+// full frame messages are universal real time SysEx messages
+const (
+	universalRealtime = 0x7f
+	allDevices        = 0x7f
+	subIDTimecode     = 0x01
+	subIDFullFrame    = 0x01
+)
+
+// FullFrame returns the full frame SysEx message which locates receivers at the timecode.
+func (tc Timecode) FullFrame() midi.SysEx {
+	return midi.SysEx{Data: []byte{
+		universalRealtime, allDevices, subIDTimecode, subIDFullFrame,
+		uint8(tc.Rate)<<5 | tc.Hours&0x1f, tc.Minutes, tc.Seconds, tc.Frames,
+	}}
+}
+
+// ParseFullFrame returns the timecode of a full frame SysEx message.
+func ParseFullFrame(m midi.SysEx) (Timecode, bool) {
+	d := m.Data
+	if len(d) != 8 || d[0] != universalRealtime || d[2] != subIDTimecode || d[3] != subIDFullFrame {
+		return Timecode{}, false
+	}
+	return Timecode{
+		Hours:   d[4] & 0x1f,
+		Minutes: d[5],
+		Seconds: d[6],
+		Frames:  d[7],
+		Rate:    Rate(d[4] >> 5 & 0x03),
+	}, true
+}
@@ -0,0 +1,70 @@
+package mtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_drop_frame_numbering(t *testing.T) {
+	// given
+	minute := Timecode{Minutes: 1, Frames: 2, Rate: Rate2997DF}
+	tenth := Timecode{Minutes: 10, Rate: Rate2997DF}
+	// when
+	before := minute.Add(-1)
+	// then
+	assert.Equal(t, 1800, minute.Frame())
+	assert.Equal(t, Timecode{Seconds: 59, Frames: 29, Rate: Rate2997DF}, before)
+	assert.Equal(t, 17982, tenth.Frame())
+	assert.Equal(t, Timecode{Minutes: 9, Seconds: 59, Frames: 29, Rate: Rate2997DF}, tenth.Add(-1))
+	assert.Equal(t, Timecode{Minutes: 11, Frames: 2, Rate: Rate2997DF}, FromFrame(17982+1800, Rate2997DF))
+	assert.Equal(t, "00:01:00;02", minute.String())
+}
+
+func Test_frame_round_trip(t *testing.T) {
+	for _, rate := range []Rate{Rate24, Rate25, Rate2997DF, Rate30} {
+		for frame := 0; frame < framesPerDay(rate); frame += 997 {
+			assert.Equal(t, frame, FromFrame(frame, rate).Frame(), "rate %v", rate)
+		}
+	}
+}
+
+func Test_timecode_from_duration(t *testing.T) {
+	// given
+	d := time.Hour + 2*time.Minute + 3*time.Second + 400*time.Millisecond
+	// when
+	tc := FromDuration(d, Rate25)
+	// then
+	assert.Equal(t, Timecode{Hours: 1, Minutes: 2, Seconds: 3, Frames: 10, Rate: Rate25}, tc)
+	assert.Equal(t, d, tc.Duration())
+	assert.Equal(t, Timecode{Hours: 23, Minutes: 59, Seconds: 59, Frames: 24, Rate: Rate25}, Timecode{Rate: Rate25}.Add(-1))
+}
+
+func Test_quarter_frames(t *testing.T) {
+	// given
+	tc := Timecode{Hours: 17, Minutes: 42, Seconds: 35, Frames: 21, Rate: Rate30}
+	// when
+	qf := tc.QuarterFrames()
+	var pieces [8]uint8
+	for i, m := range qf {
+		pieces[i] = m.Value
+	}
+	// then
+	assert.Equal(t, []byte{0xf1, 0x77}, midi.Encode(qf[7]))
+	assert.Equal(t, tc, fromPieces(pieces))
+}
+
+func Test_full_frame(t *testing.T) {
+	// given
+	tc := Timecode{Hours: 1, Minutes: 2, Seconds: 3, Frames: 4, Rate: Rate2997DF}
+	// when
+	b := midi.Encode(tc.FullFrame())
+	m, _ := midi.Parse(b)
+	parsed, ok := ParseFullFrame(m.(midi.SysEx))
+	// then
+	assert.Equal(t, []byte{0xf0, 0x7f, 0x7f, 0x01, 0x01, 0x41, 0x02, 0x03, 0x04, 0xf7}, b)
+	assert.True(t, ok)
+	assert.Equal(t, tc, parsed)
+}
@@ -0,0 +1,189 @@
+// Package netmidi2 implements the Network MIDI 2.0 (UDP) transport of Universal MIDI Packets.
+package netmidi2
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// signature starts each Network MIDI 2.0 UDP packet
+const signature = 0x4d494449 // "MIDI"
+
+// CommandCode identifies a command packet.
+type CommandCode uint8
+
+// Command codes of the Network MIDI 2.0 protocol
+const (
+	Invitation                 CommandCode = 0x01
+	InvitationWithAuth         CommandCode = 0x02
+	InvitationWithUserAuth     CommandCode = 0x03
+	InvitationAccepted         CommandCode = 0x10
+	InvitationPending          CommandCode = 0x11
+	InvitationAuthRequired     CommandCode = 0x12
+	InvitationUserAuthRequired CommandCode = 0x13
+	Ping                       CommandCode = 0x20
+	PingReply                  CommandCode = 0x21
+	RetransmitRequest          CommandCode = 0x80
+	RetransmitError            CommandCode = 0x81
+	SessionReset               CommandCode = 0x82
+	SessionResetReply          CommandCode = 0x83
+	NAK                        CommandCode = 0x8f
+	Bye                        CommandCode = 0xf0
+	ByeReply                   CommandCode = 0xf1
+	UMPData                    CommandCode = 0xff
+)
+
+func (c CommandCode) String() string {
+	switch c {
+	case Invitation:
+		return "Invitation"
+	case InvitationWithAuth:
+		return "InvitationWithAuth"
+	case InvitationWithUserAuth:
+		return "InvitationWithUserAuth"
+	case InvitationAccepted:
+		return "InvitationAccepted"
+	case InvitationPending:
+		return "InvitationPending"
+	case InvitationAuthRequired:
+		return "InvitationAuthRequired"
+	case InvitationUserAuthRequired:
+		return "InvitationUserAuthRequired"
+	case Ping:
+		return "Ping"
+	case PingReply:
+		return "PingReply"
+	case RetransmitRequest:
+		return "RetransmitRequest"
+	case RetransmitError:
+		return "RetransmitError"
+	case SessionReset:
+		return "SessionReset"
+	case SessionResetReply:
+		return "SessionResetReply"
+	case NAK:
+		return "NAK"
+	case Bye:
+		return "Bye"
+	case ByeReply:
+		return "ByeReply"
+	case UMPData:
+		return "UMPData"
+	default:
+		return fmt.Sprintf("Unknown(%X)", uint8(c))
+	}
+}
+
+// Reasons of Bye commands
+const (
+	ByeUnknown          = 0x00
+	ByeUserTerminated   = 0x01
+	ByePowerDown        = 0x02
+	ByeTooManyMissing   = 0x03
+	ByeTimeout          = 0x04
+	ByeNotEstablished   = 0x05
+	ByeNoPendingSession = 0x06
+	ByeProtocolError    = 0x07
+)
+
+// retransmitDataUnavailable is the reason of a RetransmitError for data which is no longer available
+const retransmitDataUnavailable = 0x01
+
+// maxPayloadWords is the largest payload of a command packet
+const maxPayloadWords = 0xff
+
+// Command is a command packet of a Network MIDI 2.0 UDP packet.
+type Command struct {
+	Code CommandCode
+	// Specific is the command specific data, e.g. the sequence number of UMPData.
+	Specific uint16
+	// Payload is a multiple of 32 bit words.
+	Payload []byte
+}
+
+func (c Command) String() string {
+	return fmt.Sprintf("%s specific=%04X payload=%d words", c.Code, c.Specific, len(c.Payload)/4)
+}
+
+// Encode returns the UDP packet of the commands.
+func Encode(commands ...Command) ([]byte, error) {
+	return AppendEncode(nil, commands...)
+}
+
+// AppendEncode appends the UDP packet of the commands to dst.
+func AppendEncode(dst []byte, commands ...Command) ([]byte, error) {
+	dst = binary.BigEndian.AppendUint32(dst, signature)
+	for _, c := range commands {
+		words := len(c.Payload) / 4
+		if len(c.Payload)%4 != 0 || words > maxPayloadWords {
+			return dst, fmt.Errorf("invalid payload of %d bytes for %s", len(c.Payload), c.Code)
+		}
+		dst = append(dst, byte(c.Code), byte(words))
+		dst = binary.BigEndian.AppendUint16(dst, c.Specific)
+		dst = append(dst, c.Payload...)
+	}
+	return dst, nil
+}
+
+// Decode returns the commands of an UDP packet.
+// The payloads of the commands refer to the buffer.
+func Decode(buffer []byte) ([]Command, error) {
+	if len(buffer) < 4 || binary.BigEndian.Uint32(buffer) != signature {
+		return nil, fmt.Errorf("missing signature")
+	}
+	commands := []Command{}
+	b := buffer[4:]
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return commands, fmt.Errorf("incomplete command header of %d bytes", len(b))
+		}
+		end := 4 + 4*int(b[1])
+		if len(b) < end {
+			return commands, fmt.Errorf("incomplete %s payload of %d bytes, expected %d", CommandCode(b[0]), len(b)-4, end-4)
+		}
+		commands = append(commands, Command{
+			Code:     CommandCode(b[0]),
+			Specific: binary.BigEndian.Uint16(b[2:4]),
+			Payload:  b[4:end],
+		})
+		b = b[end:]
+	}
+	return commands, nil
+}
+
+// padded returns the string padded with zeros to a multiple of 32 bit words.
+func padded(s string) []byte {
+	b := []byte(s)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// unpadded returns the string without the zero padding.
+func unpadded(b []byte) string {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
+
+// invitationCommand returns an Invitation or InvitationAccepted command with the endpoint name
+// and the product instance id.
+func invitationCommand(code CommandCode, endpointName, productInstanceID string) Command {
+	name := padded(endpointName)
+	return Command{
+		Code:     code,
+		Specific: uint16(len(name)/4) << 8,
+		Payload:  append(name, padded(productInstanceID)...),
+	}
+}
+
+// parseInvitation returns the endpoint name and product instance id of an invitation command.
+func parseInvitation(c Command) (string, string) {
+	n := 4 * int(c.Specific>>8)
+	if n > len(c.Payload) {
+		n = len(c.Payload)
+	}
+	return unpadded(c.Payload[:n]), unpadded(c.Payload[n:])
+}
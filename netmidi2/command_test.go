@@ -0,0 +1,55 @@
+package netmidi2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_encode_decode_commands(t *testing.T) {
+	// given
+	commands := []Command{
+		{Code: Ping, Payload: []byte{1, 2, 3, 4}},
+		{Code: UMPData, Specific: 0x1234, Payload: []byte{0x20, 0x90, 0x3c, 0x40}},
+	}
+	// when
+	b, err := Encode(commands...)
+	decoded, derr := Decode(b)
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, derr)
+	assert.Equal(t, []byte{'M', 'I', 'D', 'I', 0x20, 0x01, 0x00, 0x00, 1, 2, 3, 4}, b[:12])
+	assert.Equal(t, commands, decoded)
+}
+
+func Test_decode_without_signature(t *testing.T) {
+	// when
+	_, err := Decode([]byte{0x01, 0x02, 0x03, 0x04})
+	// then
+	assert.Error(t, err)
+}
+
+func Test_decode_incomplete_payload(t *testing.T) {
+	// when
+	_, err := Decode([]byte{'M', 'I', 'D', 'I', 0xff, 0x02, 0x00, 0x00, 1, 2, 3, 4})
+	// then
+	assert.Error(t, err)
+}
+
+func Test_encode_unaligned_payload(t *testing.T) {
+	// when
+	_, err := Encode(Command{Code: Ping, Payload: []byte{1, 2, 3}})
+	// then
+	assert.Error(t, err)
+}
+
+func Test_invitation_names(t *testing.T) {
+	// given
+	c := invitationCommand(Invitation, "Synth", "SN-42")
+	// when
+	name, id := parseInvitation(c)
+	// then
+	assert.Equal(t, uint16(2)<<8, c.Specific)
+	assert.Equal(t, "Synth", name)
+	assert.Equal(t, "SN-42", id)
+}
@@ -0,0 +1,519 @@
+package netmidi2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+	"github.com/laenzlinger/go-midi-rtp/ump"
+)
+
+// ServiceType is the mDNS service type of Network MIDI 2.0 endpoints.
+const ServiceType = "_midi2._udp"
+
+const (
+	// defaultFEC is the default number of previous UMP data commands repeated in each packet
+	defaultFEC = 2
+	// historySize is the number of sent UMP data commands kept for retransmission
+	historySize = 64
+	// maxPending is the number of UMP data commands buffered while waiting for missing ones
+	maxPending = 64
+	// maxDatagramSize is the largest UDP payload received
+	maxDatagramSize = 65507
+)
+
+// UMPHandlerFunc handles the Universal MIDI Packets received from a peer.
+type UMPHandlerFunc func([]ump.Packet, *Peer)
+
+// Session is a Network MIDI 2.0 UDP endpoint which accepts invitations and invites other endpoints.
+type Session struct {
+	EndpointName      string
+	ProductInstanceID string
+	Port              uint16
+
+	conn       net.PacketConn
+	mutex      sync.Mutex
+	peers      map[string]*Peer
+	handler    session.MIDIMessageHandlerFunc
+	umpHandler UMPHandlerFunc
+	translator *ump.Translator
+	protocol   ump.Protocol
+	fec        int
+	done       chan struct{}
+}
+
+// Option configures optional behaviour of a Session.
+type Option func(*Session)
+
+// WithForwardErrorCorrection repeats the given number of previous UMP data commands in each packet.
+// By default, the two previous commands are repeated.
+func WithForwardErrorCorrection(n int) Option {
+	return func(s *Session) {
+		s.fec = n
+	}
+}
+
+// WithProtocol selects the protocol of the channel voice messages sent by SendMIDICommands.
+// By default, MIDI 1.0 channel voice messages are sent.
+func WithProtocol(protocol ump.Protocol) Option {
+	return func(s *Session) {
+		s.protocol = protocol
+	}
+}
+
+// Start starts a new session listening on the UDP port.
+func Start(endpointName string, port uint16, options ...Option) (*Session, error) {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{
+		EndpointName: endpointName,
+		Port:         port,
+		conn:         conn,
+		peers:        map[string]*Peer{},
+		translator:   ump.NewTranslator(),
+		fec:          defaultFEC,
+		done:         make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	go s.messageLoop()
+	return s, nil
+}
+
+// Advertise registers the endpoint with mDNS.
+func (s *Session) Advertise() (*zeroconf.Server, error) {
+	txt := []string{"UMPEndpointName=" + s.EndpointName, "ProductInstanceId=" + s.ProductInstanceID}
+	return zeroconf.Register(s.EndpointName, ServiceType, "local.", int(s.Port), txt, nil)
+}
+
+// Handle registers the handler of the received UMP translated into MIDI 1.0 commands.
+//
+// The handlers of RTP-MIDI sessions, e.g. of a recorder, a router or a merger, are used
+// as they are. The SSRC of the messages identifies the Peer, the MIDINetworkSession passed
+// to the handler is nil.
+func (s *Session) Handle(handler session.MIDIMessageHandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handler = handler
+}
+
+// HandleUMP registers the handler of the received Universal MIDI Packets.
+func (s *Session) HandleUMP(handler UMPHandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.umpHandler = handler
+}
+
+// Invite sends an invitation to the endpoint at the address.
+// The peer is established when the invitation is accepted.
+func (s *Session) Invite(addr net.Addr) error {
+	s.mutex.Lock()
+	p := s.peer(addr)
+	s.mutex.Unlock()
+	return p.send(invitationCommand(Invitation, s.EndpointName, s.ProductInstanceID))
+}
+
+// Peers returns the established peers.
+func (s *Session) Peers() []*Peer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	peers := []*Peer{}
+	for _, p := range s.peers {
+		p.mutex.Lock()
+		established := p.established
+		p.mutex.Unlock()
+		if established {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// SendMIDICommands translates the commands into UMP and sends them to all peers.
+func (s *Session) SendMIDICommands(mcs rtp.MIDICommands) {
+	s.mutex.Lock()
+	packets := s.translator.FromCommands(0, mcs, s.protocol)
+	s.mutex.Unlock()
+	s.SendUMP(packets...)
+}
+
+// SendUMP sends the packets to all peers.
+func (s *Session) SendUMP(packets ...ump.Packet) {
+	for _, p := range s.Peers() {
+		p.SendUMP(packets...)
+	}
+}
+
+// End sends a Bye to all peers and closes the session.
+func (s *Session) End() {
+	for _, p := range s.Peers() {
+		p.send(Command{Code: Bye, Specific: ByeUserTerminated << 8})
+	}
+	s.conn.Close()
+	<-s.done
+}
+
+func (s *Session) messageLoop() {
+	defer close(s.done)
+	// one additional octet allows to detect datagrams which exceed the buffer
+	buffer := make([]byte, maxDatagramSize+1)
+	for {
+		n, addr, err := s.conn.ReadFrom(buffer)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		if n > maxDatagramSize {
+			log.Printf("Dropping truncated datagram from %v", addr)
+			continue
+		}
+		commands, err := Decode(buffer[:n])
+		if err != nil {
+			log.Printf("Dropping invalid datagram from %v: %v", addr, err)
+			continue
+		}
+		s.mutex.Lock()
+		p, found := s.peers[addr.String()]
+		if !found && invites(commands) {
+			p, found = s.peer(addr), true
+		}
+		s.mutex.Unlock()
+		if !found {
+			s.rejectUnknown(addr, commands)
+			continue
+		}
+		p.handle(commands)
+	}
+}
+
+// invites returns true if the commands contain an invitation.
+func invites(commands []Command) bool {
+	for _, c := range commands {
+		if c.Code == Invitation {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectUnknown answers the commands of an endpoint without session. A Bye is answered
+// with a ByeReply, any other command with a Bye as the session is not established.
+func (s *Session) rejectUnknown(addr net.Addr, commands []Command) {
+	reply := Command{Code: Bye, Specific: ByeNotEstablished << 8}
+	for _, c := range commands {
+		switch c.Code {
+		case Bye:
+			reply = Command{Code: ByeReply}
+		case ByeReply:
+			return
+		}
+	}
+	if buff, err := Encode(reply); err == nil {
+		s.conn.WriteTo(buff, addr)
+	}
+}
+
+// peer returns the peer of the address, created if unknown. Must be called with the mutex held.
+func (s *Session) peer(addr net.Addr) *Peer {
+	p, found := s.peers[addr.String()]
+	if !found {
+		p = &Peer{
+			Addr:       addr,
+			SSRC:       rand.Uint32(),
+			session:    s,
+			translator: ump.NewTranslator(),
+			pending:    map[uint16][]byte{},
+		}
+		s.peers[addr.String()] = p
+	}
+	return p
+}
+
+func (s *Session) removePeer(p *Peer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.peers, p.Addr.String())
+}
+
+func (s *Session) handlers() (session.MIDIMessageHandlerFunc, UMPHandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.handler, s.umpHandler
+}
+
+// Peer is a remote Network MIDI 2.0 endpoint.
+type Peer struct {
+	Addr              net.Addr
+	EndpointName      string
+	ProductInstanceID string
+	// SSRC identifies the peer in the messages passed to the MIDI message handler.
+	SSRC uint32
+
+	session     *Session
+	mutex       sync.Mutex
+	established bool
+	sendSeq     uint16
+	history     []Command
+	expected    uint16
+	synced      bool
+	pending     map[uint16][]byte
+	translator  *ump.Translator
+	lastPing    time.Time
+	roundTrip   time.Duration
+}
+
+// RoundTrip returns the round trip time of the last answered Ping.
+func (p *Peer) RoundTrip() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.roundTrip
+}
+
+// Ping sends a ping to the peer, the reply updates the round trip time.
+func (p *Peer) Ping() error {
+	p.mutex.Lock()
+	p.lastPing = time.Now()
+	id := uint32(p.lastPing.UnixNano())
+	p.mutex.Unlock()
+	return p.send(Command{Code: Ping, Payload: binary.BigEndian.AppendUint32(nil, id)})
+}
+
+// SendUMP sends the packets in UMP data commands. Each UDP packet repeats the previous
+// UMP data commands for forward error correction.
+func (p *Peer) SendUMP(packets ...ump.Packet) {
+	payload := []byte{}
+	for _, packet := range packets {
+		if len(payload)+4*len(packet) > 4*maxPayloadWords {
+			p.sendData(payload)
+			payload = []byte{}
+		}
+		payload = packet.Append(payload)
+	}
+	if len(payload) > 0 {
+		p.sendData(payload)
+	}
+}
+
+func (p *Peer) sendData(payload []byte) {
+	p.mutex.Lock()
+	c := Command{Code: UMPData, Specific: p.sendSeq, Payload: payload}
+	p.sendSeq++
+	fec := p.session.fec
+	if fec > len(p.history) {
+		fec = len(p.history)
+	}
+	commands := append(append([]Command{}, p.history[len(p.history)-fec:]...), c)
+	p.history = append(p.history, c)
+	if len(p.history) > historySize {
+		p.history = p.history[len(p.history)-historySize:]
+	}
+	p.mutex.Unlock()
+	p.send(commands...)
+}
+
+func (p *Peer) send(commands ...Command) error {
+	buff, err := Encode(commands...)
+	if err != nil {
+		return err
+	}
+	_, err = p.session.conn.WriteTo(buff, p.Addr)
+	return err
+}
+
+func (p *Peer) handle(commands []Command) {
+	notEstablished := false
+	for _, c := range commands {
+		p.mutex.Lock()
+		established := p.established
+		p.mutex.Unlock()
+		if !established && !beforeEstablished(c.Code) {
+			notEstablished = true
+			continue
+		}
+		switch c.Code {
+		case Invitation:
+			p.mutex.Lock()
+			p.EndpointName, p.ProductInstanceID = parseInvitation(c)
+			p.established = true
+			p.mutex.Unlock()
+			log.Printf("-> invitation from %s [%v]", p.EndpointName, p.Addr)
+			p.send(invitationCommand(InvitationAccepted, p.session.EndpointName, p.session.ProductInstanceID))
+		case InvitationAccepted:
+			p.mutex.Lock()
+			p.EndpointName, p.ProductInstanceID = parseInvitation(c)
+			p.established = true
+			p.mutex.Unlock()
+		case Ping:
+			p.send(Command{Code: PingReply, Payload: c.Payload})
+		case PingReply:
+			p.mutex.Lock()
+			p.roundTrip = time.Since(p.lastPing)
+			p.mutex.Unlock()
+		case RetransmitRequest:
+			p.retransmit(c)
+		case RetransmitError:
+			p.skipMissing()
+		case SessionReset:
+			p.mutex.Lock()
+			p.sendSeq, p.history, p.synced = 0, nil, false
+			p.pending = map[uint16][]byte{}
+			p.mutex.Unlock()
+			p.send(Command{Code: SessionResetReply})
+		case Bye:
+			p.send(Command{Code: ByeReply})
+			p.session.removePeer(p)
+			return
+		case ByeReply:
+			p.session.removePeer(p)
+			return
+		case UMPData:
+			p.receiveData(c)
+		}
+	}
+	if notEstablished {
+		p.send(Command{Code: Bye, Specific: ByeNotEstablished << 8})
+	}
+}
+
+// beforeEstablished returns true for the commands which are handled before the invitation
+// of a peer is accepted.
+func beforeEstablished(code CommandCode) bool {
+	switch code {
+	case Invitation, InvitationAccepted, Bye, ByeReply:
+		return true
+	}
+	return false
+}
+
+// retransmit resends the requested UMP data commands, if they are still in the history.
+func (p *Peer) retransmit(c Command) {
+	count := uint16(1)
+	if len(c.Payload) >= 2 {
+		count = binary.BigEndian.Uint16(c.Payload)
+	}
+	p.mutex.Lock()
+	commands := []Command{}
+	for seq := c.Specific; seq != c.Specific+count; seq++ {
+		for _, h := range p.history {
+			if h.Specific == seq {
+				commands = append(commands, h)
+			}
+		}
+	}
+	p.mutex.Unlock()
+	if len(commands) < int(count) {
+		p.send(Command{
+			Code:     RetransmitError,
+			Specific: retransmitDataUnavailable,
+			Payload:  binary.BigEndian.AppendUint32(nil, uint32(c.Specific)<<16),
+		})
+	}
+	if len(commands) > 0 {
+		p.send(commands...)
+	}
+}
+
+// receiveData delivers the UMP data commands ordered by sequence number. Duplicates are
+// dropped, missing commands are requested for retransmission.
+func (p *Peer) receiveData(c Command) {
+	p.mutex.Lock()
+	seq := c.Specific
+	if !p.synced {
+		p.expected, p.synced = seq, true
+	}
+	if sequenceBefore(seq, p.expected) {
+		p.mutex.Unlock()
+		return
+	}
+	if _, found := p.pending[seq]; found {
+		p.mutex.Unlock()
+		return
+	}
+	p.pending[seq] = append([]byte(nil), c.Payload...)
+	missing := seq != p.expected && len(p.pending) == 1
+	expected, count := p.expected, seq-p.expected
+	if len(p.pending) > maxPending {
+		p.skip()
+	}
+	ready := p.ready()
+	p.mutex.Unlock()
+
+	if missing {
+		p.send(Command{Code: RetransmitRequest, Specific: expected, Payload: binary.BigEndian.AppendUint32(nil, uint32(count)<<16)})
+	}
+	for _, payload := range ready {
+		p.deliver(payload)
+	}
+}
+
+// ready removes the consecutive pending commands starting at the expected sequence number.
+func (p *Peer) ready() [][]byte {
+	ready := [][]byte{}
+	for {
+		payload, found := p.pending[p.expected]
+		if !found {
+			return ready
+		}
+		delete(p.pending, p.expected)
+		ready = append(ready, payload)
+		p.expected++
+	}
+}
+
+// skip continues with the oldest pending command, giving up on the missing ones.
+func (p *Peer) skip() {
+	first := true
+	for seq := range p.pending {
+		if first || sequenceBefore(seq, p.expected) {
+			p.expected, first = seq, false
+		}
+	}
+}
+
+func (p *Peer) skipMissing() {
+	p.mutex.Lock()
+	if len(p.pending) > 0 {
+		p.skip()
+	}
+	ready := p.ready()
+	p.mutex.Unlock()
+	for _, payload := range ready {
+		p.deliver(payload)
+	}
+}
+
+func (p *Peer) deliver(payload []byte) {
+	packets, err := ump.Parse(payload)
+	if err != nil {
+		log.Printf("Dropping invalid UMP from %v: %v", p.Addr, err)
+	}
+	handler, umpHandler := p.session.handlers()
+	if umpHandler != nil {
+		umpHandler(packets, p)
+	}
+	if handler != nil {
+		p.mutex.Lock()
+		mcs := p.translator.ToCommands(packets, time.Now())
+		p.mutex.Unlock()
+		if len(mcs.Commands) > 0 {
+			handler(rtp.MIDIMessage{SSRC: p.SSRC, Commands: mcs}, nil)
+		}
+	}
+}
+
+// sequenceBefore compares 16 bit sequence numbers considering the wrap around.
+func sequenceBefore(a, b uint16) bool {
+	return int16(a-b) < 0
+}
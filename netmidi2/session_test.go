@@ -0,0 +1,96 @@
+package netmidi2
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_invite_and_send_commands(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	host, err := Start("host", 15204)
+	assert.NoError(t, err)
+	defer host.End()
+	host.Handle(func(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
+		received <- msg
+	})
+	client, err := Start("client", 15205)
+	assert.NoError(t, err)
+	defer client.End()
+	// when
+	assert.NoError(t, client.Invite(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15204}))
+	waitForPeer(t, client)
+	client.SendMIDICommands(rtp.MIDICommands{Timestamp: time.Now(), Commands: []rtp.MIDICommand{
+		{Payload: rtp.MIDIPayload{0x90, 0x3c, 0x40}},
+	}})
+	// then
+	select {
+	case msg := <-received:
+		assert.Equal(t, 1, len(msg.Commands.Commands))
+		assert.Equal(t, rtp.MIDIPayload{0x90, 0x3c, 0x40}, msg.Commands.Commands[0].Payload)
+		assert.Equal(t, host.Peers()[0].SSRC, msg.SSRC)
+	case <-time.After(time.Second):
+		t.Fatal("commands not received")
+	}
+	assert.Equal(t, "client", host.Peers()[0].EndpointName)
+}
+
+func Test_data_of_unknown_endpoint_is_rejected(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	host, err := Start("host", 15206)
+	assert.NoError(t, err)
+	defer host.End()
+	host.Handle(func(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
+		received <- msg
+	})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+	data, _ := Encode(Command{Code: UMPData, Payload: []byte{0x20, 0x90, 0x3c, 0x40}})
+	// when
+	pc.WriteTo(data, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15206})
+	// then
+	buffer := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buffer)
+	assert.NoError(t, err)
+	commands, err := Decode(buffer[:n])
+	assert.NoError(t, err)
+	assert.Equal(t, []Command{{Code: Bye, Specific: ByeNotEstablished << 8, Payload: []byte{}}}, commands)
+	select {
+	case <-received:
+		t.Fatal("data of unknown endpoint delivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+	host.mutex.Lock()
+	assert.Empty(t, host.peers)
+	host.mutex.Unlock()
+}
+
+func Test_drop_of_repeated_data(t *testing.T) {
+	// given
+	p := &Peer{pending: map[uint16][]byte{}, session: &Session{}}
+	// when
+	p.receiveData(Command{Code: UMPData, Specific: 7, Payload: []byte{0x20, 0x90, 0x3c, 0x40}})
+	p.receiveData(Command{Code: UMPData, Specific: 7, Payload: []byte{0x20, 0x90, 0x3c, 0x40}})
+	p.receiveData(Command{Code: UMPData, Specific: 6, Payload: []byte{0x20, 0x90, 0x3c, 0x40}})
+	// then
+	assert.Equal(t, uint16(8), p.expected)
+	assert.Empty(t, p.pending)
+}
+
+func waitForPeer(t *testing.T, s *Session) {
+	deadline := time.Now().Add(time.Second)
+	for len(s.Peers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("invitation not accepted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,323 @@
+// Package player plays Standard MIDI Files into RTP-MIDI sessions.
+package player
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/smf"
+)
+
+// Sender sends MIDI commands, e.g. a MIDINetworkSession or a Selection of its streams.
+type Sender interface {
+	SendMIDICommands(rtp.MIDICommands)
+}
+
+// DefaultBatchWindow is the default time span of events which are sent in one RTP packet.
+const DefaultBatchWindow = 2 * time.Millisecond
+
+// clocksPerQuarter is the resolution of the MIDI clock
+const clocksPerQuarter = 24
+
+// Player plays the MIDI events of a Standard MIDI File according to its tempo map.
+//
+// Events within the BatchWindow are sent together in one MIDICommands with their
+// delta times, the Timestamp of the commands is the scheduled time of the first event.
+type Player struct {
+	// BatchWindow is the time span of events which are sent together.
+	BatchWindow time.Duration
+
+	mutex    sync.Mutex
+	out      Sender
+	tempoMap smf.TempoMap
+	events   []smf.TimedEvent
+	length   time.Duration
+	clock    bool
+	loop     bool
+	position time.Duration
+	started  time.Time
+	playing  bool
+	stop     chan struct{}
+	stopped  chan struct{}
+	done     chan struct{}
+}
+
+// New creates a Player of the file sending to out.
+func New(f *smf.File, out Sender) *Player {
+	p := &Player{
+		BatchWindow: DefaultBatchWindow,
+		out:         out,
+		tempoMap:    f.TempoMap(),
+		done:        make(chan struct{}),
+	}
+	for _, e := range f.TimedEvents() {
+		if e.Time > p.length {
+			p.length = e.Time
+		}
+		if len(e.Payload()) > 0 {
+			p.events = append(p.events, e)
+		}
+	}
+	return p
+}
+
+// SetClock enables sending MIDI clock (24 PPQN) following the tempo map,
+// as well as start, stop, continue and song position pointer messages.
+func (p *Player) SetClock(enabled bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.clock = enabled
+}
+
+// SetLoop enables restarting the playback at the end of the file.
+func (p *Player) SetLoop(enabled bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.loop = enabled
+}
+
+// Length returns the duration of the file.
+func (p *Player) Length() time.Duration {
+	return p.length
+}
+
+// Playing returns true while the file is played.
+func (p *Player) Playing() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.playing
+}
+
+// Position returns the current playback position.
+func (p *Player) Position() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.currentPosition()
+}
+
+// Speed returns 1 while the file is played and 0 while it is stopped,
+// so that the Player is a Source of an mtc.Generator.
+func (p *Player) Speed() float64 {
+	if p.Playing() {
+		return 1
+	}
+	return 0
+}
+
+// Done returns a channel which is closed when the end of the file is reached without loop.
+func (p *Player) Done() <-chan struct{} {
+	return p.done
+}
+
+// Start starts the playback at the current position.
+func (p *Player) Start() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.playing {
+		return
+	}
+	if p.clock {
+		if p.position == 0 {
+			p.send(time.Now(), []byte{byte(midi.Start)})
+		} else {
+			p.send(time.Now(), []byte{byte(midi.Continue)})
+		}
+	}
+	p.start()
+}
+
+// Stop stops the playback and silences all channels.
+func (p *Player) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.playing {
+		return
+	}
+	p.halt()
+	if p.clock {
+		p.send(time.Now(), []byte{byte(midi.Stop)})
+	}
+	p.silence()
+}
+
+// Seek moves the playback position. A playing file continues at the new position.
+func (p *Player) Seek(position time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if position < 0 {
+		position = 0
+	}
+	if position > p.length {
+		position = p.length
+	}
+	playing := p.playing
+	if playing {
+		p.halt()
+		p.silence()
+	}
+	p.position = position
+	if p.clock {
+		p.sendSongPosition()
+	}
+	if playing {
+		p.start()
+	}
+}
+
+func (p *Player) currentPosition() time.Duration {
+	if !p.playing {
+		return p.position
+	}
+	position := p.position + time.Since(p.started)
+	if position > p.length {
+		return p.length
+	}
+	return position
+}
+
+func (p *Player) start() {
+	p.playing = true
+	p.started = time.Now()
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	go p.run(p.events, p.clockEvents(), p.position, p.started, p.stop, p.stopped)
+}
+
+// halt stops the playback goroutine and keeps the position.
+func (p *Player) halt() {
+	p.position = p.currentPosition()
+	p.playing = false
+	close(p.stop)
+	p.mutex.Unlock()
+	<-p.stopped
+	p.mutex.Lock()
+}
+
+func (p *Player) run(events []smf.TimedEvent, clocks []time.Duration, from time.Duration, started time.Time, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	i := sort.Search(len(events), func(i int) bool { return events[i].Time >= from })
+	c := sort.Search(len(clocks), func(i int) bool { return clocks[i] >= from })
+	for {
+		if i >= len(events) && c >= len(clocks) {
+			end := started.Add(p.length - from)
+			if !p.restart(end, stop) {
+				return
+			}
+			from, started, i, c = 0, end, 0, 0
+			continue
+		}
+
+		// the next batch starts with the earliest event or clock
+		first := p.length
+		if i < len(events) {
+			first = events[i].Time
+		}
+		if c < len(clocks) && clocks[c] < first {
+			first = clocks[c]
+		}
+		due := started.Add(first - from)
+		timer.Reset(time.Until(due))
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+
+		mcs := rtp.MIDICommands{Timestamp: due}
+		last := first
+		for {
+			next, payload := time.Duration(0), rtp.MIDIPayload(nil)
+			clock := c < len(clocks) && (i >= len(events) || clocks[c] <= events[i].Time)
+			if clock {
+				next, payload = clocks[c], rtp.MIDIPayload{byte(midi.Clock)}
+			} else if i < len(events) {
+				next, payload = events[i].Time, events[i].Payload()
+			}
+			if payload == nil || next-first > p.BatchWindow {
+				break
+			}
+			if clock {
+				c++
+			} else {
+				i++
+			}
+			mcs.Commands = append(mcs.Commands, rtp.MIDICommand{DeltaTime: next - last, Payload: payload})
+			last = next
+		}
+		p.out.SendMIDICommands(mcs)
+	}
+}
+
+// restart is called at the end of the file and returns true if the playback loops.
+func (p *Player) restart(end time.Time, stop <-chan struct{}) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	select {
+	case <-stop:
+		// stopped or seeking concurrently
+		return false
+	default:
+	}
+	if !p.loop {
+		p.playing = false
+		p.position = p.length
+		select {
+		case <-p.done:
+		default:
+			close(p.done)
+		}
+		return false
+	}
+	p.position = 0
+	p.started = end
+	if p.clock {
+		p.sendSongPosition()
+	}
+	return true
+}
+
+// clockEvents returns the times of the MIDI clocks, if enabled.
+func (p *Player) clockEvents() []time.Duration {
+	if !p.clock {
+		return nil
+	}
+	clocks := []time.Duration{}
+	division := uint64(p.tempoMap.Division)
+	for n := uint64(0); ; n++ {
+		t := p.tempoMap.Duration(n * division / clocksPerQuarter)
+		if t >= p.length {
+			return clocks
+		}
+		clocks = append(clocks, t)
+	}
+}
+
+// sendSongPosition sends the song position pointer of the current position.
+func (p *Player) sendSongPosition() {
+	// a MIDI beat is a sixteenth note
+	beats := p.tempoMap.Tick(p.position) * 4 / uint64(p.tempoMap.Division)
+	p.send(time.Now(), midi.Encode(midi.SongPosition{Position: uint16(beats)}))
+}
+
+// silence sends sustain off and all notes off on all channels.
+func (p *Player) silence() {
+	mcs := rtp.MIDICommands{Timestamp: time.Now()}
+	for ch := uint8(0); ch < 16; ch++ {
+		mcs.Commands = append(mcs.Commands,
+			rtp.MIDICommand{Payload: midi.Encode(midi.ControlChange{Channel: ch, Controller: 64})},
+			rtp.MIDICommand{Payload: midi.Encode(midi.ControlChange{Channel: ch, Controller: 123})},
+		)
+	}
+	p.out.SendMIDICommands(mcs)
+}
+
+func (p *Player) send(t time.Time, payload rtp.MIDIPayload) {
+	p.out.SendMIDICommands(rtp.MIDICommands{Timestamp: t, Commands: []rtp.MIDICommand{{Payload: payload}}})
+}
@@ -0,0 +1,135 @@
+package player
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/smf"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSender struct {
+	mutex sync.Mutex
+	lists []rtp.MIDICommands
+}
+
+func (r *recordingSender) SendMIDICommands(mcs rtp.MIDICommands) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lists = append(r.lists, mcs)
+}
+
+func (r *recordingSender) sent() []rtp.MIDICommands {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]rtp.MIDICommands(nil), r.lists...)
+}
+
+// testFile has a chord at the start and a note off after one quarter at 600 bpm (100 ms)
+// followed by a quarter at 1200 bpm (50 ms).
+func testFile() *smf.File {
+	return &smf.File{Format: 0, Division: 96, Tracks: []smf.Track{{Events: []smf.Event{
+		smf.NewTempoEvent(0, 100000),
+		{Delta: 0, Data: []byte{0x90, 0x3c, 0x40}},
+		{Delta: 0, Data: []byte{0x90, 0x40, 0x40}},
+		{Delta: 96, Data: []byte{0x80, 0x3c, 0x00}},
+		smf.NewTempoEvent(0, 50000),
+		{Delta: 96, Data: []byte{0x80, 0x40, 0x00}},
+		smf.NewEndOfTrackEvent(0),
+	}}}}
+}
+
+func Test_play_batches_simultaneous_events(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	p := New(testFile(), out)
+	// when
+	p.Start()
+	<-p.Done()
+	// then
+	assert.Equal(t, 150*time.Millisecond, p.Length())
+	assert.False(t, p.Playing())
+	lists := out.sent()
+	assert.Equal(t, 3, len(lists))
+	assert.Equal(t, []rtp.MIDICommand{
+		{Payload: []byte{0x90, 0x3c, 0x40}},
+		{Payload: []byte{0x90, 0x40, 0x40}},
+	}, lists[0].Commands)
+	assert.Equal(t, 100*time.Millisecond, lists[1].Timestamp.Sub(lists[0].Timestamp))
+	assert.Equal(t, 50*time.Millisecond, lists[2].Timestamp.Sub(lists[1].Timestamp))
+	assert.Equal(t, rtp.MIDIPayload{0x80, 0x40, 0x00}, lists[2].Commands[0].Payload)
+}
+
+func Test_play_batches_events_within_window_with_delta_time(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	p := New(testFile(), out)
+	p.BatchWindow = 120 * time.Millisecond
+	// when
+	p.Start()
+	<-p.Done()
+	// then
+	lists := out.sent()
+	assert.Equal(t, 2, len(lists))
+	assert.Equal(t, 3, len(lists[0].Commands))
+	assert.Equal(t, 100*time.Millisecond, lists[0].Commands[2].DeltaTime)
+}
+
+func Test_clock_start_and_song_position(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	p := New(testFile(), out)
+	p.SetClock(true)
+	// when
+	p.Seek(100 * time.Millisecond)
+	p.Start()
+	<-p.Done()
+	// then
+	lists := out.sent()
+	assert.Equal(t, rtp.MIDIPayload{0xf2, 0x04, 0x00}, lists[0].Commands[0].Payload)
+	assert.Equal(t, rtp.MIDIPayload{0xfb}, lists[1].Commands[0].Payload)
+	clocks := 0
+	for _, mcs := range lists[2:] {
+		for _, mc := range mcs.Commands {
+			if mc.Payload[0] == 0xf8 {
+				clocks++
+			}
+		}
+	}
+	// the second quarter of the file
+	assert.Equal(t, 24, clocks)
+}
+
+func Test_stop_silences_all_channels(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	p := New(testFile(), out)
+	p.Start()
+	// when
+	p.Stop()
+	// then
+	assert.False(t, p.Playing())
+	assert.True(t, p.Position() < p.Length())
+	lists := out.sent()
+	last := lists[len(lists)-1]
+	assert.Equal(t, 32, len(last.Commands))
+	assert.Equal(t, rtp.MIDIPayload{0xbf, 0x7b, 0x00}, last.Commands[31].Payload)
+}
+
+func Test_loop_restarts_playback(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	p := New(testFile(), out)
+	p.SetLoop(true)
+	// when
+	p.Start()
+	time.Sleep(200 * time.Millisecond)
+	p.Stop()
+	// then
+	lists := out.sent()
+	assert.True(t, len(lists) >= 5)
+	assert.Equal(t, rtp.MIDIPayload{0x90, 0x3c, 0x40}, lists[3].Commands[0].Payload)
+	assert.Equal(t, 150*time.Millisecond, lists[3].Timestamp.Sub(lists[0].Timestamp))
+}
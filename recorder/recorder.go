@@ -0,0 +1,129 @@
+// Package recorder records the MIDI commands received by a MIDINetworkSession
+// into a Standard MIDI File.
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+	"github.com/laenzlinger/go-midi-rtp/smf"
+)
+
+// Recorder records the received MIDI commands with one track per remote participant.
+//
+// The Recorder is used as handler of a session:
+//
+//	rec := recorder.New(time.Now())
+//	s.Handle(rec.HandleMIDI)
+//	...
+//	rec.Finish(file)
+type Recorder struct {
+	// Division is the number of ticks per quarter note of the recorded file.
+	Division uint16
+	// Tempo is the constant tempo in microseconds per quarter note of the recorded file,
+	// smf.DefaultTempo if 0.
+	Tempo uint32
+
+	mutex    sync.Mutex
+	origin   time.Time
+	tracks   []*participant
+	finished bool
+}
+
+type participant struct {
+	ssrc  uint32
+	name  string
+	lists []rtp.MIDICommands
+}
+
+// New creates a Recorder which places the commands relative to the origin.
+func New(origin time.Time) *Recorder {
+	return &Recorder{
+		Division: smf.DefaultDivision,
+		Tempo:    smf.DefaultTempo,
+		origin:   origin,
+	}
+}
+
+// HandleMIDI records the commands of the received message.
+//
+// The time of the commands is derived from the RTP timestamp of the message,
+// if the stream of the remote participant is synchronized.
+func (r *Recorder) HandleMIDI(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.finished || len(msg.Commands.Commands) == 0 {
+		return
+	}
+
+	p := r.participant(msg.SSRC, s)
+	mcs := rtp.MIDICommands{
+		Timestamp: msg.Commands.Timestamp,
+		Commands:  make([]rtp.MIDICommand, len(msg.Commands.Commands)),
+	}
+	for i, mc := range msg.Commands.Commands {
+		mcs.Commands[i] = rtp.MIDICommand{
+			DeltaTime: mc.DeltaTime,
+			Payload:   append(rtp.MIDIPayload(nil), mc.Payload...),
+		}
+	}
+	p.lists = append(p.lists, mcs)
+}
+
+func (r *Recorder) participant(ssrc uint32, s *session.MIDINetworkSession) *participant {
+	for _, p := range r.tracks {
+		if p.ssrc == ssrc {
+			return p
+		}
+	}
+	p := &participant{ssrc: ssrc, name: fmt.Sprintf("SSRC %x", ssrc)}
+	if s != nil {
+		if stream, found := s.Stream(ssrc); found && stream.Host.BonjourName != "" {
+			p.name = stream.Host.BonjourName
+		}
+	}
+	r.tracks = append(r.tracks, p)
+	return p
+}
+
+// File returns the Standard MIDI File of the commands recorded so far.
+//
+// The file has format 1, the first track contains the tempo and is followed by
+// one track per remote participant.
+func (r *Recorder) File() *smf.File {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tempo := r.Tempo
+	if tempo == 0 {
+		tempo = smf.DefaultTempo
+	}
+	f := &smf.File{
+		Format:   1,
+		Division: r.Division,
+		Tracks: []smf.Track{{Events: []smf.Event{
+			smf.NewTempoEvent(0, tempo),
+			smf.NewTimeSignatureEvent(0, 4, 4),
+			smf.NewEndOfTrackEvent(0),
+		}}},
+	}
+	for _, p := range r.tracks {
+		f.Tracks = append(f.Tracks, smf.TrackFromCommands(p.name, r.origin, r.Division, tempo, p.lists...))
+	}
+	return f
+}
+
+// Finish stops the recording and writes the recorded file.
+// Commands received afterwards are ignored.
+func (r *Recorder) Finish(w io.Writer) error {
+	r.mutex.Lock()
+	r.finished = true
+	r.mutex.Unlock()
+
+	return r.File().Write(w)
+}
@@ -0,0 +1,65 @@
+package recorder
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/smf"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_recording_of_two_participants(t *testing.T) {
+	// given
+	origin := time.Now()
+	r := New(origin)
+	note := func(ssrc uint32, at time.Duration, payload ...byte) rtp.MIDIMessage {
+		return rtp.MIDIMessage{SSRC: ssrc, Commands: rtp.MIDICommands{
+			Timestamp: origin.Add(at),
+			Commands:  []rtp.MIDICommand{{Payload: payload}},
+		}}
+	}
+	// when
+	r.HandleMIDI(note(1, 0, 0x90, 0x3c, 0x40), nil)
+	r.HandleMIDI(note(2, 250*time.Millisecond, 0x91, 0x40, 0x40), nil)
+	r.HandleMIDI(note(1, 500*time.Millisecond, 0x80, 0x3c, 0x00), nil)
+	b := new(bytes.Buffer)
+	err := r.Finish(b)
+	r.HandleMIDI(note(1, time.Second, 0x90, 0x3c, 0x40), nil)
+	// then
+	assert.Nil(t, err)
+	f, err := smf.Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(1), f.Format)
+	assert.Equal(t, 3, len(f.Tracks))
+	assert.Equal(t, "SSRC 1", f.Tracks[1].Name())
+	assert.Equal(t, []smf.Event{
+		smf.NewTrackNameEvent(0, "SSRC 1"),
+		{Delta: 0, Data: []byte{0x90, 0x3c, 0x40}},
+		{Delta: 480, Data: []byte{0x80, 0x3c, 0x00}},
+		smf.NewEndOfTrackEvent(0),
+	}, f.Tracks[1].Events)
+	assert.Equal(t, []smf.Event{
+		smf.NewTrackNameEvent(0, "SSRC 2"),
+		{Delta: 240, Data: []byte{0x91, 0x40, 0x40}},
+		smf.NewEndOfTrackEvent(0),
+	}, f.Tracks[2].Events)
+}
+
+func Test_recording_with_zero_tempo_uses_default_tempo(t *testing.T) {
+	// given
+	origin := time.Now()
+	r := &Recorder{Division: smf.DefaultDivision, origin: origin}
+	r.HandleMIDI(rtp.MIDIMessage{SSRC: 1, Commands: rtp.MIDICommands{
+		Timestamp: origin.Add(500 * time.Millisecond),
+		Commands:  []rtp.MIDICommand{{Payload: rtp.MIDIPayload{0x90, 0x3c, 0x40}}},
+	}}, nil)
+	// when
+	f := r.File()
+	// then
+	tempo, ok := f.Tracks[0].Events[0].Tempo()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(smf.DefaultTempo), tempo)
+	assert.Equal(t, smf.Event{Delta: 480, Data: []byte{0x90, 0x3c, 0x40}}, f.Tracks[1].Events[1])
+}
@@ -0,0 +1,164 @@
+package router
+
+import (
+	"math"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+)
+
+// Filter selects the messages forwarded by a route.
+type Filter func(midi.Message) bool
+
+// Transform changes a message forwarded by a route. Messages are dropped if false is returned.
+type Transform func(midi.Message) (midi.Message, bool)
+
+// MessageTypes matches channel messages by the upper nibble of their status (e.g. 0x90 for
+// note on) and system messages by their complete status (e.g. 0xf8 for the timing clock).
+func MessageTypes(statuses ...byte) Filter {
+	return func(m midi.Message) bool {
+		status := status(m)
+		if status < 0xf0 {
+			status &= 0xf0
+		}
+		for _, s := range statuses {
+			if s == status {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Channels matches channel messages on one of the channels (0-15).
+// System messages are not matched.
+func Channels(channels ...uint8) Filter {
+	return func(m midi.Message) bool {
+		cm, ok := m.(midi.ChannelMessage)
+		if !ok {
+			return false
+		}
+		for _, ch := range channels {
+			if ch == cm.GetChannel() {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// NoteRange matches note on, note off and polyphonic pressure messages with a key between
+// low and high, inclusively. All other messages are matched, so that controllers reach
+// all parts of a split keyboard.
+func NoteRange(low, high uint8) Filter {
+	return func(m midi.Message) bool {
+		key, ok := noteKey(m)
+		return !ok || (key >= low && key <= high)
+	}
+}
+
+// Not inverts the filter.
+func Not(f Filter) Filter {
+	return func(m midi.Message) bool {
+		return !f(m)
+	}
+}
+
+// Transpose shifts the key of note messages by the number of semitones.
+// Notes shifted outside of the MIDI range are dropped.
+func Transpose(semitones int) Transform {
+	return func(m midi.Message) (midi.Message, bool) {
+		key, ok := noteKey(m)
+		if !ok {
+			return m, true
+		}
+		shifted := int(key) + semitones
+		if shifted < 0 || shifted > 127 {
+			return m, false
+		}
+		return withKey(m, uint8(shifted)), true
+	}
+}
+
+// RemapChannel sends the channel messages of channel from on channel to.
+func RemapChannel(from, to uint8) Transform {
+	return func(m midi.Message) (midi.Message, bool) {
+		if cm, ok := m.(midi.ChannelMessage); ok && cm.GetChannel() == from {
+			return midi.WithChannel(cm, to), true
+		}
+		return m, true
+	}
+}
+
+// VelocityCurve maps the velocity of note on messages with the curve. The mapped velocity
+// is limited to 1-127, so that a note on is not turned into a note off.
+func VelocityCurve(curve func(uint8) uint8) Transform {
+	return func(m midi.Message) (midi.Message, bool) {
+		on, ok := m.(midi.NoteOn)
+		if !ok || on.IsNoteOff() {
+			return m, true
+		}
+		v := curve(on.Velocity)
+		switch {
+		case v < 1:
+			v = 1
+		case v > 127:
+			v = 127
+		}
+		on.Velocity = v
+		return on, true
+	}
+}
+
+// Exponential returns a velocity curve with the exponent. Exponents above 1 soften,
+// exponents below 1 harden the response.
+func Exponential(exponent float64) func(uint8) uint8 {
+	return func(v uint8) uint8 {
+		return uint8(math.Round(127 * math.Pow(float64(v)/127, exponent)))
+	}
+}
+
+// RemapController sends the values of controller from as values of controller to.
+func RemapController(from, to uint8) Transform {
+	return func(m midi.Message) (midi.Message, bool) {
+		if cc, ok := m.(midi.ControlChange); ok && cc.Controller == from {
+			cc.Controller = to
+			return cc, true
+		}
+		return m, true
+	}
+}
+
+func status(m midi.Message) byte {
+	b := m.Append(nil)
+	if len(b) == 0 {
+		return 0
+	}
+	return b[0]
+}
+
+func noteKey(m midi.Message) (uint8, bool) {
+	switch msg := m.(type) {
+	case midi.NoteOn:
+		return msg.Key, true
+	case midi.NoteOff:
+		return msg.Key, true
+	case midi.PolyPressure:
+		return msg.Key, true
+	}
+	return 0, false
+}
+
+func withKey(m midi.Message, key uint8) midi.Message {
+	switch msg := m.(type) {
+	case midi.NoteOn:
+		msg.Key = key
+		return msg
+	case midi.NoteOff:
+		msg.Key = key
+		return msg
+	case midi.PolyPressure:
+		msg.Key = key
+		return msg
+	}
+	return m
+}
@@ -0,0 +1,37 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_transforms(t *testing.T) {
+	// when
+	transposed, inRange := Transpose(12)(midi.NoteOn{Key: 120, Velocity: 1})
+	soft, _ := VelocityCurve(Exponential(2))(midi.NoteOn{Key: 60, Velocity: 64})
+	quiet, _ := VelocityCurve(func(uint8) uint8 { return 0 })(midi.NoteOn{Key: 60, Velocity: 64})
+	remapped, _ := RemapController(1, 74)(midi.ControlChange{Controller: 1, Value: 10})
+	// then
+	assert.False(t, inRange)
+	assert.Equal(t, midi.NoteOn{Key: 120, Velocity: 1}, transposed)
+	assert.Equal(t, midi.NoteOn{Key: 60, Velocity: 32}, soft)
+	assert.Equal(t, midi.NoteOn{Key: 60, Velocity: 1}, quiet)
+	assert.Equal(t, midi.ControlChange{Controller: 74, Value: 10}, remapped)
+}
+
+func Test_filters(t *testing.T) {
+	// given
+	on := midi.NoteOn{Channel: 2, Key: 60, Velocity: 64}
+	clock := midi.Realtime(0xf8)
+	// then
+	assert.True(t, MessageTypes(0x90)(on))
+	assert.True(t, MessageTypes(0xf8)(clock))
+	assert.False(t, MessageTypes(0x80)(on))
+	assert.True(t, Channels(2)(on))
+	assert.False(t, Channels(2)(clock))
+	assert.False(t, NoteRange(61, 127)(on))
+	assert.True(t, NoteRange(61, 127)(midi.ControlChange{Controller: 64}))
+	assert.True(t, Not(Channels(3))(on))
+}
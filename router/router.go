@@ -0,0 +1,181 @@
+// Package router forwards the MIDI commands received from remote participants to other
+// participants, filtered and transformed by configurable routes.
+package router
+
+import (
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/session"
+)
+
+// Sender sends MIDI commands, e.g. a MIDINetworkSession or a Selection of its streams.
+type Sender interface {
+	SendMIDICommands(rtp.MIDICommands)
+}
+
+// Route forwards the messages received from the sources, which pass all filters, to the
+// destination after applying the transforms in order.
+//
+// Split keyboards are routes with distinct note ranges, layers are multiple routes of the
+// same source.
+type Route struct {
+	// Name identifies the route to replace or remove it.
+	Name string
+	// Sources are the Bonjour names of the remote participants. All are routed if empty.
+	Sources     []string
+	Filters     []Filter
+	Transforms  []Transform
+	Destination Sender
+}
+
+// Split returns the routes below and above with note range filters, which forward the
+// keys below the split key to the first and the others to the second route.
+func Split(key uint8, below, above Route) []Route {
+	lower := func(m midi.Message) bool {
+		k, ok := noteKey(m)
+		return !ok || k < key
+	}
+	below.Filters = append(append([]Filter(nil), below.Filters...), lower)
+	above.Filters = append(append([]Filter(nil), above.Filters...), NoteRange(key, 127))
+	return []Route{below, above}
+}
+
+// Router forwards the received messages along the routes. Routes can be changed while
+// messages are forwarded.
+//
+// The Router is used as handler of a session:
+//
+//	r := router.New(router.Route{Name: "keys", Sources: []string{"keyboard"}, Destination: s.Select("synth")})
+//	s.Handle(r.HandleMIDI)
+type Router struct {
+	mutex  sync.RWMutex
+	routes []Route
+}
+
+// New creates a Router with the routes.
+func New(routes ...Route) *Router {
+	return &Router{routes: routes}
+}
+
+// Routes returns the current routes.
+func (r *Router) Routes() []Route {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]Route(nil), r.routes...)
+}
+
+// Set replaces all routes.
+func (r *Router) Set(routes ...Route) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.routes = append([]Route(nil), routes...)
+}
+
+// Add adds the route or replaces the route with the same name.
+func (r *Router) Add(route Route) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := range r.routes {
+		if r.routes[i].Name == route.Name {
+			r.routes[i] = route
+			return
+		}
+	}
+	r.routes = append(r.routes, route)
+}
+
+// Remove removes the routes with the name and returns false if there was none.
+func (r *Router) Remove(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes := r.routes[:0:0]
+	for _, route := range r.routes {
+		if route.Name != name {
+			routes = append(routes, route)
+		}
+	}
+	removed := len(routes) < len(r.routes)
+	r.routes = routes
+	return removed
+}
+
+// HandleMIDI forwards the commands of the message received from a remote participant.
+// The session is nil for messages of other transports, e.g. a netmidi2.Session.
+func (r *Router) HandleMIDI(msg rtp.MIDIMessage, s *session.MIDINetworkSession) {
+	source := ""
+	if s != nil {
+		if conn, found := s.Stream(msg.SSRC); found {
+			source = conn.Host.BonjourName
+		}
+	}
+	r.HandleCommands(source, msg.Commands)
+}
+
+// HandleCommands forwards the commands received from the source.
+func (r *Router) HandleCommands(source string, mcs rtp.MIDICommands) {
+	messages := make([]midi.Message, len(mcs.Commands))
+	for i, mc := range mcs.Commands {
+		// invalid commands are not forwarded, their delta time is kept
+		messages[i], _ = mc.Payload.Message()
+	}
+	for _, route := range r.Routes() {
+		if route.Destination == nil || !route.from(source) {
+			continue
+		}
+		if out := route.forward(mcs, messages); len(out.Commands) > 0 {
+			route.Destination.SendMIDICommands(out)
+		}
+	}
+}
+
+func (route Route) from(source string) bool {
+	if len(route.Sources) == 0 {
+		return true
+	}
+	for _, s := range route.Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// forward returns the commands passing the route. The delta time of dropped commands is
+// added to the succeeding command.
+func (route Route) forward(mcs rtp.MIDICommands, messages []midi.Message) rtp.MIDICommands {
+	out := rtp.MIDICommands{Timestamp: mcs.Timestamp}
+	var dropped time.Duration
+	for i, mc := range mcs.Commands {
+		m, ok := route.apply(messages[i])
+		if !ok {
+			dropped += mc.DeltaTime
+			continue
+		}
+		commands := rtp.Commands(m)
+		commands[0].DeltaTime = dropped + mc.DeltaTime
+		out.Commands = append(out.Commands, commands...)
+		dropped = 0
+	}
+	return out
+}
+
+func (route Route) apply(m midi.Message) (midi.Message, bool) {
+	if m == nil {
+		return nil, false
+	}
+	for _, f := range route.Filters {
+		if !f(m) {
+			return nil, false
+		}
+	}
+	for _, t := range route.Transforms {
+		var ok bool
+		if m, ok = t(m); !ok {
+			return nil, false
+		}
+	}
+	return m, true
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSender struct {
+	sent []rtp.MIDICommands
+}
+
+func (r *recordingSender) SendMIDICommands(mcs rtp.MIDICommands) {
+	r.sent = append(r.sent, mcs)
+}
+
+func (r *recordingSender) payloads() []rtp.MIDIPayload {
+	payloads := []rtp.MIDIPayload{}
+	for _, mcs := range r.sent {
+		for _, mc := range mcs.Commands {
+			payloads = append(payloads, mc.Payload)
+		}
+	}
+	return payloads
+}
+
+func commands(payloads ...rtp.MIDIPayload) rtp.MIDICommands {
+	mcs := rtp.MIDICommands{Timestamp: time.Now()}
+	for _, p := range payloads {
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{DeltaTime: time.Millisecond, Payload: p})
+	}
+	return mcs
+}
+
+func Test_route_by_source(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	r := New(Route{Name: "keys", Sources: []string{"keyboard"}, Destination: out})
+	// when
+	r.HandleCommands("pads", commands(rtp.MIDIPayload{0x90, 0x3c, 0x40}))
+	r.HandleCommands("keyboard", commands(rtp.MIDIPayload{0x90, 0x3e, 0x40}))
+	// then
+	assert.Equal(t, []rtp.MIDIPayload{{0x90, 0x3e, 0x40}}, out.payloads())
+}
+
+func Test_handle_message_without_session(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	r := New(Route{Destination: out})
+	// when
+	r.HandleMIDI(rtp.MIDIMessage{Commands: commands(rtp.MIDIPayload{0x90, 0x3c, 0x40})}, nil)
+	// then
+	assert.Equal(t, []rtp.MIDIPayload{{0x90, 0x3c, 0x40}}, out.payloads())
+}
+
+func Test_filter_keeps_delta_time_of_dropped_commands(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	r := New(Route{Filters: []Filter{Channels(1)}, Destination: out})
+	// when
+	r.HandleCommands("", commands(rtp.MIDIPayload{0x90, 0x3c, 0x40}, rtp.MIDIPayload{0xf8}, rtp.MIDIPayload{0x91, 0x3c, 0x40}))
+	// then
+	assert.Equal(t, 1, len(out.sent))
+	assert.Equal(t, []rtp.MIDICommand{{DeltaTime: 3 * time.Millisecond, Payload: rtp.MIDIPayload{0x91, 0x3c, 0x40}}}, out.sent[0].Commands)
+}
+
+func Test_split_and_layer(t *testing.T) {
+	// given
+	bass, piano, strings := &recordingSender{}, &recordingSender{}, &recordingSender{}
+	r := New(Split(60,
+		Route{Name: "bass", Destination: bass, Transforms: []Transform{Transpose(-12), RemapChannel(0, 1)}},
+		Route{Name: "piano", Destination: piano},
+	)...)
+	r.Add(Route{Name: "strings", Filters: []Filter{MessageTypes(0x80, 0x90)}, Destination: strings})
+	// when
+	r.HandleCommands("", commands(
+		rtp.MIDIPayload{0x90, 40, 0x40},
+		rtp.MIDIPayload{0x90, 72, 0x40},
+		rtp.MIDIPayload{0xb0, 64, 0x7f},
+	))
+	// then
+	assert.Equal(t, []rtp.MIDIPayload{{0x91, 28, 0x40}, {0xb1, 64, 0x7f}}, bass.payloads())
+	assert.Equal(t, []rtp.MIDIPayload{{0x90, 72, 0x40}, {0xb0, 64, 0x7f}}, piano.payloads())
+	assert.Equal(t, []rtp.MIDIPayload{{0x90, 40, 0x40}, {0x90, 72, 0x40}}, strings.payloads())
+}
+
+func Test_change_routes_at_runtime(t *testing.T) {
+	// given
+	out := &recordingSender{}
+	r := New(Route{Name: "a", Destination: out})
+	// when
+	removed := r.Remove("a")
+	r.HandleCommands("", commands(rtp.MIDIPayload{0x90, 0x3c, 0x40}))
+	// then
+	assert.True(t, removed)
+	assert.False(t, r.Remove("a"))
+	assert.Empty(t, out.sent)
+}
@@ -1,7 +1,6 @@
 package rtp
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -25,8 +24,14 @@ const (
 // RTP-MIDI constants
 const (
 	minimumBufferLength = 12
+	// packetOverhead is the size of the RTP header plus a big MIDI command section header
+	packetOverhead = 12 + 2
 )
 
+// MaxMIDIListLength is the maximum length of the MIDI list which can be expressed
+// in the LEN field of the MIDI command section.
+const MaxMIDIListLength = 0x0fff
+
 const (
 	padding   = 0x00
 	extension = 0x00
@@ -140,7 +145,12 @@ func (h *RTPMIDIHeader) HasMIDIData() bool {
 type MIDIMessage struct {
 	SequenceNumber uint16
 	SSRC           uint32
-	Commands       MIDICommands
+	// RTPTimestamp is the timestamp of a received message in the media clock of the sender.
+	// It is ignored when encoding, the timestamp is derived from the Commands.
+	RTPTimestamp uint32
+	Commands     MIDICommands
+	// payloads is the buffer holding the decoded command payloads
+	payloads []byte
 }
 
 // MIDICommands the list of MIDICommand sent inside a MIDIMessage
@@ -152,12 +162,29 @@ type MIDICommands struct {
 // MIDIPayload contains the MIDI payload to be sent.
 type MIDIPayload []byte
 
+// Message parses the payload into a typed MIDI message.
+func (p MIDIPayload) Message() (midi.Message, error) {
+	return midi.Parse(p)
+}
+
 // MIDICommand represents a single command containing a DeltaTime and the Payload
 type MIDICommand struct {
 	DeltaTime time.Duration
 	Payload   MIDIPayload
 }
 
+// Commands returns one command per MIDI message. Parameter changes and 14 bit control
+// changes are split into one command per control change, see midi.Split.
+func Commands(messages ...midi.Message) []MIDICommand {
+	commands := make([]MIDICommand, 0, len(messages))
+	for _, m := range messages {
+		for _, part := range midi.Split(m) {
+			commands = append(commands, MIDICommand{Payload: midi.Encode(part)})
+		}
+	}
+	return commands
+}
+
 type MIDIListHeader struct {
 	// B
 	bigHeader bool
@@ -174,12 +201,22 @@ type MIDIListHeader struct {
 // Decode a byte buffer into a MIDIMessage
 func Decode(buffer []byte) (msg MIDIMessage, err error) {
 	msg = MIDIMessage{}
+	err = DecodeInto(&msg, buffer)
+	return msg, err
+}
+
+// DecodeInto decodes a byte buffer into the given MIDIMessage.
+//
+// The command list and the payloads of the message are reused, so decoding
+// into the same message repeatedly does not allocate once the message has grown
+// to the size of the packets. Payloads decoded previously into the same message
+// must therefore not be used after calling DecodeInto again.
+func DecodeInto(msg *MIDIMessage, buffer []byte) (err error) {
 	if len(buffer) < minimumBufferLength {
 		err = fmt.Errorf("buffer is too small: %d bytes", len(buffer))
-		return msg, err
+		return err
 	}
 
-	// FIXME implement decoder
 	// fmt.Println("RTP packet dump ****")
 	// fmt.Print(hex.Dump(buffer))
 	// fmt.Println("****")
@@ -198,6 +235,9 @@ func Decode(buffer []byte) (msg MIDIMessage, err error) {
 	offset = 2
 	msg.SequenceNumber = binary.BigEndian.Uint16(buffer[offset : offset+2]) // 2 bytes
 
+	offset = 4
+	msg.RTPTimestamp = binary.BigEndian.Uint32(buffer[offset : offset+4]) // 4 bytes
+
 	offset = 8
 	msg.SSRC = binary.BigEndian.Uint32(buffer[offset : offset+4]) // 4 bytes
 
@@ -207,15 +247,17 @@ func Decode(buffer []byte) (msg MIDIMessage, err error) {
 
 	err = header.Valid()
 	if err != nil {
-		return msg, err
+		return err
 	}
 
-	// if !header.HasMIDIData() {
-	// 	return msg, nil
-	// }
+	msg.Commands.Timestamp = time.Now()
+	msg.Commands.Commands = msg.Commands.Commands[:0]
 
 	//MIDI List starts at index 12 / byte 13
 	offset = 12
+	if len(buffer) <= offset {
+		return nil
+	}
 
 	midiListHeader := MIDIListHeader{
 		bigHeader:           buffer[offset]&bigHeaderBit > 0,
@@ -225,21 +267,26 @@ func Decode(buffer []byte) (msg MIDIMessage, err error) {
 
 	listStart := offset + 1
 	if midiListHeader.bigHeader {
+		if len(buffer) < offset+2 {
+			return fmt.Errorf("buffer is too small for the MIDI command section header: %d bytes", len(buffer))
+		}
 		midiListHeader.Len = binary.BigEndian.Uint16(buffer[offset:offset+2]) & 0x0fff
 		listStart = offset + 2
 	} else {
 		midiListHeader.Len = uint16(buffer[offset] & lenMask)
 	}
 
-	commands, err := parseMIDIList(buffer, listStart, &midiListHeader)
+	// Running status octets are added to the payloads, so they may need up to twice the list length.
+	if cap(msg.payloads) < 2*int(midiListHeader.Len) {
+		msg.payloads = make([]byte, 0, 2*int(midiListHeader.Len))
+	}
+	commands, payloads, err := parseMIDIList(msg.Commands.Commands, msg.payloads[:0], buffer, listStart, &midiListHeader)
 	if err != nil {
 		fmt.Printf("[INFO] Error parsing midi list, returning parsed commands so far: %s\n", err)
 	}
-	msg.Commands = MIDICommands{
-		Timestamp: time.Now(),
-		Commands:  commands,
-	}
-	return msg, nil
+	msg.Commands.Commands = commands
+	msg.payloads = payloads
+	return nil
 }
 
 func dumpPacket(buffer []byte, startByte uint, length uint) {
@@ -256,104 +303,173 @@ func dumpPacket(buffer []byte, startByte uint, length uint) {
 	fmt.Println()
 }
 
-func parseMIDIList(buffer []byte, offset int, header *MIDIListHeader) ([]MIDICommand, error) {
-	commands := make([]MIDICommand, 0)
+// parseMIDIList appends the commands of the MIDI list to commands and their payloads to payloads.
+// The payloads of the commands are slices of the payloads buffer.
+func parseMIDIList(commands []MIDICommand, payloads []byte, buffer []byte, offset int, header *MIDIListHeader) ([]MIDICommand, []byte, error) {
 	// fmt.Printf("MIDI List Header %#v\n", header)
-	// fmt.Printf("Remaining buffer size %d\n", uint(len(buffer)-12))
-	// dumpPacket(buffer, 12, uint(len(buffer)-12))
 	// fmt.Printf("--- midi list buffer with length %2d\n", header.Len)
 	// dumpPacket(buffer, uint(offset), uint(header.Len))
 	// fmt.Println("---")
 
+	end := offset + int(header.Len)
+	if end > len(buffer) {
+		return commands, payloads, fmt.Errorf("MIDI list length %d exceeds the buffer", header.Len)
+	}
+
 	// Keep track of the last status byte to infer for succeeding ones
-	var lastStatusByte byte
+	var runningStatus byte
+	var deltaTime time.Duration
+	// start of the payload of the current command in the payloads buffer
+	var start int
+
+	emit := func() {
+		payload := payloads[start:len(payloads):len(payloads)]
+		commands = append(commands, MIDICommand{DeltaTime: deltaTime, Payload: payload})
+		deltaTime = 0
+		start = len(payloads)
+	}
+	// System Real-Time commands may be interleaved everywhere, even between the
+	// status and the data bytes of another command. They are extracted as separate
+	// commands preceding the surrounding one, so the partial payload of the
+	// surrounding command is moved behind the Real-Time command.
+	emitRealtime := func(statusByte byte) {
+		// undefined status bytes are ignored
+		if midi.GetCommandInfo(statusByte) == nil {
+			return
+		}
+		payloads = append(payloads, statusByte)
+		partial := len(payloads) - 1 - start
+		copy(payloads[start+1:], payloads[start:start+partial])
+		payloads[start] = statusByte
+		commands = append(commands, MIDICommand{DeltaTime: deltaTime, Payload: payloads[start : start+1 : start+1]})
+		deltaTime = 0
+		start += 1
+	}
 
-	end := offset + int(header.Len)
-	// Based on a NodeJS implementation
+	first := true
 	for offset < end {
-		command := MIDICommand{}
-		dataLength := 0
-		deltaTime := uint32(0)
-
-		// Decode the delta time
-		if len(commands) > 0 || header.preceedingDeltaTime {
-			for k := 0; k < 4; k++ {
-				currentOctet := buffer[offset]
-				deltaTime <<= 7
-				deltaTime |= uint32(currentOctet) & deltaTimeMask
-				offset += 1
-				if currentOctet&deltaTimeHasNext == 0 {
-					break
-				}
+		deltaTime = 0
+		start = len(payloads)
+		if !first || header.preceedingDeltaTime {
+			ticks, next, err := decodeDeltaTime(buffer, offset, end)
+			if err != nil {
+				return commands, payloads, err
 			}
+			deltaTime = timestamp.Timestamp(ticks).Duration()
+			offset = next
+		}
+		first = false
+		if offset >= end {
+			return commands, payloads, fmt.Errorf("Missing MIDI command after delta time")
 		}
-		command.DeltaTime = time.Millisecond * time.Duration(deltaTime)
 
 		statusByte := buffer[offset]
-		hasOwnStatusByte := (statusByte & 0x80) == 0x80
-		if hasOwnStatusByte {
-			lastStatusByte = statusByte
+		if midi.IsStatus(statusByte) {
 			offset += 1
+		} else if runningStatus != 0 {
+			statusByte = runningStatus
+		} else {
+			return commands, payloads, fmt.Errorf("Data byte %X without running status", statusByte)
+		}
+
+		if midi.IsRealtime(statusByte) {
+			emitRealtime(statusByte)
+			continue
+		}
+		if midi.IsSystemCommon(statusByte) {
+			// System Common and SysEx commands cancel the running status
+			runningStatus = 0
 		} else {
-			statusByte = lastStatusByte
+			runningStatus = statusByte
 		}
 
-		//  Parse SysEx (experimental, needs testing)
-		if statusByte == 0xf0 {
-			dataLength = 0
-			for len(buffer) > offset+dataLength &&
-				!(buffer[offset+dataLength]&0x80 > 0x00) {
-				// TODO: possibly append byte to sysex buffer?
-				dataLength += 1
+		if statusByte == sysExStart || statusByte == sysExEnd {
+			payloads = append(payloads, statusByte)
+			// Parse SysEx commands and segments up to the terminating F7, F0 or F4 octet
+			terminated := false
+			for offset < end && !terminated {
+				b := buffer[offset]
+				offset += 1
+				switch {
+				case midi.IsRealtime(b):
+					emitRealtime(b)
+				case !midi.IsStatus(b):
+					payloads = append(payloads, b)
+				case b == sysExEnd || b == sysExStart || b == sysExCancel:
+					payloads = append(payloads, b)
+					terminated = true
+				default:
+					return commands, payloads, fmt.Errorf("SysEx command terminated by unexpected status %X", b)
+				}
 			}
-			// TODO: SysEx end?
-			if buffer[offset+dataLength] != 0xf7 {
-				dataLength -= 1
+			if !terminated {
+				return commands, payloads, fmt.Errorf("SysEx command is not terminated")
 			}
-			dataLength += 1
 		} else {
-			dataLength = midi.GetDataLength(statusByte)
+			if midi.GetCommandInfo(statusByte) == nil {
+				// undefined status bytes are ignored
+				continue
+			}
+			payloads = append(payloads, statusByte)
+			dataLength := midi.GetDataLength(statusByte)
+			for len(payloads)-start <= dataLength {
+				if offset >= end {
+					return commands, payloads, fmt.Errorf("Not enough buffer data to read additional %03d command bytes", dataLength+1-len(payloads)+start)
+				}
+				b := buffer[offset]
+				offset += 1
+				if midi.IsRealtime(b) {
+					emitRealtime(b)
+				} else if midi.IsStatus(b) {
+					return commands, payloads, fmt.Errorf("Command %X interrupted by unexpected status %X", statusByte, b)
+				} else {
+					payloads = append(payloads, b)
+				}
+			}
 		}
+		emit()
+	}
+	return commands, payloads, nil
+}
 
-		command.Payload = []byte{statusByte}
-
-		if len(buffer) < offset+dataLength {
-			// isValid = false
-			return commands, fmt.Errorf("Not enough buffer data to read additional %03d command bytes", dataLength)
-		}
-		if dataLength > 0 {
-			command.Payload = append(command.Payload, buffer[offset:offset+dataLength]...)
-			offset += dataLength
+// decodeDeltaTime decodes the variable length delta time starting at offset.
+// It returns the delta time in timestamp ticks and the offset of the succeeding octet.
+func decodeDeltaTime(buffer []byte, offset int, end int) (uint32, int, error) {
+	deltaTime := uint32(0)
+	for k := 0; k < 4; k++ {
+		if offset >= end {
+			return 0, offset, fmt.Errorf("Delta time exceeds the MIDI list")
 		}
-		if !(command.Payload[0] == 0xf0 && command.Payload[len(command.Payload)-1] != 0xf7) {
-			// fmt.Printf("Successfully parsed MIDI command %#v\n", command)
-			commands = append(commands, command)
-		} else {
-			continue
+		currentOctet := buffer[offset]
+		deltaTime <<= 7
+		deltaTime |= uint32(currentOctet) & deltaTimeMask
+		offset += 1
+		if currentOctet&deltaTimeHasNext == 0 {
+			break
 		}
 	}
-	// fmt.Printf("Found %3d commands\n", len(commands))
-	// for _, cmd := range commands {
-	// 	fmt.Println(hex.Dump(cmd.Payload))
-	// }
-	return commands, nil
+	return deltaTime, offset, nil
 }
 
 // Encode the MIDIMessage into a byte buffer.
-func Encode(m MIDIMessage, start time.Time) []byte {
-
-	b := new(bytes.Buffer)
+//
+// An error is returned if the MIDI list exceeds MaxMIDIListLength octets, such commands
+// have to be divided with MIDICommands.Split first.
+func Encode(m MIDIMessage, start time.Time) ([]byte, error) {
+	return AppendEncode(nil, m, start)
+}
 
-	b.WriteByte(firstByte)
-	b.WriteByte(secondByte)
-	binary.Write(b, binary.BigEndian, m.SequenceNumber)
+// AppendEncode appends the encoded MIDIMessage to dst and returns the extended buffer.
+//
+// Encoding into a buffer with sufficient capacity does not allocate.
+func AppendEncode(dst []byte, m MIDIMessage, start time.Time) ([]byte, error) {
+	dst = append(dst, firstByte, secondByte)
+	dst = binary.BigEndian.AppendUint16(dst, m.SequenceNumber)
 	ts := timestamp.Of(m.Commands.Timestamp, start).Uint32()
-	binary.Write(b, binary.BigEndian, uint32(ts))
-	binary.Write(b, binary.BigEndian, m.SSRC)
+	dst = binary.BigEndian.AppendUint32(dst, ts)
+	dst = binary.BigEndian.AppendUint32(dst, m.SSRC)
 
-	m.Commands.encode(b, start)
-
-	return b.Bytes()
+	return m.Commands.appendTo(dst, start)
 }
 
 func (m MIDIMessage) String() string {
@@ -399,43 +515,99 @@ const (
 	lenMask      = 0x0f // Mask for the length information
 )
 
-func (mcs MIDICommands) encode(w io.Writer, start time.Time) {
+func (mcs MIDICommands) encode(w io.Writer, start time.Time) error {
+	b, err := mcs.appendTo(nil, start)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// appendTo appends the MIDI command section to dst.
+func (mcs MIDICommands) appendTo(dst []byte, start time.Time) ([]byte, error) {
 	if len(mcs.Commands) == 0 {
-		w.Write([]byte{emtpyHeader})
-		return
+		return append(dst, emtpyHeader), nil
 	}
 	header := emtpyHeader
-	b := new(bytes.Buffer)
+	// reserve space for a big header
+	headerStart := len(dst)
+	dst = append(dst, emtpyHeader, emtpyHeader)
+	listStart := len(dst)
 
 	for i, mc := range mcs.Commands {
 		if i == 0 && mc.DeltaTime > 0 {
 			header = header | zeroDeltaBit
-			timestamp.EncodeDeltaTime(mcs.Timestamp, start, mc.DeltaTime, b)
+			dst = timestamp.AppendDeltaTime(dst, mcs.Timestamp, start, mc.DeltaTime)
 		}
 		if i > 0 {
-			timestamp.EncodeDeltaTime(mcs.Timestamp, start, mc.DeltaTime, b)
+			dst = timestamp.AppendDeltaTime(dst, mcs.Timestamp, start, mc.DeltaTime)
 		}
-		mc.Payload.encode(b)
+		dst = append(dst, mc.Payload...)
 	}
 
-	if b.Len() > 4095 {
-		// FIXME handle messages with size > 4095 octets (error and crop)
-	} else if b.Len() > 15 {
-		header = header | bigHeaderBit | (byte(b.Len()>>8) & lenMask)
-		count := byte(b.Len())
-		w.Write([]byte{header, count})
+	length := len(dst) - listStart
+	if length > MaxMIDIListLength {
+		return dst[:headerStart], fmt.Errorf("MIDI list of %d octets exceeds %d octets", length, MaxMIDIListLength)
+	} else if length > 15 {
+		dst[headerStart] = header | bigHeaderBit | (byte(length>>8) & lenMask)
+		dst[headerStart+1] = byte(length)
 	} else {
-		header = header | (byte(b.Len()) & lenMask)
-		w.Write([]byte{header})
+		// use the short header
+		dst[headerStart] = header | (byte(length) & lenMask)
+		copy(dst[headerStart+1:], dst[listStart:])
+		dst = dst[:len(dst)-1]
 	}
-
-	w.Write(b.Bytes())
+	return dst, nil
 }
 
-func (p MIDIPayload) encode(w io.Writer) {
-	// FIXME maybe this encoding is not correct
-	if len(p) == 0 {
-		return
+// Split divides the commands into parts which each fit into a single RTP packet.
+//
+// The MIDI list of every part respects the 12 bit LEN field of the MIDI command section.
+// If maxPacketSize is greater than 0, every part additionally encodes into an RTP packet of
+// at most maxPacketSize octets, which allows to avoid IP fragmentation.
+//
+// The Timestamp of a part is the time of its first command, so the first command of
+// every part but the first one has a DeltaTime of 0. SysEx commands which do not fit
+// into an empty packet are split into SysEx segments. Any other command which does not
+// fit is returned as a part on its own.
+func (mcs MIDICommands) Split(maxPacketSize int) []MIDICommands {
+	limit := MaxMIDIListLength
+	if maxPacketSize > 0 && maxPacketSize-packetOverhead < limit {
+		limit = maxPacketSize - packetOverhead
+	}
+
+	parts := make([]MIDICommands, 0, 1)
+	part := MIDICommands{Timestamp: mcs.Timestamp}
+	length := 0
+	t := mcs.Timestamp
+	add := func(mc MIDICommand) {
+		size := len(mc.Payload)
+		if len(part.Commands) > 0 || mc.DeltaTime > 0 {
+			size += timestamp.DeltaTimeLength(mc.DeltaTime)
+		}
+		if len(part.Commands) > 0 && length+size > limit {
+			parts = append(parts, part)
+			part = MIDICommands{Timestamp: t}
+			mc.DeltaTime = 0
+			size = len(mc.Payload)
+			length = 0
+		}
+		part.Commands = append(part.Commands, mc)
+		length += size
+	}
+
+	for _, mc := range mcs.Commands {
+		t = t.Add(mc.DeltaTime)
+		// leave room for the longest possible delta time
+		segments := mc.Payload.SysExSegments(limit - 4)
+		for i, segment := range segments {
+			if i > 0 {
+				mc.DeltaTime = 0
+			}
+			mc.Payload = segment
+			add(mc)
+		}
 	}
-	w.Write(p)
+	return append(parts, part)
 }
@@ -23,8 +23,9 @@ func Test_encode_of_message(t *testing.T) {
 	}
 
 	// when
-	b := Encode(m, start)
+	b, err := Encode(m, start)
 	// then
+	assert.Nil(t, err)
 	assert.Equal(t, []byte{
 		0x80, 0x61, 0xaa, 0xbb, // Header | Sequence Number
 		0x00, 0x00, 0x00, 0x01, // Timestamp
@@ -146,3 +147,276 @@ func Test_encode_of_mulitple_commands(t *testing.T) {
 		0x80, 0x3e, 0x00, // MIDI command (note off)
 	}, b.Bytes())
 }
+
+func Test_split_of_commands_exceeding_list_length(t *testing.T) {
+	// given
+	now := time.Now()
+	commands := make([]MIDICommand, 2500)
+	for i := range commands {
+		commands[i] = MIDICommand{Payload: []byte{0x90, byte(i % 128), 0x40}, DeltaTime: time.Millisecond}
+	}
+	mcs := MIDICommands{Commands: commands, Timestamp: now}
+	// when
+	parts := mcs.Split(0)
+	// then
+	assert.Equal(t, 3, len(parts))
+	total := 0
+	for _, part := range parts {
+		b := new(bytes.Buffer)
+		part.encode(b, now)
+		assert.True(t, b.Len() <= MaxMIDIListLength+2)
+		assert.Equal(t, byte(bigHeaderBit), b.Bytes()[0]&bigHeaderBit)
+		total += len(part.Commands)
+	}
+	assert.Equal(t, len(commands), total)
+	assert.Equal(t, now, parts[0].Timestamp)
+	assert.Equal(t, time.Millisecond, parts[0].Commands[0].DeltaTime)
+	first := len(parts[0].Commands)
+	assert.Equal(t, now.Add(time.Duration(first+1)*time.Millisecond), parts[1].Timestamp)
+	assert.Equal(t, time.Duration(0), parts[1].Commands[0].DeltaTime)
+	assert.Equal(t, time.Millisecond, parts[1].Commands[1].DeltaTime)
+}
+
+func Test_split_of_commands_with_max_packet_size(t *testing.T) {
+	// given
+	now := time.Now()
+	commands := make([]MIDICommand, 1000)
+	for i := range commands {
+		commands[i] = MIDICommand{Payload: []byte{0xb0, 0x07, byte(i % 128)}}
+	}
+	m := MIDIMessage{Commands: MIDICommands{Commands: commands, Timestamp: now}}
+	// when
+	parts := m.Commands.Split(1400)
+	// then
+	assert.Equal(t, 3, len(parts))
+	for _, part := range parts {
+		m.Commands = part
+		b, err := Encode(m, now)
+		assert.Nil(t, err)
+		assert.True(t, len(b) <= 1400)
+	}
+}
+
+func Test_split_of_small_commands(t *testing.T) {
+	// given
+	mcs := MIDICommands{Commands: []MIDICommand{{Payload: []byte{0x90, 0x3c, 0x40}}}}
+	// when
+	parts := mcs.Split(1400)
+	// then
+	assert.Equal(t, []MIDICommands{mcs}, parts)
+}
+
+func Test_encode_of_oversized_list_fails(t *testing.T) {
+	// given
+	now := time.Now()
+	commands := make([]MIDICommand, 1500)
+	for i := range commands {
+		commands[i] = MIDICommand{Payload: []byte{0x90, 0x3c, 0x40}}
+	}
+	m := MIDIMessage{Commands: MIDICommands{Commands: commands, Timestamp: now}}
+	// when
+	_, err := Encode(m, now)
+	// then
+	assert.NotNil(t, err)
+}
+
+func Test_encode_of_split_oversized_list_keeps_all_commands(t *testing.T) {
+	// given
+	now := time.Now()
+	commands := make([]MIDICommand, 1500)
+	for i := range commands {
+		commands[i] = MIDICommand{Payload: []byte{0x90, 0x3c, 0x40}}
+	}
+	m := MIDIMessage{Commands: MIDICommands{Commands: commands, Timestamp: now}}
+	// when
+	count := 0
+	for _, part := range m.Commands.Split(0) {
+		m.Commands = part
+		b, err := Encode(m, now)
+		assert.Nil(t, err)
+		decoded, err := Decode(b)
+		assert.Nil(t, err)
+		count += len(decoded.Commands.Commands)
+	}
+	// then
+	assert.Equal(t, len(commands), count)
+}
+
+func Test_decode_of_delta_times(t *testing.T) {
+	// given
+	b := []byte{
+		0x80, 0x61, 0xaa, 0xbb, // Header | Sequence Number
+		0x00, 0x00, 0x00, 0x01, // Timestamp
+		0xcc, 0xdd, 0xee, 0xff, // SRCC
+		0x29,             // MIDI command section header (Z=1, LEN=9)
+		0x0a,             // Delta time (10 ticks)
+		0x90, 0x3c, 0x40, // MIDI command (note on)
+		0xce, 0x10, // Delta time (10000 ticks)
+		0x80, 0x3c, 0x00, // MIDI command (note off)
+	}
+	// when
+	m, err := Decode(b)
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []MIDICommand{
+		{Payload: MIDIPayload{0x90, 0x3c, 0x40}, DeltaTime: time.Millisecond},
+		{Payload: MIDIPayload{0x80, 0x3c, 0x00}, DeltaTime: time.Second},
+	}, m.Commands.Commands)
+}
+
+func Test_delta_times_are_encoded_and_decoded_in_timestamp_ticks(t *testing.T) {
+	// given
+	start := time.Now()
+	m := MIDIMessage{Commands: MIDICommands{
+		Timestamp: start,
+		Commands: []MIDICommand{
+			{Payload: MIDIPayload{0x90, 0x3c, 0x40}},
+			{Payload: MIDIPayload{0x80, 0x3c, 0x00}, DeltaTime: time.Millisecond},
+		},
+	}}
+	// when
+	b, err := Encode(m, start)
+	assert.Nil(t, err)
+	decoded, err := Decode(b)
+	// then the delta time of 1 ms is sent as 10 ticks of 100 µs, not as milliseconds
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x07, 0x90, 0x3c, 0x40, 0x0a, 0x80, 0x3c, 0x00}, b[12:])
+	assert.Equal(t, m.Commands.Commands, decoded.Commands.Commands)
+}
+
+func Test_decode_of_running_status(t *testing.T) {
+	// given
+	b := []byte{
+		0x80, 0x61, 0xaa, 0xbb, // Header | Sequence Number
+		0x00, 0x00, 0x00, 0x01, // Timestamp
+		0xcc, 0xdd, 0xee, 0xff, // SRCC
+		0x0b,             // MIDI command section header
+		0x90, 0x3c, 0x40, // MIDI command (note on)
+		0x00,       // Delta time
+		0x3e, 0x40, // MIDI command (note on, running status)
+		0x00,       // Delta time
+		0xf6,       // MIDI command (tune request, cancels running status)
+		0x00,       // Delta time
+		0x40, 0x40, // Data without running status
+	}
+	// when
+	m, err := Decode(b)
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []MIDICommand{
+		{Payload: MIDIPayload{0x90, 0x3c, 0x40}},
+		{Payload: MIDIPayload{0x90, 0x3e, 0x40}},
+		{Payload: MIDIPayload{0xf6}},
+	}, m.Commands.Commands)
+}
+
+func Test_decode_of_interleaved_realtime_commands(t *testing.T) {
+	// given a packet modelled after a sequencer sending clock during notes and a SysEx dump
+	b := []byte{
+		0x80, 0x61, 0x5e, 0x1d, // Header | Sequence Number
+		0x00, 0x06, 0x4b, 0x3c, // Timestamp
+		0x6b, 0x54, 0x13, 0x0e, // SRCC
+		0x80, 0x1c, // MIDI command section header (B=1, LEN=28)
+		0xf8,                   // Clock
+		0x04,                   // Delta time
+		0xf8,                   // Clock
+		0x00,                   // Delta time
+		0x92, 0xf8, 0x3c, 0x64, // Note on interrupted by clock
+		0x00,             // Delta time
+		0x3e, 0xf8, 0x64, // Note on (running status) interrupted by clock
+		0x00,                   // Delta time
+		0xf0, 0x43, 0x10, 0xf8, // SysEx interrupted by clock
+		0x4c, 0x00, 0xfe, 0x00, // SysEx interrupted by active sensing
+		0x7e, 0x00, 0xf7, // SysEx end
+		0x04,             // Delta time
+		0x92, 0x40, 0x64, // Note on
+	}
+	// when
+	m, err := Decode(b)
+	// then
+	tick := 100 * time.Microsecond
+	assert.Nil(t, err)
+	assert.Equal(t, []MIDICommand{
+		{Payload: MIDIPayload{0xf8}},
+		{Payload: MIDIPayload{0xf8}, DeltaTime: 4 * tick},
+		{Payload: MIDIPayload{0xf8}},
+		{Payload: MIDIPayload{0x92, 0x3c, 0x64}},
+		{Payload: MIDIPayload{0xf8}},
+		{Payload: MIDIPayload{0x92, 0x3e, 0x64}},
+		{Payload: MIDIPayload{0xf8}},
+		{Payload: MIDIPayload{0xfe}},
+		{Payload: MIDIPayload{0xf0, 0x43, 0x10, 0x4c, 0x00, 0x00, 0x7e, 0x00, 0xf7}},
+		{Payload: MIDIPayload{0x92, 0x40, 0x64}, DeltaTime: 4 * tick},
+	}, m.Commands.Commands)
+}
+
+func Test_append_encode_reuses_buffer(t *testing.T) {
+	// given
+	start := time.Now()
+	m := clockAndNoteMessage(start)
+	buffer := make([]byte, 0, 1500)
+	// when
+	allocs := testing.AllocsPerRun(100, func() {
+		buffer, _ = AppendEncode(buffer[:0], m, start)
+	})
+	// then
+	assert.Equal(t, 0.0, allocs)
+	expected, _ := Encode(m, start)
+	assert.Equal(t, expected, buffer)
+}
+
+func Test_decode_into_reuses_message(t *testing.T) {
+	// given
+	start := time.Now()
+	b, _ := Encode(clockAndNoteMessage(start), start)
+	m := MIDIMessage{}
+	DecodeInto(&m, b)
+	// when
+	allocs := testing.AllocsPerRun(100, func() {
+		DecodeInto(&m, b)
+	})
+	// then
+	assert.Equal(t, 0.0, allocs)
+	expected, _ := Decode(b)
+	assert.Equal(t, expected.Commands.Commands, m.Commands.Commands)
+}
+
+func Benchmark_AppendEncode(b *testing.B) {
+	start := time.Now()
+	m := clockAndNoteMessage(start)
+	buffer := make([]byte, 0, 1500)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer, _ = AppendEncode(buffer[:0], m, start)
+	}
+}
+
+func Benchmark_DecodeInto(b *testing.B) {
+	start := time.Now()
+	buffer, _ := Encode(clockAndNoteMessage(start), start)
+	m := MIDIMessage{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DecodeInto(&m, buffer)
+	}
+}
+
+// clockAndNoteMessage returns a message with a MIDI clock followed by MPE note data
+func clockAndNoteMessage(start time.Time) MIDIMessage {
+	return MIDIMessage{
+		SequenceNumber: 0xaabb,
+		SSRC:           0xccddeeff,
+		Commands: MIDICommands{
+			Timestamp: start.Add(time.Second),
+			Commands: []MIDICommand{
+				{Payload: []byte{0xf8}},
+				{Payload: []byte{0x91, 0x3c, 0x40}},
+				{Payload: []byte{0xe1, 0x00, 0x42}, DeltaTime: time.Millisecond},
+				{Payload: []byte{0xd1, 0x50}},
+				{Payload: []byte{0xb1, 0x4a, 0x33}},
+			},
+		},
+	}
+}
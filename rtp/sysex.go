@@ -0,0 +1,178 @@
+package rtp
+
+import (
+	"log"
+	"time"
+)
+
+// SysEx status octets used to delimit SysEx commands and segments.
+const (
+	sysExStart  = 0xf0
+	sysExEnd    = 0xf7
+	sysExCancel = 0xf4
+)
+
+// SysExSegment identifies which part of a SysEx command a MIDIPayload contains.
+//
+// RFC 6295 allows to split a SysEx command into segments which are sent in
+// multiple MIDI commands, possibly in multiple RTP packets:
+//
+//	first segment:  F0 ... F0
+//	middle segment: F7 ... F0
+//	last segment:   F7 ... F7
+//	cancel:         F7 ... F4 (or F0 ... F4)
+//
+// see https://tools.ietf.org/html/rfc6295#section-3.2
+type SysExSegment uint8
+
+const (
+	// NoSysEx is any payload which is not part of a SysEx command.
+	NoSysEx SysExSegment = iota
+	// CompleteSysEx is an unsegmented SysEx command (F0 ... F7).
+	CompleteSysEx
+	// FirstSysExSegment starts a segmented SysEx command (F0 ... F0).
+	FirstSysExSegment
+	// MiddleSysExSegment continues a segmented SysEx command (F7 ... F0).
+	MiddleSysExSegment
+	// LastSysExSegment ends a segmented SysEx command (F7 ... F7).
+	LastSysExSegment
+	// CancelledSysEx cancels a segmented SysEx command (F7 ... F4).
+	CancelledSysEx
+)
+
+// NewSysExCancel returns the shortest segment which cancels a segmented SysEx command.
+func NewSysExCancel() MIDIPayload {
+	return MIDIPayload{sysExEnd, sysExCancel}
+}
+
+// Segment returns the kind of SysEx segment contained in the payload.
+func (p MIDIPayload) Segment() SysExSegment {
+	if len(p) < 2 || (p[0] != sysExStart && p[0] != sysExEnd) {
+		return NoSysEx
+	}
+	first, last := p[0], p[len(p)-1]
+	switch {
+	case last == sysExCancel:
+		return CancelledSysEx
+	case first == sysExStart && last == sysExEnd:
+		return CompleteSysEx
+	case first == sysExStart && last == sysExStart:
+		return FirstSysExSegment
+	case first == sysExEnd && last == sysExStart:
+		return MiddleSysExSegment
+	case first == sysExEnd && last == sysExEnd:
+		return LastSysExSegment
+	}
+	return NoSysEx
+}
+
+// SysExSegments splits a complete SysEx payload into segments of at most size octets.
+// Payloads which are no complete SysEx commands or which already fit are returned unchanged.
+func (p MIDIPayload) SysExSegments(size int) []MIDIPayload {
+	chunk := size - 2
+	if p.Segment() != CompleteSysEx || len(p) <= size || chunk < 1 {
+		return []MIDIPayload{p}
+	}
+	data := p[1 : len(p)-1]
+	segments := make([]MIDIPayload, 0, len(data)/chunk+1)
+	for start := 0; start < len(data); start += chunk {
+		end := start + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		segment := make(MIDIPayload, 0, end-start+2)
+		if start == 0 {
+			segment = append(segment, sysExStart)
+		} else {
+			segment = append(segment, sysExEnd)
+		}
+		segment = append(segment, data[start:end]...)
+		if end == len(data) {
+			segment = append(segment, sysExEnd)
+		} else {
+			segment = append(segment, sysExStart)
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// SysExReassembler collects the segments of SysEx commands received in one stream
+// and returns the complete SysEx commands.
+//
+// The zero value is ready to use and does neither limit the size nor the duration
+// of a segmented SysEx command.
+type SysExReassembler struct {
+	// MaxSize is the maximum size of a reassembled SysEx command in octets (0: unlimited).
+	MaxSize int
+	// Timeout is the maximum time between the first and the last segment (0: unlimited).
+	Timeout time.Duration
+
+	buffer   []byte
+	started  time.Time
+	pending  bool
+	overflow bool
+}
+
+// Reassemble processes the received command.
+//
+// Commands which are not SysEx segments and complete SysEx commands are returned as
+// they are. Segments are collected and the complete SysEx command is returned when the
+// last segment is received. The second return value is false if the command was consumed.
+func (r *SysExReassembler) Reassemble(mc MIDICommand, now time.Time) (MIDICommand, bool) {
+	if r.pending && r.Timeout > 0 && now.Sub(r.started) > r.Timeout {
+		log.Printf("Segmented SysEx timed out after %v, dropping %d octets", now.Sub(r.started), len(r.buffer))
+		r.reset()
+	}
+
+	p := mc.Payload
+	switch p.Segment() {
+	case FirstSysExSegment:
+		if r.pending {
+			log.Printf("Segmented SysEx not terminated, dropping %d octets", len(r.buffer))
+		}
+		r.reset()
+		r.pending = true
+		r.started = now
+		r.append(p[:len(p)-1])
+		return mc, false
+	case MiddleSysExSegment:
+		if r.pending {
+			r.append(p[1 : len(p)-1])
+		}
+		return mc, false
+	case LastSysExSegment:
+		if !r.pending {
+			return mc, false
+		}
+		r.append(p[1:])
+		complete := !r.overflow
+		mc.Payload = r.buffer
+		r.buffer = nil
+		r.reset()
+		return mc, complete
+	case CancelledSysEx:
+		r.reset()
+		return mc, false
+	}
+	return mc, true
+}
+
+func (r *SysExReassembler) append(data []byte) {
+	if r.overflow {
+		return
+	}
+	if r.MaxSize > 0 && len(r.buffer)+len(data) > r.MaxSize {
+		log.Printf("Segmented SysEx exceeds %d octets, dropping it", r.MaxSize)
+		r.overflow = true
+		r.buffer = r.buffer[:0]
+		return
+	}
+	r.buffer = append(r.buffer, data...)
+}
+
+func (r *SysExReassembler) reset() {
+	r.buffer = r.buffer[:0]
+	r.pending = false
+	r.overflow = false
+}
@@ -0,0 +1,142 @@
+package rtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_segment_of_payload(t *testing.T) {
+	assert.Equal(t, NoSysEx, MIDIPayload{0x90, 0x3c, 0x40}.Segment())
+	assert.Equal(t, CompleteSysEx, MIDIPayload{0xf0, 0x01, 0xf7}.Segment())
+	assert.Equal(t, FirstSysExSegment, MIDIPayload{0xf0, 0x01, 0xf0}.Segment())
+	assert.Equal(t, MiddleSysExSegment, MIDIPayload{0xf7, 0x01, 0xf0}.Segment())
+	assert.Equal(t, LastSysExSegment, MIDIPayload{0xf7, 0x01, 0xf7}.Segment())
+	assert.Equal(t, CancelledSysEx, NewSysExCancel().Segment())
+}
+
+func Test_sysex_segments(t *testing.T) {
+	// given
+	p := MIDIPayload{0xf0, 0x01, 0x02, 0x03, 0x04, 0x05, 0xf7}
+	// when
+	segments := p.SysExSegments(4)
+	// then
+	assert.Equal(t, []MIDIPayload{
+		{0xf0, 0x01, 0x02, 0xf0},
+		{0xf7, 0x03, 0x04, 0xf0},
+		{0xf7, 0x05, 0xf7},
+	}, segments)
+}
+
+func Test_sysex_segments_of_small_payload(t *testing.T) {
+	// given
+	p := MIDIPayload{0xf0, 0x01, 0xf7}
+	// when
+	segments := p.SysExSegments(4)
+	// then
+	assert.Equal(t, []MIDIPayload{p}, segments)
+}
+
+func Test_split_of_large_sysex(t *testing.T) {
+	// given
+	now := time.Now()
+	sysex := make(MIDIPayload, 10000)
+	sysex[0] = 0xf0
+	sysex[len(sysex)-1] = 0xf7
+	m := MIDIMessage{Commands: MIDICommands{
+		Commands:  []MIDICommand{{Payload: sysex}},
+		Timestamp: now,
+	}}
+	// when
+	parts := m.Commands.Split(1400)
+	// then
+	assert.Equal(t, 8, len(parts))
+	r := SysExReassembler{}
+	for i, part := range parts {
+		m.Commands = part
+		b, err := Encode(m, now)
+		assert.Nil(t, err)
+		assert.True(t, len(b) <= 1400)
+		decoded, err := Decode(b)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(decoded.Commands.Commands))
+		mc, complete := r.Reassemble(decoded.Commands.Commands[0], now)
+		assert.Equal(t, i == len(parts)-1, complete)
+		if complete {
+			assert.Equal(t, sysex, mc.Payload)
+		}
+	}
+}
+
+func Test_decode_of_sysex_segments(t *testing.T) {
+	// given
+	b := []byte{
+		0x80, 0x61, 0xaa, 0xbb, // Header | Sequence Number
+		0x00, 0x00, 0x00, 0x01, // Timestamp
+		0xcc, 0xdd, 0xee, 0xff, // SRCC
+		0x0a,                   // MIDI command section header
+		0xf0, 0x01, 0x02, 0xf0, // First segment
+		0x00,             // Delta time
+		0xf7, 0x03, 0xf4, // Cancel
+		0x00, // Delta time
+		0xf8, // Clock
+	}
+	// when
+	m, err := Decode(b)
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []MIDICommand{
+		{Payload: MIDIPayload{0xf0, 0x01, 0x02, 0xf0}},
+		{Payload: MIDIPayload{0xf7, 0x03, 0xf4}},
+		{Payload: MIDIPayload{0xf8}},
+	}, m.Commands.Commands)
+}
+
+func Test_reassembly_of_segmented_sysex(t *testing.T) {
+	// given
+	now := time.Now()
+	r := SysExReassembler{}
+	// when
+	_, first := r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf0, 0x01, 0xf0}}, now)
+	_, middle := r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf7, 0x02, 0xf0}}, now)
+	note, other := r.Reassemble(MIDICommand{Payload: MIDIPayload{0x90, 0x3c, 0x40}}, now)
+	mc, last := r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf7, 0x03, 0xf7}}, now)
+	// then
+	assert.False(t, first)
+	assert.False(t, middle)
+	assert.True(t, other)
+	assert.Equal(t, MIDIPayload{0x90, 0x3c, 0x40}, note.Payload)
+	assert.True(t, last)
+	assert.Equal(t, MIDIPayload{0xf0, 0x01, 0x02, 0x03, 0xf7}, mc.Payload)
+}
+
+func Test_reassembly_of_cancelled_sysex(t *testing.T) {
+	// given
+	now := time.Now()
+	r := SysExReassembler{}
+	// when
+	r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf0, 0x01, 0xf0}}, now)
+	r.Reassemble(MIDICommand{Payload: NewSysExCancel()}, now)
+	_, complete := r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf7, 0x03, 0xf7}}, now)
+	// then
+	assert.False(t, complete)
+}
+
+func Test_reassembly_respects_limits(t *testing.T) {
+	// given
+	now := time.Now()
+	r := SysExReassembler{MaxSize: 4, Timeout: time.Second}
+	// when
+	r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf0, 0x01, 0x02, 0xf0}}, now)
+	_, tooLarge := r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf7, 0x03, 0x04, 0xf7}}, now)
+	r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf0, 0x01, 0xf0}}, now)
+	_, timedOut := r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf7, 0x02, 0xf7}}, now.Add(2*time.Second))
+	r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf0, 0x01, 0xf0}}, now)
+	mc, complete := r.Reassemble(MIDICommand{Payload: MIDIPayload{0xf7, 0x02, 0xf7}}, now)
+	// then
+	assert.False(t, tooLarge)
+	assert.False(t, timedOut)
+	assert.True(t, complete)
+	assert.Equal(t, MIDIPayload{0xf0, 0x01, 0x02, 0xf7}, mc.Payload)
+}
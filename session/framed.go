@@ -0,0 +1,326 @@
+package session
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// maxFrameSize is the largest packet of a RFC 4571 frame
+	maxFrameSize = 0xffff
+	// dialTimeout limits the time to connect to a remote participant
+	dialTimeout = 2 * time.Second
+	// redialInterval is the time between attempts to reconnect a lost connection
+	redialInterval = time.Second
+	// maxLostAccepted limits the remembered addresses of lost accepted connections
+	maxLostAccepted = 256
+)
+
+// FramedConn is a net.PacketConn exchanging packets over TCP connections. Each packet is
+// framed as specified by RFC 4571 with its length as 16 bit unsigned integer.
+//
+// Packets are received from all accepted and dialed connections. Writing to an unknown
+// address dials the address. Lost dialed connections are reconnected in the background,
+// writes to the address fail until the connection is established again. The addresses of
+// the latest lost accepted connections are never dialed, writes to them fail.
+//
+// see https://tools.ietf.org/html/rfc4571
+type FramedConn struct {
+	listener net.Listener
+
+	mutex sync.Mutex
+	peers map[string]*framedPeer
+	// lostAccepted are the addresses of the latest maxLostAccepted lost accepted connections,
+	// lostOrder is the ring of these addresses in the order they were lost
+	lostAccepted  map[string]bool
+	lostOrder     []string
+	lostNext      int
+	frames        chan frame
+	deadline      time.Time
+	writeDeadline time.Time
+	// reconnected is called with the address of a redialed connection
+	reconnected func(addr net.Addr)
+	closed      chan struct{}
+	once        sync.Once
+}
+
+type framedPeer struct {
+	conn   net.Conn
+	dialed bool
+	mutex  sync.Mutex
+}
+
+type frame struct {
+	payload []byte
+	addr    net.Addr
+}
+
+// ListenFramed accepts TCP connections on the address, e.g. ":5004".
+func ListenFramed(address string) (*FramedConn, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	c := &FramedConn{
+		listener:     listener,
+		peers:        map[string]*framedPeer{},
+		lostAccepted: map[string]bool{},
+		frames:       make(chan frame, 64),
+		closed:       make(chan struct{}),
+	}
+	go c.accept()
+	return c, nil
+}
+
+// ReadFrom reads the next packet received from any connection.
+// Packets larger than the buffer are truncated.
+func (c *FramedConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mutex.Lock()
+	deadline := c.deadline
+	c.mutex.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case f := <-c.frames:
+		return copy(b, f.payload), f.addr, nil
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// WriteTo writes the packet to the connection of the address, which is dialed if the
+// address is unknown.
+func (c *FramedConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if len(b) > maxFrameSize {
+		return 0, fmt.Errorf("packet of %d bytes exceeds the frame size", len(b))
+	}
+	p, err := c.peer(addr)
+	if err != nil {
+		return 0, err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.conn == nil {
+		if p.dialed {
+			return 0, fmt.Errorf("reconnecting to %v", addr)
+		}
+		return 0, fmt.Errorf("connection from %v lost", addr)
+	}
+	c.mutex.Lock()
+	deadline := c.writeDeadline
+	c.mutex.Unlock()
+	if err := p.conn.SetWriteDeadline(deadline); err != nil {
+		return 0, err
+	}
+	buff := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(b)), uint16(len(b)))
+	if _, err := p.conn.Write(append(buff, b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the listener and all connections.
+func (c *FramedConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.listener.Close()
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for _, p := range c.peers {
+			p.mutex.Lock()
+			if p.conn != nil {
+				p.conn.Close()
+			}
+			p.mutex.Unlock()
+		}
+	})
+	return nil
+}
+
+// LocalAddr returns the address of the listener.
+func (c *FramedConn) LocalAddr() net.Addr {
+	return c.listener.Addr()
+}
+
+// SetDeadline sets the read and the write deadline.
+func (c *FramedConn) SetDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.deadline = t
+	c.writeDeadline = t
+	return nil
+}
+
+// SetReadDeadline sets the deadline of ReadFrom.
+func (c *FramedConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.deadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of WriteTo, including the dialing of unknown addresses.
+func (c *FramedConn) SetWriteDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *FramedConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// peer returns the peer of the address, dialing it if there is no connection yet.
+func (c *FramedConn) peer(addr net.Addr) (*framedPeer, error) {
+	c.mutex.Lock()
+	p, found := c.peers[addr.String()]
+	lost := c.lostAccepted[addr.String()]
+	deadline := c.writeDeadline
+	c.mutex.Unlock()
+	if found {
+		return p, nil
+	}
+	if lost {
+		return nil, fmt.Errorf("connection from %v lost", addr)
+	}
+	dialer := net.Dialer{Timeout: dialTimeout, Deadline: deadline}
+	conn, err := dialer.Dial("tcp", addr.String())
+	if err != nil {
+		return nil, err
+	}
+	p = &framedPeer{conn: conn, dialed: true}
+	c.mutex.Lock()
+	if existing, found := c.peers[addr.String()]; found {
+		// connected concurrently
+		c.mutex.Unlock()
+		conn.Close()
+		return existing, nil
+	}
+	c.peers[addr.String()] = p
+	c.mutex.Unlock()
+	go c.read(p, conn, addr)
+	return p, nil
+}
+
+func (c *FramedConn) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			if !c.isClosed() {
+				log.Printf("Accepting TCP connections failed: %v", err)
+			}
+			return
+		}
+		addr := conn.RemoteAddr()
+		p := &framedPeer{conn: conn}
+		c.mutex.Lock()
+		c.peers[addr.String()] = p
+		c.mutex.Unlock()
+		go c.read(p, conn, addr)
+	}
+}
+
+// read receives the frames of the connection until it is closed.
+func (c *FramedConn) read(p *framedPeer, conn net.Conn, addr net.Addr) {
+	header := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			c.lost(p, conn, addr, err)
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint16(header))
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			c.lost(p, conn, addr, err)
+			return
+		}
+		select {
+		case c.frames <- frame{payload: payload, addr: addr}:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// lost reconnects dialed connections. Lost accepted connections are removed, their address
+// is remembered so that it is not dialed.
+func (c *FramedConn) lost(p *framedPeer, conn net.Conn, addr net.Addr, err error) {
+	conn.Close()
+	if c.isClosed() {
+		return
+	}
+	if !errors.Is(err, io.EOF) {
+		log.Printf("TCP connection to %v lost: %v", addr, err)
+	}
+	p.mutex.Lock()
+	p.conn = nil
+	p.mutex.Unlock()
+	if p.dialed {
+		go c.redial(p, addr)
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.peers[addr.String()] == p {
+		delete(c.peers, addr.String())
+	}
+	c.rememberLost(addr.String())
+}
+
+// rememberLost records the address of a lost accepted connection, forgetting the address
+// lost first when maxLostAccepted addresses are recorded. The mutex must be held.
+func (c *FramedConn) rememberLost(addr string) {
+	if c.lostAccepted[addr] {
+		return
+	}
+	if len(c.lostOrder) < maxLostAccepted {
+		c.lostOrder = append(c.lostOrder, addr)
+	} else {
+		delete(c.lostAccepted, c.lostOrder[c.lostNext])
+		c.lostOrder[c.lostNext] = addr
+		c.lostNext = (c.lostNext + 1) % maxLostAccepted
+	}
+	c.lostAccepted[addr] = true
+}
+
+// redial reconnects the dialed connection until it is established or the FramedConn is closed.
+func (c *FramedConn) redial(p *framedPeer, addr net.Addr) {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(redialInterval):
+		}
+		conn, err := net.DialTimeout("tcp", addr.String(), dialTimeout)
+		if err != nil {
+			continue
+		}
+		log.Printf("TCP connection to %v reconnected", addr)
+		p.mutex.Lock()
+		p.conn = conn
+		p.mutex.Unlock()
+		go c.read(p, conn, addr)
+		if c.reconnected != nil {
+			c.reconnected(addr)
+		}
+		return
+	}
+}
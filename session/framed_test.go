@@ -0,0 +1,151 @@
+package session
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listenFramed(t *testing.T) *FramedConn {
+	c, err := ListenFramed("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func Test_framed_packets_in_both_directions(t *testing.T) {
+	// given
+	a := listenFramed(t)
+	b := listenFramed(t)
+	buffer := make([]byte, 16)
+	// when
+	_, err := b.WriteTo([]byte{0xff, 0xff, 0x49, 0x4e}, a.LocalAddr())
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	n, from, readErr := a.ReadFrom(buffer)
+	_, replyErr := a.WriteTo([]byte{0x80, 0x61}, from)
+	b.SetReadDeadline(time.Now().Add(time.Second))
+	m, _, replyReadErr := b.ReadFrom(buffer[n:])
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, readErr)
+	assert.NoError(t, replyErr)
+	assert.NoError(t, replyReadErr)
+	assert.Equal(t, []byte{0xff, 0xff, 0x49, 0x4e, 0x80, 0x61}, buffer[:n+m])
+}
+
+func Test_framed_read_deadline(t *testing.T) {
+	// given
+	a := listenFramed(t)
+	a.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	// when
+	_, _, err := a.ReadFrom(make([]byte, 16))
+	// then
+	ne, ok := err.(net.Error)
+	assert.True(t, ok)
+	assert.True(t, ne.Timeout())
+}
+
+func Test_framed_reconnect_of_dialed_connection(t *testing.T) {
+	// given
+	a := listenFramed(t)
+	b := listenFramed(t)
+	b.WriteTo([]byte{1}, a.LocalAddr())
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	_, from, _ := a.ReadFrom(make([]byte, 16))
+	b.mutex.Lock()
+	dialed := b.peers[a.LocalAddr().String()]
+	b.mutex.Unlock()
+	lost := dialed.conn
+	// when
+	a.mutex.Lock()
+	a.peers[from.String()].conn.Close()
+	a.mutex.Unlock()
+	// then
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		dialed.mutex.Lock()
+		reconnected := dialed.conn != nil && dialed.conn != lost
+		dialed.mutex.Unlock()
+		if reconnected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection not reestablished")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	_, err := b.WriteTo([]byte{2}, a.LocalAddr())
+	assert.NoError(t, err)
+	buffer := make([]byte, 16)
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := a.ReadFrom(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, buffer[:n])
+}
+
+func Test_framed_no_dial_of_lost_accepted_connection(t *testing.T) {
+	// given
+	a := listenFramed(t)
+	client, err := net.Dial("tcp", a.LocalAddr().String())
+	assert.NoError(t, err)
+	client.Write([]byte{0x00, 0x01, 0x01})
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	_, from, _ := a.ReadFrom(make([]byte, 16))
+	// when
+	client.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		a.mutex.Lock()
+		_, found := a.peers[from.String()]
+		a.mutex.Unlock()
+		if !found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection not lost")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = a.WriteTo([]byte{2}, from)
+	// then
+	assert.Error(t, err)
+	a.mutex.Lock()
+	assert.Equal(t, 0, len(a.peers))
+	a.mutex.Unlock()
+}
+
+func Test_framed_remembers_latest_lost_accepted_connections(t *testing.T) {
+	// given
+	a := listenFramed(t)
+	// when
+	a.mutex.Lock()
+	for port := 0; port <= maxLostAccepted; port++ {
+		a.rememberLost(fmt.Sprintf("127.0.0.1:%d", 20000+port))
+	}
+	a.mutex.Unlock()
+	// then
+	assert.Equal(t, maxLostAccepted, len(a.lostAccepted))
+	assert.False(t, a.lostAccepted["127.0.0.1:20000"])
+	assert.True(t, a.lostAccepted["127.0.0.1:20001"])
+	assert.True(t, a.lostAccepted[fmt.Sprintf("127.0.0.1:%d", 20000+maxLostAccepted)])
+}
+
+func Test_framed_write_deadline(t *testing.T) {
+	// given
+	a := listenFramed(t)
+	b := listenFramed(t)
+	_, err := b.WriteTo([]byte{1}, a.LocalAddr())
+	assert.NoError(t, err)
+	// when
+	b.SetWriteDeadline(time.Now().Add(-time.Second))
+	_, err = b.WriteTo([]byte{2}, a.LocalAddr())
+	// then
+	ne, ok := err.(net.Error)
+	assert.True(t, ok)
+	assert.True(t, ne.Timeout())
+}
@@ -0,0 +1,150 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/sip"
+	"github.com/laenzlinger/go-midi-rtp/timestamp"
+)
+
+const (
+	// inviteAttempts is the number of invitations sent before giving up
+	inviteAttempts = 12
+	// inviteInterval is the time to wait for the answer to an invitation
+	inviteInterval = 1500 * time.Millisecond
+	// syncInterval is the time between the clock synchronizations of initiated streams
+	syncInterval = 10 * time.Second
+)
+
+// Invite initiates a stream to the remote session with the control port given by the address,
+// the data port is the following port. It returns when the remote participant accepted the
+// invitation on both ports, or with an error if it rejected or did not answer the invitation.
+//
+// The session synchronizes the clocks of the initiated stream periodically.
+func (s *MIDINetworkSession) Invite(addr *net.UDPAddr) (*MIDINetworkStream, error) {
+	data := &net.UDPAddr{IP: addr.IP, Port: addr.Port + 1, Zone: addr.Zone}
+	return s.InviteAddr(addr, data)
+}
+
+// InviteAddr works like Invite for remote sessions with arbitrary control and data addresses.
+// Sessions of this library started WithSinglePort are invited with the same control and data address.
+func (s *MIDINetworkSession) InviteAddr(control, data net.Addr) (*MIDINetworkStream, error) {
+	accepted, err := s.sendInvitation(control, s.controlPc)
+	if err != nil {
+		return nil, err
+	}
+	conn := s.newStream(accepted.SSRC, accepted.Name)
+	conn.Host.ControlAddr = control
+	conn.Host.ControlPc = s.controlPc
+	conn.State = controlChannelEstablished
+
+	if _, err = s.sendInvitation(data, s.dataPc); err != nil {
+		conn.sendConnectionEnd(control, s.controlPc)
+		return nil, err
+	}
+	conn.Host.MIDIAddr = data
+	conn.Host.MIDIPc = s.dataPc
+	conn.State = ready
+	s.connections.Store(conn.RemoteSSRC, conn)
+	log.Printf("Connection established to remote participant %s SSRC [%x]", conn.Host.BonjourName, conn.RemoteSSRC)
+
+	go conn.synchronize()
+	return conn, nil
+}
+
+// reinvite invites the remote participants of the streams initiated to the control address
+// again, after their TCP connection was reestablished. A restarted remote session has no
+// stream to this session, the invitation creates it. The stream is replaced by the stream
+// of the new invitation.
+func (s *MIDINetworkSession) reinvite(addr net.Addr) {
+	for _, conn := range s.Streams() {
+		control, _ := conn.control()
+		if control == nil || control.String() != addr.String() {
+			continue
+		}
+		data, _ := conn.data()
+		log.Printf("Inviting %s SSRC [%x] again", conn.Host.BonjourName, conn.RemoteSSRC)
+		invited, err := s.InviteAddr(control, data)
+		if err != nil {
+			log.Printf("Inviting %s again failed: %v", conn.Host.BonjourName, err)
+			continue
+		}
+		if invited.RemoteSSRC != conn.RemoteSSRC {
+			conn.handleEnd()
+		}
+	}
+}
+
+// sendInvitation sends an invitation until it is answered. Each invitation has its own
+// token, so that answers to the invitation on the control port are not mistaken for answers
+// on the data port.
+func (s *MIDINetworkSession) sendInvitation(addr net.Addr, pc net.PacketConn) (sip.ControlMessage, error) {
+	in := sip.ControlMessage{
+		Cmd:   sip.Invitation,
+		Token: rand.Uint32(),
+		SSRC:  s.SSRC,
+		Name:  s.BonjourName,
+	}
+	answers := make(chan sip.ControlMessage, 1)
+	s.invitations.Store(in.Token, answers)
+	defer s.invitations.Delete(in.Token)
+
+	buff, err := sip.Encode(in)
+	if err != nil {
+		return sip.ControlMessage{}, err
+	}
+	for attempt := 0; attempt < inviteAttempts; attempt++ {
+		if _, err := pc.WriteTo(buff, addr); err != nil {
+			return sip.ControlMessage{}, err
+		}
+		log.Printf("<- outgoing message: %v", in)
+		select {
+		case answer := <-answers:
+			if answer.Cmd == sip.InvitationRejected {
+				return answer, fmt.Errorf("invitation rejected by %v", addr)
+			}
+			return answer, nil
+		case <-time.After(inviteInterval):
+		}
+	}
+	return sip.ControlMessage{}, fmt.Errorf("invitation to %v not answered", addr)
+}
+
+// handleInvitationReply passes the answer to an invitation sent by the session to the waiting
+// Invite. Returns false if the message is no answer to a pending invitation.
+func (s *MIDINetworkSession) handleInvitationReply(msg sip.ControlMessage) bool {
+	if msg.Cmd != sip.InvitationAccepted && msg.Cmd != sip.InvitationRejected {
+		return false
+	}
+	v, found := s.invitations.Load(msg.Token)
+	if !found {
+		return false
+	}
+	select {
+	case v.(chan sip.ControlMessage) <- msg:
+	default:
+		// the answer to a repeated invitation
+	}
+	return true
+}
+
+// synchronize starts the clock synchronization periodically until the stream ends.
+func (conn *MIDINetworkStream) synchronize() {
+	for {
+		if current, found := conn.Session.Stream(conn.RemoteSSRC); !found || current != conn {
+			return
+		}
+		ck := sip.ControlMessage{
+			Cmd:        sip.Synchronization,
+			SSRC:       conn.Session.SSRC,
+			Timestamps: []uint64{timestamp.Now(conn.Session.StartTime).Uint64()},
+		}
+		addr, pc := conn.data()
+		conn.sendControlMessage(ck, addr, pc)
+		time.Sleep(syncInterval)
+	}
+}
@@ -0,0 +1,212 @@
+package session
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+)
+
+// jitterBuffer delays received messages to release them at the time they were sent plus a
+// playout delay. Messages are released ordered by their sequence number, duplicates and
+// messages arriving after a later message was released are dropped.
+type jitterBuffer struct {
+	minDelay time.Duration
+	maxDelay time.Duration
+	adaptive bool
+	deliver  func(rtp.MIDIMessage)
+
+	mutex sync.Mutex
+	queue []bufferedMessage
+	// jitter is the interarrival jitter estimated as specified by RFC 3550
+	jitter       time.Duration
+	lastTransit  time.Duration
+	transitKnown bool
+	lastReleased uint16
+	released     bool
+	wake         chan struct{}
+	stop         chan struct{}
+	startOnce    sync.Once
+	stopOnce     sync.Once
+	// drain releases the buffered messages before stopping and calling final
+	drain bool
+	final func()
+}
+
+type bufferedMessage struct {
+	msg     rtp.MIDIMessage
+	release time.Time
+}
+
+// adaptiveJitterFactor is the number of jitter estimates added to the minimum playout delay
+const adaptiveJitterFactor = 3
+
+func newJitterBuffer(minDelay, maxDelay time.Duration, adaptive bool, deliver func(rtp.MIDIMessage)) *jitterBuffer {
+	return &jitterBuffer{
+		minDelay: minDelay,
+		maxDelay: maxDelay,
+		adaptive: adaptive,
+		deliver:  deliver,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// delay returns the current playout delay.
+func (jb *jitterBuffer) delay() time.Duration {
+	if !jb.adaptive {
+		return jb.minDelay
+	}
+	d := jb.minDelay + adaptiveJitterFactor*jb.jitter
+	if d > jb.maxDelay {
+		return jb.maxDelay
+	}
+	return d
+}
+
+// push adds the message which arrived at the given time. The Timestamp of the commands is
+// the time the message was sent, if the clocks are synchronized. Otherwise the arrival time
+// is used. Returns false if the message is dropped.
+func (jb *jitterBuffer) push(msg rtp.MIDIMessage, arrival time.Time, synchronized bool) bool {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	seq := msg.SequenceNumber
+	if jb.released && !sequenceBefore(jb.lastReleased, seq) {
+		return false
+	}
+	i := sort.Search(len(jb.queue), func(i int) bool {
+		return !sequenceBefore(jb.queue[i].msg.SequenceNumber, seq)
+	})
+	if i < len(jb.queue) && jb.queue[i].msg.SequenceNumber == seq {
+		return false
+	}
+
+	sent := arrival
+	if synchronized {
+		sent = msg.Commands.Timestamp
+		jb.estimateJitter(arrival.Sub(sent))
+	}
+	jb.queue = append(jb.queue, bufferedMessage{})
+	copy(jb.queue[i+1:], jb.queue[i:])
+	jb.queue[i] = bufferedMessage{msg: copyMessage(msg), release: sent.Add(jb.delay())}
+
+	select {
+	case jb.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (jb *jitterBuffer) estimateJitter(transit time.Duration) {
+	if jb.transitKnown {
+		d := transit - jb.lastTransit
+		if d < 0 {
+			d = -d
+		}
+		jb.jitter += (d - jb.jitter) / 16
+	}
+	jb.lastTransit = transit
+	jb.transitKnown = true
+}
+
+// pop removes the next message if it is due at now, or returns the time to wait for it.
+func (jb *jitterBuffer) pop(now time.Time) (rtp.MIDIMessage, bool, time.Duration) {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	if len(jb.queue) == 0 {
+		return rtp.MIDIMessage{}, false, time.Hour
+	}
+	next := jb.queue[0]
+	if wait := next.release.Sub(now); wait > 0 {
+		return rtp.MIDIMessage{}, false, wait
+	}
+	jb.queue[0] = bufferedMessage{}
+	jb.queue = jb.queue[1:]
+	jb.lastReleased = next.msg.SequenceNumber
+	jb.released = true
+	return next.msg, true, 0
+}
+
+// start starts releasing the messages to deliver, if not yet started.
+func (jb *jitterBuffer) start() {
+	jb.startOnce.Do(func() { go jb.run() })
+}
+
+func (jb *jitterBuffer) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	stop := jb.stop
+	for {
+		msg, ok, wait := jb.pop(time.Now())
+		if ok {
+			jb.deliver(msg)
+			continue
+		}
+		if stop == nil && jb.empty() {
+			if jb.final != nil {
+				jb.final()
+			}
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-stop:
+			if !jb.drain {
+				return
+			}
+			// a nil channel blocks, the buffered messages are released at their time
+			stop = nil
+		case <-jb.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+func (jb *jitterBuffer) empty() bool {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+	return len(jb.queue) == 0
+}
+
+// close stops releasing messages, the buffered messages are dropped.
+func (jb *jitterBuffer) close() {
+	jb.stopOnce.Do(func() { close(jb.stop) })
+}
+
+// end releases the buffered messages at their time and calls final on the goroutine
+// delivering the messages, before it stops.
+func (jb *jitterBuffer) end(final func()) {
+	jb.stopOnce.Do(func() {
+		jb.drain, jb.final = true, final
+		close(jb.stop)
+	})
+	jb.start()
+}
+
+// sequenceBefore compares 16 bit sequence numbers considering the wrap around.
+func sequenceBefore(a, b uint16) bool {
+	return int16(a-b) < 0
+}
+
+// copyMessage copies the commands of the message, as the payloads of received messages
+// are reused for the succeeding messages.
+func copyMessage(msg rtp.MIDIMessage) rtp.MIDIMessage {
+	commands := make([]rtp.MIDICommand, len(msg.Commands.Commands))
+	for i, mc := range msg.Commands.Commands {
+		commands[i] = rtp.MIDICommand{
+			DeltaTime: mc.DeltaTime,
+			Payload:   append(rtp.MIDIPayload(nil), mc.Payload...),
+		}
+	}
+	msg.Commands.Commands = commands
+	return msg
+}
@@ -0,0 +1,135 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func sentAt(seq uint16, sent time.Time) rtp.MIDIMessage {
+	return rtp.MIDIMessage{SequenceNumber: seq, Commands: rtp.MIDICommands{Timestamp: sent}}
+}
+
+func Test_jitter_buffer_releases_after_playout_delay(t *testing.T) {
+	// given
+	jb := newJitterBuffer(10*time.Millisecond, 10*time.Millisecond, false, nil)
+	sent := time.Now()
+	// when
+	jb.push(sentAt(1, sent), sent.Add(3*time.Millisecond), true)
+	_, early, wait := jb.pop(sent.Add(5 * time.Millisecond))
+	msg, due, _ := jb.pop(sent.Add(10 * time.Millisecond))
+	// then
+	assert.False(t, early)
+	assert.Equal(t, 5*time.Millisecond, wait)
+	assert.True(t, due)
+	assert.Equal(t, uint16(1), msg.SequenceNumber)
+}
+
+func Test_jitter_buffer_reorders_by_sequence_number(t *testing.T) {
+	// given
+	jb := newJitterBuffer(10*time.Millisecond, 10*time.Millisecond, false, nil)
+	sent := time.Now()
+	// when
+	jb.push(sentAt(0, sent.Add(time.Millisecond)), sent.Add(2*time.Millisecond), true)
+	jb.push(sentAt(0xffff, sent), sent.Add(3*time.Millisecond), true)
+	first, _, _ := jb.pop(sent.Add(20 * time.Millisecond))
+	second, _, _ := jb.pop(sent.Add(20 * time.Millisecond))
+	// then
+	assert.Equal(t, uint16(0xffff), first.SequenceNumber)
+	assert.Equal(t, uint16(0), second.SequenceNumber)
+}
+
+func Test_jitter_buffer_drops_duplicate_and_late_messages(t *testing.T) {
+	// given
+	jb := newJitterBuffer(10*time.Millisecond, 10*time.Millisecond, false, nil)
+	sent := time.Now()
+	jb.push(sentAt(5, sent), sent, true)
+	// when
+	duplicate := jb.push(sentAt(5, sent), sent, true)
+	jb.pop(sent.Add(10 * time.Millisecond))
+	late := jb.push(sentAt(4, sent), sent.Add(11*time.Millisecond), true)
+	released := jb.push(sentAt(5, sent), sent.Add(11*time.Millisecond), true)
+	// then
+	assert.False(t, duplicate)
+	assert.False(t, late)
+	assert.False(t, released)
+	assert.True(t, jb.push(sentAt(6, sent), sent.Add(11*time.Millisecond), true))
+}
+
+func Test_adaptive_jitter_buffer_increases_delay_with_jitter(t *testing.T) {
+	// given
+	jb := newJitterBuffer(2*time.Millisecond, 20*time.Millisecond, true, nil)
+	sent := time.Now()
+	initial := jb.delay()
+	// when
+	for i := 0; i < 50; i++ {
+		transit := time.Millisecond
+		if i%2 == 0 {
+			transit = 9 * time.Millisecond
+		}
+		s := sent.Add(time.Duration(i) * 10 * time.Millisecond)
+		jb.push(sentAt(uint16(i), s), s.Add(transit), true)
+	}
+	// then
+	assert.Equal(t, 2*time.Millisecond, initial)
+	assert.Equal(t, 20*time.Millisecond, jb.delay())
+}
+
+func Test_jitter_buffer_without_synchronization_uses_arrival_time(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	jb := newJitterBuffer(5*time.Millisecond, 5*time.Millisecond, false, func(msg rtp.MIDIMessage) {
+		received <- msg
+	})
+	jb.start()
+	defer jb.close()
+	arrival := time.Now()
+	// when
+	jb.push(sentAt(1, time.Time{}), arrival, false)
+	msg := <-received
+	// then
+	assert.Equal(t, uint16(1), msg.SequenceNumber)
+	assert.False(t, time.Now().Before(arrival.Add(5*time.Millisecond)))
+}
+
+func Test_jitter_buffer_copies_reused_payloads(t *testing.T) {
+	// given
+	jb := newJitterBuffer(10*time.Millisecond, 10*time.Millisecond, false, nil)
+	sent := time.Now()
+	msg := sentAt(1, sent)
+	payload := rtp.MIDIPayload{0x90, 0x3c, 0x40}
+	msg.Commands.Commands = []rtp.MIDICommand{{Payload: payload}}
+	// when
+	jb.push(msg, sent, true)
+	payload[1] = 0x3e
+	released, _, _ := jb.pop(sent.Add(10 * time.Millisecond))
+	// then
+	assert.Equal(t, rtp.MIDIPayload{0x90, 0x3c, 0x40}, released.Commands.Commands[0].Payload)
+}
+
+func Test_jitter_buffer_end_releases_buffered_messages_before_final(t *testing.T) {
+	// given
+	delivered := []uint16{}
+	done := make(chan struct{})
+	jb := newJitterBuffer(10*time.Millisecond, 10*time.Millisecond, false, func(msg rtp.MIDIMessage) {
+		delivered = append(delivered, msg.SequenceNumber)
+	})
+	sent := time.Now()
+	jb.start()
+	jb.push(sentAt(1, sent), sent, true)
+	jb.push(sentAt(2, sent), sent, true)
+	// when
+	jb.end(func() {
+		delivered = append(delivered, 0)
+		close(done)
+	})
+	// then
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("final not called")
+	}
+	assert.Equal(t, []uint16{1, 2, 0}, delivered)
+}
@@ -0,0 +1,228 @@
+package session
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+)
+
+// EventID identifies commands enqueued in a Scheduler.
+type EventID uint64
+
+// Scheduler sends MIDI commands at their target time.
+//
+// Commands are sent Lookahead before their target time, the RTP timestamp of the packet is
+// the target time. Commands which are due within Window of the earliest due command are
+// sent together in one packet using delta times.
+type Scheduler struct {
+	send      func(rtp.MIDICommands)
+	window    time.Duration
+	lookahead time.Duration
+
+	mutex    sync.Mutex
+	queue    scheduledQueue
+	events   map[EventID][]*scheduled
+	nextID   EventID
+	serial   uint64
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type scheduled struct {
+	at      time.Time
+	serial  uint64
+	id      EventID
+	payload rtp.MIDIPayload
+	index   int
+}
+
+// NewScheduler creates a Scheduler sending to all MIDINetworkStreams of the session.
+func (s *MIDINetworkSession) NewScheduler(window, lookahead time.Duration) *Scheduler {
+	return newScheduler(s.SendMIDICommands, window, lookahead)
+}
+
+// NewScheduler creates a Scheduler sending to the selected MIDINetworkStreams.
+func (sel *Selection) NewScheduler(window, lookahead time.Duration) *Scheduler {
+	return newScheduler(sel.SendMIDICommands, window, lookahead)
+}
+
+func newScheduler(send func(rtp.MIDICommands), window, lookahead time.Duration) *Scheduler {
+	sch := &Scheduler{
+		send:      send,
+		window:    window,
+		lookahead: lookahead,
+		events:    map[EventID][]*scheduled{},
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+	go sch.loop()
+	return sch
+}
+
+// Schedule enqueues the payloads to be sent at the given time.
+func (sch *Scheduler) Schedule(at time.Time, payloads ...rtp.MIDIPayload) EventID {
+	mcs := rtp.MIDICommands{Timestamp: at}
+	for _, p := range payloads {
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{Payload: p})
+	}
+	return sch.ScheduleCommands(mcs)
+}
+
+// ScheduleCommands enqueues the commands to be sent at the time given by the
+// Timestamp and the delta times of the commands.
+// The commands are cancelled together with the returned EventID.
+func (sch *Scheduler) ScheduleCommands(mcs rtp.MIDICommands) EventID {
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+
+	sch.nextID++
+	id := sch.nextID
+	at := mcs.Timestamp
+	for _, mc := range mcs.Commands {
+		at = at.Add(mc.DeltaTime)
+		sch.serial++
+		e := &scheduled{at: at, serial: sch.serial, id: id, payload: mc.Payload}
+		heap.Push(&sch.queue, e)
+		sch.events[id] = append(sch.events[id], e)
+	}
+	sch.notify()
+	return id
+}
+
+// Cancel removes the pending commands of the event.
+// Returns false if there are no pending commands, e.g. because they were already sent.
+func (sch *Scheduler) Cancel(id EventID) bool {
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+
+	events, found := sch.events[id]
+	if !found {
+		return false
+	}
+	for _, e := range events {
+		if e.index >= 0 {
+			heap.Remove(&sch.queue, e.index)
+		}
+	}
+	delete(sch.events, id)
+	sch.notify()
+	return true
+}
+
+// Pending returns the number of commands which are not yet sent.
+func (sch *Scheduler) Pending() int {
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+	return len(sch.queue)
+}
+
+// Stop stops the scheduler. Pending commands are discarded.
+// Stopping a stopped scheduler has no effect.
+func (sch *Scheduler) Stop() {
+	sch.stopOnce.Do(func() {
+		close(sch.stop)
+	})
+}
+
+func (sch *Scheduler) notify() {
+	select {
+	case sch.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sch *Scheduler) loop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		mcs, wait := sch.due(time.Now())
+		if len(mcs.Commands) > 0 {
+			sch.send(mcs)
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-sch.stop:
+			return
+		case <-sch.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// due removes the commands which are due to be sent at now, or returns the time to wait
+// for the next command.
+func (sch *Scheduler) due(now time.Time) (rtp.MIDICommands, time.Duration) {
+	sch.mutex.Lock()
+	defer sch.mutex.Unlock()
+
+	mcs := rtp.MIDICommands{}
+	if len(sch.queue) == 0 {
+		return mcs, time.Hour
+	}
+	first := sch.queue[0].at
+	if wait := first.Add(-sch.lookahead).Sub(now); wait > 0 {
+		return mcs, wait
+	}
+	mcs.Timestamp = first
+	last := first
+	for len(sch.queue) > 0 && sch.queue[0].at.Sub(first) <= sch.window {
+		e := heap.Pop(&sch.queue).(*scheduled)
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{DeltaTime: e.at.Sub(last), Payload: e.payload})
+		last = e.at
+		sch.sent(e)
+	}
+	return mcs, 0
+}
+
+// sent forgets the event if all of its commands are sent.
+func (sch *Scheduler) sent(e *scheduled) {
+	for _, other := range sch.events[e.id] {
+		if other.index >= 0 {
+			return
+		}
+	}
+	delete(sch.events, e.id)
+}
+
+// scheduledQueue is a heap of commands ordered by their target time.
+type scheduledQueue []*scheduled
+
+func (q scheduledQueue) Len() int { return len(q) }
+
+func (q scheduledQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].serial < q[j].serial
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q scheduledQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduledQueue) Push(x interface{}) {
+	e := x.(*scheduled)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *scheduledQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
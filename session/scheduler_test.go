@@ -0,0 +1,102 @@
+package session
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentCommands struct {
+	mutex sync.Mutex
+	sent  []rtp.MIDICommands
+	at    []time.Time
+}
+
+func (s *sentCommands) send(mcs rtp.MIDICommands) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sent = append(s.sent, mcs)
+	s.at = append(s.at, time.Now())
+}
+
+func (s *sentCommands) lists() ([]rtp.MIDICommands, []time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sent, s.at
+}
+
+func Test_scheduler_batches_commands_within_window(t *testing.T) {
+	// given
+	out := &sentCommands{}
+	sch := newScheduler(out.send, 5*time.Millisecond, 0)
+	defer sch.Stop()
+	start := time.Now().Add(20 * time.Millisecond)
+	// when
+	sch.Schedule(start.Add(3*time.Millisecond), rtp.MIDIPayload{0x90, 0x40, 0x40})
+	sch.Schedule(start, rtp.MIDIPayload{0x90, 0x3c, 0x40})
+	sch.Schedule(start.Add(20*time.Millisecond), rtp.MIDIPayload{0x80, 0x3c, 0x00})
+	time.Sleep(60 * time.Millisecond)
+	// then
+	lists, at := out.lists()
+	assert.Equal(t, 2, len(lists))
+	assert.Equal(t, start, lists[0].Timestamp)
+	assert.Equal(t, []rtp.MIDICommand{
+		{Payload: rtp.MIDIPayload{0x90, 0x3c, 0x40}},
+		{DeltaTime: 3 * time.Millisecond, Payload: rtp.MIDIPayload{0x90, 0x40, 0x40}},
+	}, lists[0].Commands)
+	assert.False(t, at[0].Before(start))
+	assert.Equal(t, start.Add(20*time.Millisecond), lists[1].Timestamp)
+	assert.Equal(t, 0, sch.Pending())
+}
+
+func Test_scheduler_sends_ahead_by_lookahead(t *testing.T) {
+	// given
+	out := &sentCommands{}
+	sch := newScheduler(out.send, 0, 50*time.Millisecond)
+	defer sch.Stop()
+	target := time.Now().Add(60 * time.Millisecond)
+	// when
+	sch.Schedule(target, rtp.MIDIPayload{0xf8})
+	time.Sleep(30 * time.Millisecond)
+	// then
+	lists, at := out.lists()
+	assert.Equal(t, 1, len(lists))
+	assert.Equal(t, target, lists[0].Timestamp)
+	assert.True(t, at[0].Before(target))
+}
+
+func Test_scheduler_cancels_pending_commands(t *testing.T) {
+	// given
+	out := &sentCommands{}
+	sch := newScheduler(out.send, 0, 0)
+	defer sch.Stop()
+	start := time.Now().Add(20 * time.Millisecond)
+	id := sch.ScheduleCommands(rtp.MIDICommands{Timestamp: start, Commands: []rtp.MIDICommand{
+		{Payload: rtp.MIDIPayload{0x90, 0x3c, 0x40}},
+		{DeltaTime: 10 * time.Millisecond, Payload: rtp.MIDIPayload{0x80, 0x3c, 0x00}},
+	}})
+	other := sch.Schedule(start.Add(5*time.Millisecond), rtp.MIDIPayload{0xfa})
+	// when
+	cancelled := sch.Cancel(id)
+	time.Sleep(40 * time.Millisecond)
+	// then
+	assert.True(t, cancelled)
+	assert.False(t, sch.Cancel(id))
+	assert.False(t, sch.Cancel(other))
+	lists, _ := out.lists()
+	assert.Equal(t, 1, len(lists))
+	assert.Equal(t, rtp.MIDIPayload{0xfa}, lists[0].Commands[0].Payload)
+}
+
+func Test_scheduler_stop_twice(t *testing.T) {
+	// given
+	sch := newScheduler((&sentCommands{}).send, 0, 0)
+	sch.Stop()
+	// when
+	stop := func() { sch.Stop() }
+	// then
+	assert.NotPanics(t, stop)
+}
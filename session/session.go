@@ -8,49 +8,236 @@ import (
 	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/laenzlinger/go-midi-rtp/midi"
 	"github.com/laenzlinger/go-midi-rtp/rtp"
 	"github.com/laenzlinger/go-midi-rtp/sip"
 )
 
 // MIDINetworkSession can offer or accept streams.
 type MIDINetworkSession struct {
-	LocalName      string
-	BonjourName    string
-	Port           uint16
+	LocalName   string
+	BonjourName string
+	Port        uint16
+	// DataPort is the port of the RTP-MIDI data, by default the port following the control port.
+	DataPort       uint16
 	SSRC           uint32
 	SequenceNumber uint16
 	StartTime      time.Time
 	connections    sync.Map
-	handler        MIDIMessageHandlerFunc
+	handler        atomic.Pointer[MIDIMessageHandlerFunc]
+	sendMutex      sync.Mutex
+	sendBuffer     []byte
+	maxPacketSize  int
+	maxSysExSize   int
+	sysExTimeout   time.Duration
+	receiveSize    int
+	playoutDelay   time.Duration
+	maxPlayout     time.Duration
+	adaptive       bool
+	streamTimeout  time.Duration
+	singlePort     bool
+	tcp            bool
+	// sent tracks the state of the sent messages to silence them with Panic
+	sent        *midi.StateTracker
+	controlPc   net.PacketConn
+	dataPc      net.PacketConn
+	invitations sync.Map
+	closed      chan struct{}
+	closeOnce   sync.Once
 }
 
+const (
+	defaultMaxSysExSize = 1 << 20
+	defaultSysExTimeout = 10 * time.Second
+	// maxUDPPayloadSize is the largest payload of an UDP datagram over IPv4
+	maxUDPPayloadSize = 65507
+)
+
 type MIDIMessageHandlerFunc func(rtp.MIDIMessage, *MIDINetworkSession)
 
 type MIDIMessageHandler interface {
 	HandleMIDI(rtp.MIDIMessage, *MIDINetworkSession)
 }
 
-// Start is starting a new session
-func Start(bonjourName string, port uint16) (s *MIDINetworkSession) {
+// Option configures optional behaviour of a MIDINetworkSession.
+type Option func(*MIDINetworkSession)
+
+// WithMaxPacketSize limits the size of the sent RTP packets to the given number of octets.
+// Larger command lists are split into multiple packets, e.g. to avoid IP fragmentation.
+// Without this option, command lists are only split at the limit of the MIDI list length.
+func WithMaxPacketSize(size int) Option {
+	return func(s *MIDINetworkSession) {
+		s.maxPacketSize = size
+	}
+}
+
+// WithSysExLimits limits the size of received segmented SysEx commands to maxSize octets and
+// the time between their first and last segment to timeout. A limit of 0 disables the check.
+// By default, SysEx commands are limited to 1 MiB and 10 seconds.
+func WithSysExLimits(maxSize int, timeout time.Duration) Option {
+	return func(s *MIDINetworkSession) {
+		s.maxSysExSize = maxSize
+		s.sysExTimeout = timeout
+	}
+}
+
+// WithReceiveBufferSize limits the size of received datagrams to the given number of octets.
+// Larger datagrams are detected as truncated and dropped.
+// By default, the buffer is sized for the largest possible UDP payload.
+func WithReceiveBufferSize(size int) Option {
+	return func(s *MIDINetworkSession) {
+		s.receiveSize = size
+	}
+}
+
+// WithJitterBuffer releases received messages to the handler at the time they were sent
+// plus the fixed playout delay. Messages are reordered by their sequence number, duplicates
+// and messages arriving too late are dropped.
+func WithJitterBuffer(delay time.Duration) Option {
+	return func(s *MIDINetworkSession) {
+		s.playoutDelay = delay
+		s.maxPlayout = delay
+		s.adaptive = false
+	}
+}
+
+// WithAdaptiveJitterBuffer works like WithJitterBuffer with a playout delay which adapts
+// to the jitter of the received messages within the given bounds.
+func WithAdaptiveJitterBuffer(minDelay, maxDelay time.Duration) Option {
+	return func(s *MIDINetworkSession) {
+		s.playoutDelay = minDelay
+		s.maxPlayout = maxDelay
+		s.adaptive = true
+	}
+}
+
+// WithStreamTimeout ends the streams to remote participants which did not send any packet
+// within the timeout, releasing the notes they left on. By default, streams do not time out.
+func WithStreamTimeout(timeout time.Duration) Option {
+	return func(s *MIDINetworkSession) {
+		s.streamTimeout = timeout
+	}
+}
+
+// WithSSRC identifies the session by the given SSRC instead of a random one. The SSRC must
+// not be changed after the session was opened.
+func WithSSRC(ssrc uint32) Option {
+	return func(s *MIDINetworkSession) {
+		s.SSRC = ssrc
+	}
+}
+
+// WithDataPort receives the RTP-MIDI data on the given port instead of the port following
+// the control port.
+func WithDataPort(port uint16) Option {
+	return func(s *MIDINetworkSession) {
+		s.DataPort = port
+	}
+}
+
+// WithSinglePort receives the control messages and the RTP-MIDI data on the control port.
+// Control messages are distinguished from data by their 0xFFFF prefix. Apple's MIDI Network
+// Driver does not support this mode, it is meant for peers of this library which invite the
+// session with the same control and data address.
+func WithSinglePort() Option {
+	return func(s *MIDINetworkSession) {
+		s.singlePort = true
+	}
+}
+
+// WithTCP exchanges the control messages and the RTP-MIDI data over TCP connections to the
+// control port, framed as specified by RFC 4571. Remote sessions are invited with InviteAddr
+// using the same TCP address for control and data. Lost connections of initiated streams are
+// reconnected and the remote session is invited again. The recovery journal is not needed on
+// the reliable transport and not sent.
+func WithTCP() Option {
+	return func(s *MIDINetworkSession) {
+		s.tcp = true
+	}
+}
+
+// Start is starting a new session. It panics if the ports can not be opened.
+func Start(bonjourName string, port uint16, options ...Option) (s *MIDINetworkSession) {
+	session, err := Open(bonjourName, port, options...)
+	if err != nil {
+		panic(err)
+	}
+	return session
+}
+
+// Open starts a new session on the control port and the data port, which follows the
+// control port unless configured otherwise.
+// The session is stopped with Close.
+func Open(bonjourName string, port uint16, options ...Option) (*MIDINetworkSession, error) {
 	session := MIDINetworkSession{
 		BonjourName:    bonjourName,
 		SSRC:           rand.Uint32(),
 		Port:           port,
+		DataPort:       port + 1,
 		StartTime:      time.Now(),
 		SequenceNumber: uint16(rand.Int()),
+		maxSysExSize:   defaultMaxSysExSize,
+		sysExTimeout:   defaultSysExTimeout,
+		receiveSize:    maxUDPPayloadSize,
+		sent:           midi.NewStateTracker(),
+		closed:         make(chan struct{}),
+	}
+	for _, option := range options {
+		option(&session)
+	}
+
+	var err error
+	if session.tcp {
+		session.singlePort = true
+		var framed *FramedConn
+		if framed, err = ListenFramed(fmt.Sprintf(":%d", port)); err == nil {
+			framed.reconnected = session.reinvite
+			session.controlPc = framed
+		}
+	} else {
+		session.controlPc, err = listenUDP(port)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.singlePort {
+		session.DataPort = port
+		session.dataPc = session.controlPc
+	} else if session.dataPc, err = listenUDP(session.DataPort); err != nil {
+		session.controlPc.Close()
+		return nil, err
 	}
 
-	go messageLoop(port, &session)
+	go messageLoop(session.controlPc, &session)
 
-	go messageLoop(port+1, &session)
+	if !session.singlePort {
+		go messageLoop(session.dataPc, &session)
+	}
+
+	if session.streamTimeout > 0 {
+		go session.watchStreams()
+	}
 
-	return &session
+	return &session, nil
 }
 
+// Handle sets the handler of the received messages.
+//
+// The payloads of the commands are only valid until the handler returns, as they are
+// reused for the succeeding messages. Handlers keeping commands must copy them.
 func (s *MIDINetworkSession) Handle(handler MIDIMessageHandlerFunc) {
-	s.handler = handler
+	s.handler.Store(&handler)
+}
+
+// loadHandler returns the handler of the received messages, or nil.
+func (s *MIDINetworkSession) loadHandler() MIDIMessageHandlerFunc {
+	if handler := s.handler.Load(); handler != nil {
+		return *handler
+	}
+	return nil
 }
 
 // End is ending a session
@@ -61,6 +248,29 @@ func (s *MIDINetworkSession) End() {
 	})
 }
 
+// Close ends all streams and closes the ports of the session.
+func (s *MIDINetworkSession) Close() {
+	s.closeOnce.Do(func() {
+		s.End()
+		close(s.closed)
+		s.controlPc.Close()
+		s.dataPc.Close()
+		s.connections.Range(func(k, v interface{}) bool {
+			s.connections.Delete(k)
+			return true
+		})
+	})
+}
+
+func (s *MIDINetworkSession) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 // SendMIDIPayload sends the MIDI payload immediately to all MIDINetworkStreams
 func (s *MIDINetworkSession) SendMIDIPayload(payload []byte) {
 	mcs := rtp.MIDICommands{
@@ -70,33 +280,123 @@ func (s *MIDINetworkSession) SendMIDIPayload(payload []byte) {
 	s.SendMIDICommands(mcs)
 }
 
-// SendMIDICommands sends the commands to all MIDINetworkStreams
+// SendMIDIMessages sends the MIDI messages immediately to all MIDINetworkStreams. Each
+// control change of parameter changes and 14 bit control changes is a command of its own.
+func (s *MIDINetworkSession) SendMIDIMessages(messages ...midi.Message) {
+	s.SendMIDICommands(rtp.MIDICommands{Timestamp: time.Now(), Commands: rtp.Commands(messages...)})
+}
+
+// SendMIDICommands sends the commands to all MIDINetworkStreams.
+// Commands which do not fit into a single RTP packet are sent in multiple
+// packets with consecutive sequence numbers.
 func (s *MIDINetworkSession) SendMIDICommands(mcs rtp.MIDICommands) {
-	s.SequenceNumber++
-	m := rtp.MIDIMessage{
-		SequenceNumber: s.SequenceNumber,
-		SSRC:           s.SSRC,
-		Commands:       mcs,
+	s.sendMIDICommands(mcs, func(*MIDINetworkStream) bool { return true })
+}
+
+// Panic sends note offs for the notes sent by the session followed by a sustain off, a reset
+// all controllers and an all notes off on every channel to all MIDINetworkStreams.
+func (s *MIDINetworkSession) Panic() {
+	mcs := rtp.MIDICommands{Timestamp: time.Now()}
+	for _, m := range s.sent.Panic() {
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{Payload: midi.Encode(m)})
 	}
-	s.connections.Range(func(k, v interface{}) bool {
-		v.(*MIDINetworkStream).SendMIDIMessage(m)
-		return true
-	})
+	s.SendMIDICommands(mcs)
+}
+
+// Selection sends MIDI commands to selected MIDINetworkStreams of a session.
+type Selection struct {
+	session  *MIDINetworkSession
+	selected func(*MIDINetworkStream) bool
+}
+
+// Select returns a Selection of the streams to the remote participants with the given Bonjour names.
+// Streams which connect after the selection was created are selected as well.
+func (s *MIDINetworkSession) Select(bonjourNames ...string) *Selection {
+	names := make(map[string]bool, len(bonjourNames))
+	for _, name := range bonjourNames {
+		names[name] = true
+	}
+	return &Selection{session: s, selected: func(conn *MIDINetworkStream) bool {
+		return names[conn.Host.BonjourName]
+	}}
+}
+
+// Except returns a Selection of all streams except the streams to the remote participants
+// with the given SSRCs, e.g. to relay commands without echoing them to their origin.
+func (s *MIDINetworkSession) Except(ssrcs ...uint32) *Selection {
+	excluded := make(map[uint32]bool, len(ssrcs))
+	for _, ssrc := range ssrcs {
+		excluded[ssrc] = true
+	}
+	return &Selection{session: s, selected: func(conn *MIDINetworkStream) bool {
+		return !excluded[conn.RemoteSSRC]
+	}}
+}
+
+// SendMIDICommands sends the commands to the selected MIDINetworkStreams.
+func (sel *Selection) SendMIDICommands(mcs rtp.MIDICommands) {
+	sel.session.sendMIDICommands(mcs, sel.selected)
 }
 
-func messageLoop(port uint16, s *MIDINetworkSession) {
-	pc, mcErr := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
-	if mcErr != nil {
-		panic(mcErr)
+func (s *MIDINetworkSession) sendMIDICommands(mcs rtp.MIDICommands, selected func(*MIDINetworkStream) bool) {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+
+	if s.sent != nil {
+		for _, mc := range mcs.Commands {
+			s.sent.TrackPayload(mc.Payload)
+		}
+	}
+	for _, part := range mcs.Split(s.maxPacketSize) {
+		s.SequenceNumber++
+		m := rtp.MIDIMessage{
+			SequenceNumber: s.SequenceNumber,
+			SSRC:           s.SSRC,
+			Commands:       part,
+		}
+		// the packet is the same for all streams, encode it only once
+		buff, err := rtp.AppendEncode(s.sendBuffer[:0], m, s.StartTime)
+		if err != nil {
+			log.Printf("Encoding MIDI commands failed: %v", err)
+			continue
+		}
+		s.sendBuffer = buff
+		s.connections.Range(func(k, v interface{}) bool {
+			if conn := v.(*MIDINetworkStream); selected(conn) {
+				conn.send(s.sendBuffer)
+			}
+			return true
+		})
 	}
+}
+
+func listenUDP(port uint16) (net.PacketConn, error) {
+	return net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+}
+
+func messageLoop(pc net.PacketConn, s *MIDINetworkSession) {
 	defer pc.Close()
-	buffer := make([]byte, 1024)
+	// one additional octet allows to detect datagrams which exceed the receive size
+	buffer := make([]byte, s.receiveSize+1)
+	// the message and its payloads are reused for all received RTP packets
+	received := rtp.MIDIMessage{}
 	for {
 		n, addr, err := pc.ReadFrom(buffer)
 		if err != nil {
+			if s.isClosed() {
+				return
+			}
 			fmt.Println(err)
 			continue
 		}
+		if n > s.receiveSize {
+			log.Printf("Dropping truncated datagram from %v exceeding %d bytes", addr, s.receiveSize)
+			continue
+		}
+		if n < 2 {
+			log.Printf("Dropping datagram from %v with %d bytes", addr, n)
+			continue
+		}
 
 		// received control packet?
 		if binary.BigEndian.Uint16(buffer[0:2]) == 0xffff {
@@ -109,27 +409,48 @@ func messageLoop(port uint16, s *MIDINetworkSession) {
 			}
 			log.Printf("-> incoming message: %v", msg)
 
+			if s.handleInvitationReply(msg) {
+				continue
+			}
 			conn, found := s.getConnection(msg)
 
 			if found {
 				conn.handleControl(msg, pc, addr)
 			}
 		} else {
-			msg, err := rtp.Decode(buffer[:n])
-			if err != nil {
+			if err := rtp.DecodeInto(&received, buffer[:n]); err != nil {
 				fmt.Println(err)
 				fmt.Println(hex.Dump(buffer[:n]))
 				continue
 			}
-			// log.Printf("RTP -> incoming rpt message: %v", msg)
-			conn, found := s.loadMIDIConnection(msg)
+			// log.Printf("RTP -> incoming rpt message: %v", received)
+			conn, found := s.loadMIDIConnection(received)
 			if found {
-				conn.handleRTP(msg, pc, addr)
+				conn.handleRTP(received, pc, addr)
 			}
 		}
 	}
 }
 
+// Stream returns the MIDINetworkStream to the remote participant with the given SSRC.
+func (s *MIDINetworkSession) Stream(ssrc uint32) (*MIDINetworkStream, bool) {
+	conn, found := s.connections.Load(ssrc)
+	if !found {
+		return nil, false
+	}
+	return conn.(*MIDINetworkStream), true
+}
+
+// Streams returns all MIDINetworkStreams of the session.
+func (s *MIDINetworkSession) Streams() []*MIDINetworkStream {
+	streams := []*MIDINetworkStream{}
+	s.connections.Range(func(k, v interface{}) bool {
+		streams = append(streams, v.(*MIDINetworkStream))
+		return true
+	})
+	return streams
+}
+
 func (s *MIDINetworkSession) getConnection(msg sip.ControlMessage) (c *MIDINetworkStream, found bool) {
 	if msg.Cmd == sip.Invitation {
 		log.Printf("New connection requested from remote participant SSRC [%x]", msg.SSRC)
@@ -161,13 +482,47 @@ func (s *MIDINetworkSession) removeConnection(conn *MIDINetworkStream) {
 	s.connections.Delete(conn.RemoteSSRC)
 }
 
+// watchStreams ends the streams which timed out.
+func (s *MIDINetworkSession) watchStreams() {
+	ticker := time.NewTicker(s.streamTimeout / 4)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-s.closed:
+			return
+		case now = <-ticker.C:
+		}
+		s.connections.Range(func(k, v interface{}) bool {
+			conn := v.(*MIDINetworkStream)
+			if now.Sub(time.Unix(0, conn.lastReceived.Load())) > s.streamTimeout {
+				conn.handleTimeout()
+			}
+			return true
+		})
+	}
+}
+
 func (s *MIDINetworkSession) createConnection(msg sip.ControlMessage) *MIDINetworkStream {
-	host := MIDINetworkHost{BonjourName: msg.Name}
+	return s.newStream(msg.SSRC, msg.Name)
+}
+
+func (s *MIDINetworkSession) newStream(ssrc uint32, name string) *MIDINetworkStream {
+	host := MIDINetworkHost{BonjourName: name}
 	conn := MIDINetworkStream{
 		Session:    s,
 		Host:       host,
-		RemoteSSRC: msg.SSRC,
+		RemoteSSRC: ssrc,
 		State:      initial,
+		sysEx: rtp.SysExReassembler{
+			MaxSize: s.maxSysExSize,
+			Timeout: s.sysExTimeout,
+		},
+		notes: midi.NewStateTracker(),
+	}
+	conn.lastReceived.Store(time.Now().UnixNano())
+	if s.maxPlayout > 0 {
+		conn.jitter = newJitterBuffer(s.playoutDelay, s.maxPlayout, s.adaptive, conn.deliver)
 	}
 	return &conn
 }
@@ -0,0 +1,556 @@
+package session
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/laenzlinger/go-midi-rtp/sip"
+	"github.com/stretchr/testify/assert"
+)
+
+const remoteSSRC = 0x11223344
+
+func Test_receive_of_4KiB_packet(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	s := Start("test", 15104)
+	s.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	data := joinSession(t, 15104)
+	sysex := largeSysEx(4090)
+	// when
+	sendRTP(t, data, 15105, sysex)
+	// then
+	select {
+	case msg := <-received:
+		assert.Equal(t, 1, len(msg.Commands.Commands))
+		assert.Equal(t, sysex, msg.Commands.Commands[0].Payload)
+	case <-time.After(time.Second):
+		t.Fatal("packet not received")
+	}
+}
+
+func Test_drop_of_truncated_packet(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	s := Start("test", 15106, WithReceiveBufferSize(1024))
+	s.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	data := joinSession(t, 15106)
+	// when
+	sendRTP(t, data, 15107, largeSysEx(4090))
+	// then
+	select {
+	case <-received:
+		t.Fatal("truncated packet was delivered")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func Test_no_delivery_of_pending_sysex_segment(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	s := Start("test", 15134)
+	s.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	data := joinSession(t, 15134)
+	// when
+	sendRTP(t, data, 15135, rtp.MIDIPayload{0xf0, 0x43, 0x10, 0xf0})
+	// then
+	select {
+	case msg := <-received:
+		t.Fatalf("message without commands was delivered: %v", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// joinSession invites the session on the control and the data port and returns the data connection.
+func joinSession(t *testing.T, port uint16) net.PacketConn {
+	control := listen(t)
+	invite(t, control, port)
+	data := listen(t)
+	invite(t, data, port+1)
+	return data
+}
+
+func listen(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+func invite(t *testing.T, pc net.PacketConn, port uint16) {
+	in, _ := sip.Encode(sip.ControlMessage{
+		Cmd:   sip.Invitation,
+		Token: 0xaabbccdd,
+		SSRC:  remoteSSRC,
+		Name:  "remote",
+	})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(port)}
+	buffer := make([]byte, 1024)
+	// retry until the session listens on the port
+	for i := 0; i < 10; i++ {
+		pc.WriteTo(in, addr)
+		pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := pc.ReadFrom(buffer)
+		if err != nil {
+			continue
+		}
+		msg, err := sip.Decode(buffer[:n])
+		assert.Nil(t, err)
+		assert.Equal(t, sip.InvitationAccepted, msg.Cmd)
+		return
+	}
+	t.Fatalf("invitation to port %d not accepted", port)
+}
+
+func sendRTP(t *testing.T, pc net.PacketConn, port uint16, payload rtp.MIDIPayload) {
+	now := time.Now()
+	b, _ := rtp.Encode(rtp.MIDIMessage{
+		SSRC:     remoteSSRC,
+		Commands: rtp.MIDICommands{Timestamp: now, Commands: []rtp.MIDICommand{{Payload: payload}}},
+	}, now)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(port)}
+	if _, err := pc.WriteTo(b, addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func largeSysEx(size int) rtp.MIDIPayload {
+	sysex := make(rtp.MIDIPayload, size)
+	sysex[0] = 0xf0
+	for i := 1; i < size-1; i++ {
+		sysex[i] = byte(i % 0x80)
+	}
+	sysex[size-1] = 0xf7
+	return sysex
+}
+
+func Test_timestamp_of_received_message_after_synchronization(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	s := Start("test", 15108)
+	s.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	data := joinSession(t, 15108)
+	remote := uint64(0x123456789)
+	local := synchronize(t, data, 15109, remote)
+	// when
+	now := time.Now()
+	b, _ := rtp.Encode(rtp.MIDIMessage{
+		SSRC:     remoteSSRC,
+		Commands: rtp.MIDICommands{Timestamp: now, Commands: []rtp.MIDICommand{{Payload: []byte{0xf8}}}},
+	}, now.Add(-time.Duration(remote+1+10000)*100*time.Microsecond))
+	data.WriteTo(b, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15109})
+	// then
+	select {
+	case msg := <-received:
+		expected := s.StartTime.Add(time.Duration(local+10000) * 100 * time.Microsecond)
+		assert.Equal(t, expected, msg.Commands.Timestamp)
+	case <-time.After(time.Second):
+		t.Fatal("packet not received")
+	}
+}
+
+// synchronize performs the clock synchronization initiated by the remote participant
+// and returns the local timestamp of the session.
+func synchronize(t *testing.T, pc net.PacketConn, port uint16, remote uint64) uint64 {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(port)}
+	ck0, _ := sip.Encode(sip.ControlMessage{Cmd: sip.Synchronization, SSRC: remoteSSRC, Timestamps: []uint64{remote}})
+	pc.WriteTo(ck0, addr)
+	buffer := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ck1, _ := sip.Decode(buffer[:n])
+	assert.Equal(t, 2, len(ck1.Timestamps))
+	ck2, _ := sip.Encode(sip.ControlMessage{Cmd: sip.Synchronization, SSRC: remoteSSRC, Timestamps: []uint64{remote, ck1.Timestamps[1], remote + 2}})
+	pc.WriteTo(ck2, addr)
+	// wait for the session to process the synchronization
+	time.Sleep(50 * time.Millisecond)
+	return ck1.Timestamps[1]
+}
+
+func Test_release_of_notes_when_stream_ends(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 2)
+	s := Start("test", 15110)
+	s.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	control := listen(t)
+	invite(t, control, 15110)
+	data := listen(t)
+	invite(t, data, 15111)
+	sendRTP(t, data, 15111, rtp.MIDIPayload{0x92, 0x3c, 0x40})
+	<-received
+	// when
+	by, _ := sip.Encode(sip.ControlMessage{Cmd: sip.End, SSRC: remoteSSRC})
+	control.WriteTo(by, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15110})
+	// then
+	select {
+	case msg := <-received:
+		assert.Equal(t, 1, len(msg.Commands.Commands))
+		assert.Equal(t, rtp.MIDIPayload{0x82, 0x3c, 0x00}, msg.Commands.Commands[0].Payload)
+	case <-time.After(time.Second):
+		t.Fatal("notes not released")
+	}
+	_, found := s.Stream(remoteSSRC)
+	assert.False(t, found)
+}
+
+func Test_invite_remote_session(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	listener := Start("listener", 15112)
+	listener.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	initiator := Start("initiator", 15114)
+	// when
+	conn, err := initiator.Invite(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15112})
+	time.Sleep(50 * time.Millisecond)
+	initiator.SendMIDIPayload(rtp.MIDIPayload{0x90, 0x3c, 0x40})
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "listener", conn.Host.BonjourName)
+	select {
+	case msg := <-received:
+		assert.Equal(t, initiator.SSRC, msg.SSRC)
+		assert.Equal(t, rtp.MIDIPayload{0x90, 0x3c, 0x40}, msg.Commands.Commands[0].Payload)
+	case <-time.After(time.Second):
+		t.Fatal("payload not received")
+	}
+	assert.True(t, conn.synchronized.Load())
+	accepted, found := listener.Stream(initiator.SSRC)
+	assert.True(t, found)
+	assert.True(t, accepted.synchronized.Load())
+}
+
+func Test_send_except_ssrc(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 2)
+	s := Start("test", 15116)
+	data := joinSession(t, 15116)
+	other := Start("other", 15118)
+	other.Handle(func(msg rtp.MIDIMessage, _ *MIDINetworkSession) {
+		received <- msg
+	})
+	_, err := s.Invite(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15118})
+	assert.Nil(t, err)
+	// when
+	s.Except(remoteSSRC).SendMIDICommands(rtp.MIDICommands{Timestamp: time.Now(), Commands: []rtp.MIDICommand{{Payload: rtp.MIDIPayload{0xf8}}}})
+	// then
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("payload not received")
+	}
+	data.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = data.ReadFrom(make([]byte, 1024))
+	assert.Error(t, err)
+}
+
+func Test_single_port_sessions(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	listener := Start("listener", 15120, WithSinglePort())
+	defer listener.Close()
+	listener.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	initiator := Start("initiator", 15122, WithSinglePort())
+	defer initiator.Close()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15120}
+	// when
+	_, err := initiator.InviteAddr(addr, addr)
+	initiator.SendMIDIPayload(rtp.MIDIPayload{0xf8})
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(15120), listener.DataPort)
+	select {
+	case msg := <-received:
+		assert.Equal(t, rtp.MIDIPayload{0xf8}, msg.Commands.Commands[0].Payload)
+	case <-time.After(time.Second):
+		t.Fatal("payload not received")
+	}
+}
+
+func Test_invite_arbitrary_data_port(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	listener := Start("listener", 15124, WithDataPort(15127))
+	defer listener.Close()
+	listener.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	initiator := Start("initiator", 15128)
+	defer initiator.Close()
+	// when
+	_, err := initiator.InviteAddr(
+		&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15124},
+		&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15127},
+	)
+	initiator.SendMIDIPayload(rtp.MIDIPayload{0xf8})
+	// then
+	assert.Nil(t, err)
+	select {
+	case msg := <-received:
+		assert.Equal(t, rtp.MIDIPayload{0xf8}, msg.Commands.Commands[0].Payload)
+	case <-time.After(time.Second):
+		t.Fatal("payload not received")
+	}
+}
+
+func Test_invite_over_tcp(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 1)
+	listener := Start("listener", 15130, WithTCP())
+	defer listener.Close()
+	listener.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	initiator := Start("initiator", 15132, WithTCP())
+	defer initiator.Close()
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15130}
+	// when
+	conn, err := initiator.InviteAddr(addr, addr)
+	initiator.SendMIDIPayload(rtp.MIDIPayload{0x90, 0x3c, 0x40})
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "listener", conn.Host.BonjourName)
+	select {
+	case msg := <-received:
+		assert.Equal(t, rtp.MIDIPayload{0x90, 0x3c, 0x40}, msg.Commands.Commands[0].Payload)
+	case <-time.After(time.Second):
+		t.Fatal("payload not received")
+	}
+}
+
+func Test_invite_again_after_restart_over_tcp(t *testing.T) {
+	// given
+	listener := Start("listener", 15136, WithTCP())
+	initiator := Start("initiator", 15137, WithTCP())
+	defer initiator.Close()
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15136}
+	_, err := initiator.InviteAddr(addr, addr)
+	assert.Nil(t, err)
+	// when the listener stops without ending its streams
+	listener.closeOnce.Do(func() {
+		close(listener.closed)
+		listener.controlPc.Close()
+	})
+	restarted := Start("listener", 15136, WithTCP())
+	defer restarted.Close()
+	received := make(chan rtp.MIDIMessage, 1)
+	restarted.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	waitForStream(t, restarted, initiator.SSRC)
+	initiator.SendMIDIPayload(rtp.MIDIPayload{0x90, 0x3c, 0x40})
+	// then
+	select {
+	case msg := <-received:
+		assert.Equal(t, rtp.MIDIPayload{0x90, 0x3c, 0x40}, msg.Commands.Commands[0].Payload)
+	case <-time.After(time.Second):
+		t.Fatal("payload not received")
+	}
+	streams := initiator.Streams()
+	assert.Equal(t, 1, len(streams))
+	assert.Equal(t, restarted.SSRC, streams[0].RemoteSSRC)
+}
+
+func Test_invite_again_after_lost_tcp_connection(t *testing.T) {
+	// given
+	listener := Start("listener", 15138, WithTCP())
+	defer listener.Close()
+	initiator := Start("initiator", 15139, WithTCP())
+	defer initiator.Close()
+	received := make(chan rtp.MIDIMessage, 1)
+	initiator.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- msg
+	})
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15138}
+	_, err := initiator.InviteAddr(addr, addr)
+	assert.Nil(t, err)
+	accepted := waitForStream(t, listener, initiator.SSRC)
+	lost, _ := accepted.control()
+	// when
+	framed := listener.controlPc.(*FramedConn)
+	framed.mutex.Lock()
+	framed.peers[lost.String()].conn.Close()
+	framed.mutex.Unlock()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if conn, found := listener.Stream(initiator.SSRC); found && conn.isReady() {
+			if data, _ := conn.data(); data.String() != lost.String() {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream not invited again")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	listener.SendMIDIPayload(rtp.MIDIPayload{0x90, 0x3c, 0x40})
+	// then
+	select {
+	case msg := <-received:
+		assert.Equal(t, rtp.MIDIPayload{0x90, 0x3c, 0x40}, msg.Commands.Commands[0].Payload)
+	case <-time.After(time.Second):
+		t.Fatal("payload not received")
+	}
+}
+
+func waitForStream(t *testing.T, s *MIDINetworkSession, ssrc uint32) *MIDINetworkStream {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if conn, found := s.Stream(ssrc); found && conn.isReady() {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream not established")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func Test_send_parameter_change_as_separate_commands(t *testing.T) {
+	// given
+	received := make(chan []midi.Message, 1)
+	listener := Start("listener", 15140)
+	defer listener.Close()
+	listener.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		messages := []midi.Message{}
+		for _, mc := range msg.Commands.Commands {
+			m, err := mc.Payload.Message()
+			assert.NoError(t, err)
+			messages = append(messages, m)
+		}
+		received <- messages
+	})
+	initiator := Start("initiator", 15142)
+	defer initiator.Close()
+	_, err := initiator.Invite(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15140})
+	assert.Nil(t, err)
+	p := midi.ParameterChange{Channel: 1, Kind: midi.RPN, Parameter: 0, Value: 2 << 7}
+	// when
+	initiator.SendMIDIMessages(p)
+	// then
+	select {
+	case messages := <-received:
+		assert.Equal(t, p.Messages(), messages)
+	case <-time.After(time.Second):
+		t.Fatal("parameter change not received")
+	}
+}
+
+func Test_no_release_of_notes_on_missing_messages(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 2)
+	s := Start("test", 15144)
+	defer s.Close()
+	s.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- copyMessage(msg)
+	})
+	data := joinSession(t, 15144)
+	send := func(seq uint16, payload rtp.MIDIPayload) {
+		now := time.Now()
+		b, _ := rtp.Encode(rtp.MIDIMessage{
+			SSRC:           remoteSSRC,
+			SequenceNumber: seq,
+			Commands:       rtp.MIDICommands{Timestamp: now, Commands: []rtp.MIDICommand{{Payload: payload}}},
+		}, now)
+		data.WriteTo(b, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15145})
+	}
+	send(1, rtp.MIDIPayload{0x90, 0x3c, 0x40})
+	<-received
+	// when
+	send(5, rtp.MIDIPayload{0x90, 0x40, 0x40})
+	// then
+	select {
+	case msg := <-received:
+		assert.Equal(t, []rtp.MIDICommand{{Payload: rtp.MIDIPayload{0x90, 0x40, 0x40}}}, msg.Commands.Commands)
+	case <-time.After(time.Second):
+		t.Fatal("payload not received")
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func Test_release_of_notes_after_jitter_buffer_when_stream_ends(t *testing.T) {
+	// given
+	received := make(chan rtp.MIDIMessage, 2)
+	s := Start("test", 15146, WithJitterBuffer(50*time.Millisecond))
+	defer s.Close()
+	s.Handle(func(msg rtp.MIDIMessage, s *MIDINetworkSession) {
+		received <- copyMessage(msg)
+	})
+	control := listen(t)
+	invite(t, control, 15146)
+	data := listen(t)
+	invite(t, data, 15147)
+	// when
+	sendRTP(t, data, 15147, rtp.MIDIPayload{0x92, 0x3c, 0x40})
+	// the note is still buffered when the stream ends
+	time.Sleep(10 * time.Millisecond)
+	by, _ := sip.Encode(sip.ControlMessage{Cmd: sip.End, SSRC: remoteSSRC})
+	control.WriteTo(by, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15146})
+	// then
+	for _, expected := range []rtp.MIDIPayload{{0x92, 0x3c, 0x40}, {0x82, 0x3c, 0x00}} {
+		select {
+		case msg := <-received:
+			assert.Equal(t, []rtp.MIDICommand{{Payload: expected}}, msg.Commands.Commands)
+		case <-time.After(time.Second):
+			t.Fatalf("%v not received", expected)
+		}
+	}
+}
+
+func Test_session_with_ssrc(t *testing.T) {
+	// given
+	listener := Start("listener", 15148)
+	defer listener.Close()
+	initiator := Start("initiator", 15150, WithSSRC(0x01020304))
+	defer initiator.Close()
+	// when
+	_, err := initiator.Invite(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 15148})
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0x01020304), initiator.SSRC)
+	_, found := listener.Stream(0x01020304)
+	assert.True(t, found)
+}
+
+func Test_repeated_control_invitation_before_data_invitation(t *testing.T) {
+	// given
+	s := Start("test", 15152)
+	defer s.Close()
+	control := listen(t)
+	invite(t, control, 15152)
+	// when
+	invite(t, control, 15152)
+	data := listen(t)
+	invite(t, data, 15153)
+	// then
+	conn := waitForStream(t, s, remoteSSRC)
+	controlAddr, _ := conn.control()
+	dataAddr, _ := conn.data()
+	assert.Equal(t, control.LocalAddr().String(), controlAddr.String())
+	assert.Equal(t, data.LocalAddr().String(), dataAddr.String())
+}
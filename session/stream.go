@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/laenzlinger/go-midi-rtp/midi"
 	"github.com/laenzlinger/go-midi-rtp/rtp"
 	"github.com/laenzlinger/go-midi-rtp/sip"
 	"github.com/laenzlinger/go-midi-rtp/timestamp"
@@ -31,41 +35,196 @@ type MIDINetworkHost struct {
 }
 
 // MIDINetworkStream specifies a connection to a MIDI network host.
+//
+// The State and the addresses of the Host change while the remote participant invites the
+// stream, they are guarded by the mutex of the stream.
 type MIDINetworkStream struct {
 	Session    *MIDINetworkSession
 	Host       MIDINetworkHost
 	RemoteSSRC uint32
 	State      state
+	mutex      sync.Mutex
+	sysEx      rtp.SysExReassembler
+	// offset is the estimated difference of the remote and the local timestamps in ticks
+	offset       atomic.Int64
+	synchronized atomic.Bool
+	jitter       *jitterBuffer
+	// notes tracks the state of the received messages to silence them when the stream is lost
+	notes        *midi.StateTracker
+	lastSequence uint16
+	sequenced    bool
+	// controlToken is the token of the accepted invitation of the control port
+	controlToken uint32
+	// lastReceived is the local time in nanoseconds of the last received packet
+	lastReceived atomic.Int64
+	// deliverMutex serializes the delivery and the release of notes, which run on the message
+	// loop or the jitter buffer and on the goroutine ending the stream
+	deliverMutex sync.Mutex
+}
+
+// LocalTime converts the RTP timestamp of a message received from the remote participant
+// into the local time. The conversion is only possible after the clock synchronization.
+func (conn *MIDINetworkStream) LocalTime(rtpTimestamp uint32) (time.Time, bool) {
+	if !conn.synchronized.Load() {
+		return time.Time{}, false
+	}
+	local := rtpTimestamp - uint32(conn.offset.Load())
+	return timestamp.Time(local, time.Now(), conn.Session.StartTime), true
 }
 
 // End the session
 func (conn *MIDINetworkStream) End() {
 	log.Println("Ending connedtion")
-	conn.sendConnectionEnd(conn.Host.ControlAddr, conn.Host.ControlPc)
+	if conn.jitter != nil {
+		conn.jitter.close()
+	}
+	conn.sendConnectionEnd(conn.control())
+}
+
+// control returns the address and the connection of the control port of the remote participant.
+func (conn *MIDINetworkStream) control() (net.Addr, net.PacketConn) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.Host.ControlAddr, conn.Host.ControlPc
+}
+
+// data returns the address and the connection of the data port of the remote participant.
+func (conn *MIDINetworkStream) data() (net.Addr, net.PacketConn) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.Host.MIDIAddr, conn.Host.MIDIPc
+}
+
+// isReady returns true if the remote participant accepted or sent the invitation of both ports.
+func (conn *MIDINetworkStream) isReady() bool {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.State == ready
 }
 
 // SendMIDIMessage sends to given MIDIMessage over the RTP-MIDI data port.
 func (conn *MIDINetworkStream) SendMIDIMessage(msg rtp.MIDIMessage) {
-	buff := rtp.Encode(msg, conn.Session.StartTime)
-
-	_, err := conn.Host.MIDIPc.WriteTo(buff, conn.Host.MIDIAddr)
+	buff, err := rtp.Encode(msg, conn.Session.StartTime)
 	if err != nil {
-		fmt.Println(err)
+		log.Printf("Encoding MIDI message failed: %v", err)
 		return
 	}
 
-	log.Printf("<- outgoing payload: %v", msg)
+	if conn.send(buff) {
+		log.Printf("<- outgoing payload: %v", msg)
+	}
+}
+
+// send writes the encoded RTP packet to the RTP-MIDI data port.
+func (conn *MIDINetworkStream) send(buff []byte) bool {
+	addr, pc := conn.data()
+	if pc == nil {
+		return false
+	}
+	_, err := pc.WriteTo(buff, addr)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
 }
 
 func (conn *MIDINetworkStream) handleRTP(msg rtp.MIDIMessage, pc net.PacketConn, addr net.Addr) {
 	// log.Printf("RTP message received %#v", msg)
-	if conn.Session != nil && conn.Session.handler != nil {
-		conn.Session.handler(msg, conn.Session)
+	conn.lastReceived.Store(time.Now().UnixNano())
+	t, synchronized := conn.LocalTime(msg.RTPTimestamp)
+	if synchronized {
+		msg.Commands.Timestamp = t
+	}
+	if conn.jitter != nil {
+		conn.jitter.start()
+		if !conn.jitter.push(msg, time.Now(), synchronized) {
+			log.Printf("Dropping late or duplicate message %d from SSRC [%x]", msg.SequenceNumber, msg.SSRC)
+		}
+		return
+	}
+	conn.deliver(msg)
+}
+
+// deliver passes the received message with reassembled SysEx commands to the handler.
+func (conn *MIDINetworkStream) deliver(msg rtp.MIDIMessage) {
+	conn.deliverMutex.Lock()
+	defer conn.deliverMutex.Unlock()
+	if conn.sequenced && sequenceBefore(conn.lastSequence+1, msg.SequenceNumber) {
+		// the recovery journal is not evaluated, lost messages can not be recovered. The notes
+		// are only released when the stream ends, a lost packet must not cut held notes.
+		log.Printf("Missing messages %d to %d from SSRC [%x]", conn.lastSequence+1, msg.SequenceNumber-1, conn.RemoteSSRC)
+	}
+	if !conn.sequenced || sequenceBefore(conn.lastSequence, msg.SequenceNumber) {
+		conn.lastSequence, conn.sequenced = msg.SequenceNumber, true
+	}
+	msg.Commands.Commands = conn.reassembleSysEx(msg.Commands.Commands)
+	if len(msg.Commands.Commands) == 0 {
+		// all commands were SysEx segments of a pending SysEx command
+		return
+	}
+	if conn.notes != nil {
+		for _, mc := range msg.Commands.Commands {
+			conn.notes.TrackPayload(mc.Payload)
+		}
 	}
+	if conn.Session == nil {
+		return
+	}
+	if handler := conn.Session.loadHandler(); handler != nil {
+		handler(msg, conn.Session)
+	}
+}
+
+// release passes note offs, sustain off and reset all controllers to the handler for the
+// notes and controllers left on by the remote participant.
+func (conn *MIDINetworkStream) release() {
+	conn.deliverMutex.Lock()
+	defer conn.deliverMutex.Unlock()
+	if conn.notes == nil {
+		return
+	}
+	messages := conn.notes.Release()
+	if len(messages) == 0 || conn.Session == nil {
+		return
+	}
+	handler := conn.Session.loadHandler()
+	if handler == nil {
+		return
+	}
+	msg := rtp.MIDIMessage{
+		SSRC:     conn.RemoteSSRC,
+		Commands: rtp.MIDICommands{Timestamp: time.Now()},
+	}
+	for _, m := range messages {
+		msg.Commands.Commands = append(msg.Commands.Commands, rtp.MIDICommand{Payload: midi.Encode(m)})
+	}
+	log.Printf("Releasing %d notes and controllers of SSRC [%x]", len(messages), conn.RemoteSSRC)
+	handler(msg, conn.Session)
+}
+
+// reassembleSysEx replaces SysEx segments by the complete SysEx commands.
+// The delta time of consumed segments is added to the succeeding command.
+func (conn *MIDINetworkStream) reassembleSysEx(commands []rtp.MIDICommand) []rtp.MIDICommand {
+	now := time.Now()
+	result := make([]rtp.MIDICommand, 0, len(commands))
+	var consumed time.Duration
+	for _, mc := range commands {
+		mc.DeltaTime += consumed
+		reassembled, complete := conn.sysEx.Reassemble(mc, now)
+		if !complete {
+			consumed = mc.DeltaTime
+			continue
+		}
+		consumed = 0
+		result = append(result, reassembled)
+	}
+	return result
 }
 
 // HandleControl a sipControlMessage
 func (conn *MIDINetworkStream) handleControl(msg sip.ControlMessage, pc net.PacketConn, addr net.Addr) {
+	conn.lastReceived.Store(time.Now().UnixNano())
 	switch msg.Cmd {
 	case sip.Invitation:
 		conn.handleInvitation(msg, pc, addr)
@@ -77,26 +236,63 @@ func (conn *MIDINetworkStream) handleControl(msg sip.ControlMessage, pc net.Pack
 }
 
 func (conn *MIDINetworkStream) handleInvitation(msg sip.ControlMessage, pc net.PacketConn, addr net.Addr) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
 	switch conn.State {
 	case initial:
 		conn.Host.ControlAddr = addr
 		conn.Host.ControlPc = pc
+		conn.controlToken = msg.Token
 		conn.sendInvitationAccepted(msg, addr, pc)
 		conn.State = controlChannelEstablished
 	case controlChannelEstablished:
+		if msg.Token == conn.controlToken && pc == conn.Host.ControlPc && addr.String() == conn.Host.ControlAddr.String() {
+			// a repeated invitation of the control port, its answer was lost
+			conn.sendInvitationAccepted(msg, addr, pc)
+			return
+		}
 		conn.Host.MIDIAddr = addr
 		conn.Host.MIDIPc = pc
 		conn.sendInvitationAccepted(msg, addr, pc)
 		conn.State = ready
 	case ready:
-		// FIXME send NO to control port
+		if msg.Token == conn.controlToken || addr.String() == conn.Host.MIDIAddr.String() {
+			// a repeated invitation of the established stream
+			conn.sendInvitationAccepted(msg, addr, pc)
+			return
+		}
+		// the remote participant restarted the stream, e.g. from a new TCP connection
+		log.Printf("Stream to SSRC [%x] invited again from %v", conn.RemoteSSRC, addr)
+		conn.Host.ControlAddr = addr
+		conn.Host.ControlPc = pc
+		conn.controlToken = msg.Token
+		conn.sendInvitationAccepted(msg, addr, pc)
+		conn.State = controlChannelEstablished
 	}
 }
 
 func (conn *MIDINetworkStream) handleEnd() {
+	conn.end()
 	conn.Session.removeConnection(conn)
 }
 
+// handleTimeout ends the stream to a remote participant which stopped sending.
+func (conn *MIDINetworkStream) handleTimeout() {
+	log.Printf("Connection to SSRC [%x] timed out", conn.RemoteSSRC)
+	conn.end()
+	conn.Session.connections.Delete(conn.RemoteSSRC)
+}
+
+// end releases the notes and controllers left on by the ended stream. With a jitter buffer
+// they are released after the buffered messages, by the goroutine delivering them.
+func (conn *MIDINetworkStream) end() {
+	if conn.jitter != nil {
+		conn.jitter.end(conn.release)
+		return
+	}
+	conn.release()
+}
+
 func (conn *MIDINetworkStream) sendConnectionEnd(addr net.Addr, pc net.PacketConn) {
 
 	end := sip.ControlMessage{
@@ -120,13 +316,18 @@ func (conn *MIDINetworkStream) sendInvitationAccepted(msg sip.ControlMessage, ad
 }
 
 func (conn *MIDINetworkStream) handleSynchonization(msg sip.ControlMessage, pc net.PacketConn, addr net.Addr) {
-	if conn.State == ready {
+	if conn.isReady() {
 		switch len(msg.Timestamps) {
-		case 1:
-			fallthrough
-		case 2:
+		case 1, 2:
 			ts := timestamp.Now(conn.Session.StartTime).Uint64()
 			newTs := append(msg.Timestamps, ts)
+			if len(msg.Timestamps) == 2 {
+				// the session initiated the synchronization:
+				// offset_estimate = timestamp2 - ((timestamp3 + timestamp1) / 2)
+				offset := int64(msg.Timestamps[1]) - int64((msg.Timestamps[0]+ts)/2)
+				conn.offset.Store(offset)
+				conn.synchronized.Store(true)
+			}
 
 			sync := sip.ControlMessage{
 				Cmd:        sip.Synchronization,
@@ -135,7 +336,12 @@ func (conn *MIDINetworkStream) handleSynchonization(msg sip.ControlMessage, pc n
 			}
 			conn.sendControlMessage(sync, addr, pc)
 		case 3:
-			// FIXME calculate offset_estimate = ((timestamp3 + timestamp1) / 2) - timestamp2
+			// the remote participant initiated the synchronization:
+			// offset_estimate = ((timestamp3 + timestamp1) / 2) - timestamp2
+			ts := msg.Timestamps
+			offset := int64((ts[0]+ts[2])/2) - int64(ts[1])
+			conn.offset.Store(offset)
+			conn.synchronized.Store(true)
 		}
 	}
 }
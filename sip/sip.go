@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"strings"
 )
 
 // Command defines one of the commands defined by the apple SIP
@@ -51,6 +50,15 @@ type ControlMessage struct {
 // Decode a byte buffer into a ControlMessage
 func Decode(buffer []byte) (msg ControlMessage, err error) {
 	msg = ControlMessage{}
+	err = DecodeInto(&msg, buffer)
+	return
+}
+
+// DecodeInto decodes a byte buffer into the given ControlMessage.
+//
+// The Timestamps of the message are reused, so decoding synchronization messages
+// into the same message repeatedly does not allocate.
+func DecodeInto(msg *ControlMessage, buffer []byte) (err error) {
 	if len(buffer) < minimumBufferLengt {
 		err = fmt.Errorf("buffer is too small: %d bytes", len(buffer))
 		return
@@ -62,6 +70,10 @@ func Decode(buffer []byte) (msg ControlMessage, err error) {
 		return
 	}
 	msg.Cmd = Command(binary.BigEndian.Uint16(buffer[2:4]))
+	msg.Token = 0
+	msg.SSRC = 0
+	msg.Timestamps = msg.Timestamps[:0]
+	msg.SequenceNumber = 0
 	switch msg.Cmd {
 	case Invitation:
 		fallthrough
@@ -70,23 +82,46 @@ func Decode(buffer []byte) (msg ControlMessage, err error) {
 	case InvitationRejected:
 		fallthrough
 	case End:
+		if len(buffer) < 16 {
+			err = fmt.Errorf("buffer is too small for %v: %d bytes", msg.Cmd, len(buffer))
+			return
+		}
 		version := binary.BigEndian.Uint32(buffer[4:8])
 		if version != protocolVersion {
 			fmt.Println("Warning: Unsupported protocol version: ", version)
 		}
 		msg.Token = binary.BigEndian.Uint32(buffer[8:12])
 		msg.SSRC = binary.BigEndian.Uint32(buffer[12:16])
-		if msg.Cmd != End {
-			msg.Name = strings.TrimRight(string(buffer[16:]), "\x00")
+		name := bytes.TrimRight(buffer[16:], "\x00")
+		if msg.Cmd == End {
+			name = nil
+		}
+		// avoid allocating a new string for an unchanged name
+		if msg.Name != string(name) {
+			msg.Name = string(name)
 		}
 	case Synchronization:
+		if len(buffer) < 36 {
+			err = fmt.Errorf("buffer is too small for %v: %d bytes", msg.Cmd, len(buffer))
+			return
+		}
+		msg.Name = ""
 		msg.SSRC = binary.BigEndian.Uint32(buffer[4:8])
 		count := buffer[8] + 1
+		if count > 3 {
+			err = fmt.Errorf("Unsupported timestamp count: %d", count)
+			return
+		}
 		for i := byte(0); i < count; i++ {
 			ts := binary.BigEndian.Uint64(buffer[12+i*8 : 20+i*8])
 			msg.Timestamps = append(msg.Timestamps, ts)
 		}
 	case ReceiverFeedback:
+		if len(buffer) < 12 {
+			err = fmt.Errorf("buffer is too small for %v: %d bytes", msg.Cmd, len(buffer))
+			return
+		}
+		msg.Name = ""
 		msg.SSRC = binary.BigEndian.Uint32(buffer[4:8])
 		msg.SequenceNumber = binary.BigEndian.Uint32(buffer[8:12])
 	}
@@ -96,10 +131,15 @@ func Decode(buffer []byte) (msg ControlMessage, err error) {
 
 // Encode the ControlMessage into a byte buffer.
 func Encode(m ControlMessage) (buf []byte, err error) {
-	b := new(bytes.Buffer)
+	return AppendEncode(nil, m)
+}
 
-	binary.Write(b, binary.BigEndian, header)
-	binary.Write(b, binary.BigEndian, m.Cmd)
+// AppendEncode appends the encoded ControlMessage to dst and returns the extended buffer.
+//
+// Encoding into a buffer with sufficient capacity does not allocate.
+func AppendEncode(dst []byte, m ControlMessage) (buf []byte, err error) {
+	dst = binary.BigEndian.AppendUint16(dst, header)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(m.Cmd))
 
 	switch m.Cmd {
 	case Invitation:
@@ -109,22 +149,22 @@ func Encode(m ControlMessage) (buf []byte, err error) {
 	case InvitationRejected:
 		fallthrough
 	case End:
-		binary.Write(b, binary.BigEndian, protocolVersion)
-		binary.Write(b, binary.BigEndian, m.Token)
-		binary.Write(b, binary.BigEndian, m.SSRC)
+		dst = binary.BigEndian.AppendUint32(dst, protocolVersion)
+		dst = binary.BigEndian.AppendUint32(dst, m.Token)
+		dst = binary.BigEndian.AppendUint32(dst, m.SSRC)
 		if m.Cmd != End {
-			b.WriteString(m.Name)
-			b.WriteByte(0)
+			dst = append(dst, m.Name...)
+			dst = append(dst, 0)
 		}
 
 	case Synchronization:
 		if len(m.Timestamps) < 1 {
 			return []byte{}, fmt.Errorf("At least 1 timestamp is expected")
 		}
-		binary.Write(b, binary.BigEndian, m.SSRC)
-		binary.Write(b, binary.BigEndian, byte(len(m.Timestamps)-1))
-		binary.Write(b, binary.BigEndian, byte(0x00))
-		binary.Write(b, binary.BigEndian, uint16(0x0000))
+		dst = binary.BigEndian.AppendUint32(dst, m.SSRC)
+		dst = append(dst, byte(len(m.Timestamps)-1))
+		dst = append(dst, byte(0x00))
+		dst = binary.BigEndian.AppendUint16(dst, uint16(0x0000))
 		for i := 0; i < 3; i++ {
 			var ts uint64
 			if i < len(m.Timestamps) {
@@ -132,14 +172,14 @@ func Encode(m ControlMessage) (buf []byte, err error) {
 			} else {
 				ts = 0
 			}
-			binary.Write(b, binary.BigEndian, ts)
+			dst = binary.BigEndian.AppendUint64(dst, ts)
 		}
 	case ReceiverFeedback:
-		binary.Write(b, binary.BigEndian, m.SSRC)
-		binary.Write(b, binary.BigEndian, m.SequenceNumber)
+		dst = binary.BigEndian.AppendUint32(dst, m.SSRC)
+		dst = binary.BigEndian.AppendUint32(dst, m.SequenceNumber)
 	}
 
-	return b.Bytes(), nil
+	return dst, nil
 }
 
 func (c Command) String() string {
@@ -141,3 +141,59 @@ func Test_ReceiverFeedback_Codec(t *testing.T) {
 		0xbb, 0xbb, 0xbb, 0xbb, // Sequence number
 	}, buffer)
 }
+
+func Test_Synchronization_DecodeInto_reuses_message(t *testing.T) {
+	// given
+	buffer, _ := Encode(ControlMessage{
+		Cmd:        Synchronization,
+		SSRC:       0xaabbccdd,
+		Timestamps: []uint64{1, 2, 3},
+	})
+	msg := ControlMessage{}
+	DecodeInto(&msg, buffer)
+	// when
+	allocs := testing.AllocsPerRun(100, func() {
+		DecodeInto(&msg, buffer)
+	})
+	// then
+	assert.Equal(t, 0.0, allocs)
+	assert.Equal(t, []uint64{1, 2, 3}, msg.Timestamps)
+}
+
+func Test_Decode_too_small_buffer(t *testing.T) {
+	// given
+	buffer := []byte{0xff, 0xff, 0x43, 0x4b, 0xaa, 0xbb}
+	// when
+	_, err := Decode(buffer)
+	// then
+	assert.NotNil(t, err)
+}
+
+func Benchmark_AppendEncode(b *testing.B) {
+	msg := ControlMessage{
+		Cmd:        Synchronization,
+		SSRC:       0xaabbccdd,
+		Timestamps: []uint64{0x0102030405060708, 0x1112131415161718},
+	}
+	buffer := make([]byte, 0, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer, _ = AppendEncode(buffer[:0], msg)
+	}
+}
+
+func Benchmark_DecodeInto(b *testing.B) {
+	buffer, _ := Encode(ControlMessage{
+		Cmd:   Invitation,
+		SSRC:  0xaaaaaaaa,
+		Token: 0xbbbbbbbb,
+		Name:  "session",
+	})
+	msg := ControlMessage{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DecodeInto(&msg, buffer)
+	}
+}
@@ -0,0 +1,185 @@
+package smf
+
+import (
+	"sort"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+)
+
+// TempoChange sets the tempo in microseconds per quarter note at the given tick.
+type TempoChange struct {
+	Tick  uint64
+	Tempo uint32
+}
+
+// TempoMap contains the tempo changes of a file ordered by tick.
+type TempoMap struct {
+	Division uint16
+	Changes  []TempoChange
+}
+
+// TimedEvent is an event with its absolute position in a file.
+type TimedEvent struct {
+	Event
+	// Tick is the number of ticks since the start of the file.
+	Tick uint64
+	// Time is the time since the start of the file according to the tempo map.
+	Time time.Duration
+	// Track is the index of the track containing the event.
+	Track int
+}
+
+// TempoMap returns the tempo changes of all tracks.
+func (f *File) TempoMap() TempoMap {
+	m := TempoMap{Division: f.Division}
+	for _, t := range f.Tracks {
+		tick := uint64(0)
+		for _, e := range t.Events {
+			tick += uint64(e.Delta)
+			if tempo, ok := e.Tempo(); ok {
+				m.Changes = append(m.Changes, TempoChange{Tick: tick, Tempo: tempo})
+			}
+		}
+	}
+	sort.SliceStable(m.Changes, func(i, j int) bool {
+		return m.Changes[i].Tick < m.Changes[j].Tick
+	})
+	return m
+}
+
+// Duration returns the time from the start of the file to the given tick.
+func (m TempoMap) Duration(tick uint64) time.Duration {
+	d := time.Duration(0)
+	last, tempo := uint64(0), uint32(DefaultTempo)
+	for _, c := range m.Changes {
+		if c.Tick >= tick {
+			break
+		}
+		d += m.ticksDuration(c.Tick-last, tempo)
+		last, tempo = c.Tick, c.Tempo
+	}
+	return d + m.ticksDuration(tick-last, tempo)
+}
+
+// Tick returns the tick at the given time from the start of the file.
+func (m TempoMap) Tick(d time.Duration) uint64 {
+	start, last, tempo := time.Duration(0), uint64(0), uint32(DefaultTempo)
+	for _, c := range m.Changes {
+		next := start + m.ticksDuration(c.Tick-last, tempo)
+		if next > d {
+			break
+		}
+		start, last, tempo = next, c.Tick, c.Tempo
+	}
+	return last + uint64((d-start).Microseconds())*uint64(m.Division)/uint64(tempo)
+}
+
+// Tempo returns the tempo in microseconds per quarter note at the given tick.
+func (m TempoMap) Tempo(tick uint64) uint32 {
+	tempo := uint32(DefaultTempo)
+	for _, c := range m.Changes {
+		if c.Tick > tick {
+			break
+		}
+		tempo = c.Tempo
+	}
+	return tempo
+}
+
+func (m TempoMap) ticksDuration(ticks uint64, tempo uint32) time.Duration {
+	return time.Duration(ticks*uint64(tempo)) * time.Microsecond / time.Duration(m.Division)
+}
+
+// TimedEvents returns the events of all tracks ordered by their time.
+// Events at the same tick keep the order of their tracks.
+func (f *File) TimedEvents() []TimedEvent {
+	m := f.TempoMap()
+	events := []TimedEvent{}
+	for i, t := range f.Tracks {
+		tick := uint64(0)
+		for _, e := range t.Events {
+			tick += uint64(e.Delta)
+			events = append(events, TimedEvent{Event: e, Tick: tick, Track: i})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Tick < events[j].Tick
+	})
+	for i := range events {
+		events[i].Time = m.Duration(events[i].Tick)
+	}
+	return events
+}
+
+// Commands returns the MIDI and SysEx events of all tracks as commands starting at the given time.
+func (f *File) Commands(start time.Time) rtp.MIDICommands {
+	mcs := rtp.MIDICommands{Timestamp: start}
+	last := time.Duration(0)
+	for _, e := range f.TimedEvents() {
+		payload := e.Payload()
+		if payload == nil {
+			continue
+		}
+		mcs.Commands = append(mcs.Commands, rtp.MIDICommand{DeltaTime: e.Time - last, Payload: payload})
+		last = e.Time
+	}
+	return mcs
+}
+
+// Payload returns the MIDI bytes to send for MIDI, SysEx and escape events, or nil for meta events.
+func (e Event) Payload() rtp.MIDIPayload {
+	if !e.IsMIDI() {
+		return nil
+	}
+	if e.Data[0] == escapeStatus {
+		return rtp.MIDIPayload(e.Data[1:])
+	}
+	return rtp.MIDIPayload(e.Data)
+}
+
+// TrackFromCommands converts the commands into a track with a constant tempo in microseconds
+// per quarter note. The time of the commands is relative to origin, earlier commands are
+// placed at the start of the track. If name is not empty, the track starts with a track name event.
+func TrackFromCommands(name string, origin time.Time, division uint16, tempo uint32, lists ...rtp.MIDICommands) Track {
+	type timedPayload struct {
+		tick    uint64
+		payload rtp.MIDIPayload
+	}
+	payloads := []timedPayload{}
+	for _, mcs := range lists {
+		t := mcs.Timestamp
+		for _, mc := range mcs.Commands {
+			t = t.Add(mc.DeltaTime)
+			if len(mc.Payload) == 0 {
+				continue
+			}
+			d := t.Sub(origin)
+			if d < 0 {
+				d = 0
+			}
+			tick := uint64(d.Microseconds()) * uint64(division) / uint64(tempo)
+			payloads = append(payloads, timedPayload{tick: tick, payload: mc.Payload})
+		}
+	}
+	sort.SliceStable(payloads, func(i, j int) bool {
+		return payloads[i].tick < payloads[j].tick
+	})
+
+	track := Track{}
+	if name != "" {
+		track.Events = append(track.Events, NewTrackNameEvent(0, name))
+	}
+	last := uint64(0)
+	for _, p := range payloads {
+		data := append([]byte(nil), p.payload...)
+		if data[0] != sysExStatus && data[0] >= 0xf0 {
+			// System Common and Real-Time messages can only be stored as escape events
+			data = append([]byte{escapeStatus}, data...)
+		}
+		track.Events = append(track.Events, Event{Delta: uint32(p.tick - last), Data: data})
+		last = p.tick
+	}
+	track.Events = append(track.Events, NewEndOfTrackEvent(0))
+	return track
+}
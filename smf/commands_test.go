@@ -0,0 +1,75 @@
+package smf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TempoMap(t *testing.T) {
+	// given
+	f := &File{Format: 1, Division: 480, Tracks: []Track{
+		{Events: []Event{NewTempoEvent(960, 250000)}},
+	}}
+	// when
+	m := f.TempoMap()
+	// then
+	assert.Equal(t, time.Second, m.Duration(960))
+	assert.Equal(t, 1250*time.Millisecond, m.Duration(1440))
+	assert.Equal(t, uint64(960), m.Tick(time.Second))
+	assert.Equal(t, uint64(1440), m.Tick(1250*time.Millisecond))
+	assert.Equal(t, uint32(500000), m.Tempo(959))
+	assert.Equal(t, uint32(250000), m.Tempo(960))
+}
+
+func Test_Commands_of_file(t *testing.T) {
+	// given
+	f := &File{Format: 1, Division: 480, Tracks: []Track{
+		{Events: []Event{NewTempoEvent(0, 1000000)}},
+		{Events: []Event{
+			{Delta: 0, Data: []byte{0x90, 0x3c, 0x40}},
+			{Delta: 240, Data: []byte{0x80, 0x3c, 0x00}},
+		}},
+		{Events: []Event{
+			{Delta: 240, Data: []byte{0x91, 0x40, 0x40}},
+			{Delta: 0, Data: []byte{0xf7, 0xf8}},
+		}},
+	}}
+	start := time.Now()
+	// when
+	mcs := f.Commands(start)
+	// then
+	assert.Equal(t, start, mcs.Timestamp)
+	assert.Equal(t, []rtp.MIDICommand{
+		{Payload: rtp.MIDIPayload{0x90, 0x3c, 0x40}},
+		{Payload: rtp.MIDIPayload{0x80, 0x3c, 0x00}, DeltaTime: 500 * time.Millisecond},
+		{Payload: rtp.MIDIPayload{0x91, 0x40, 0x40}},
+		{Payload: rtp.MIDIPayload{0xf8}},
+	}, mcs.Commands)
+}
+
+func Test_TrackFromCommands(t *testing.T) {
+	// given
+	origin := time.Now()
+	lists := []rtp.MIDICommands{
+		{Timestamp: origin.Add(time.Second), Commands: []rtp.MIDICommand{
+			{Payload: rtp.MIDIPayload{0x80, 0x3c, 0x00}},
+			{Payload: rtp.MIDIPayload{0xf8}, DeltaTime: 500 * time.Millisecond},
+		}},
+		{Timestamp: origin.Add(-time.Second), Commands: []rtp.MIDICommand{
+			{Payload: rtp.MIDIPayload{0x90, 0x3c, 0x40}},
+		}},
+	}
+	// when
+	track := TrackFromCommands("keys", origin, 480, DefaultTempo, lists...)
+	// then
+	assert.Equal(t, []Event{
+		NewTrackNameEvent(0, "keys"),
+		{Delta: 0, Data: []byte{0x90, 0x3c, 0x40}},
+		{Delta: 960, Data: []byte{0x80, 0x3c, 0x00}},
+		{Delta: 480, Data: []byte{0xf7, 0xf8}},
+		NewEndOfTrackEvent(0),
+	}, track.Events)
+}
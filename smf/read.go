@@ -0,0 +1,160 @@
+package smf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+)
+
+const (
+	headerChunk = "MThd"
+	trackChunk  = "MTrk"
+	smpteBit    = 0x8000
+)
+
+// Read reads a Standard MIDI File of format 0 or 1.
+func Read(r io.Reader) (*File, error) {
+	id, data, err := readChunk(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != headerChunk || len(data) < 6 {
+		return nil, fmt.Errorf("missing header chunk")
+	}
+	f := &File{
+		Format:   binary.BigEndian.Uint16(data[0:2]),
+		Division: binary.BigEndian.Uint16(data[4:6]),
+	}
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	if f.Format > 1 {
+		return nil, fmt.Errorf("unsupported format %d", f.Format)
+	}
+	if f.Division&smpteBit != 0 || f.Division == 0 {
+		return nil, fmt.Errorf("unsupported division %X", f.Division)
+	}
+
+	for len(f.Tracks) < count {
+		id, data, err := readChunk(r)
+		if err != nil {
+			return nil, err
+		}
+		// unknown chunks must be ignored
+		if id != trackChunk {
+			continue
+		}
+		track, err := parseTrack(data)
+		if err != nil {
+			return nil, fmt.Errorf("track %d: %w", len(f.Tracks), err)
+		}
+		f.Tracks = append(f.Tracks, track)
+	}
+	return f, nil
+}
+
+func readChunk(r io.Reader) (string, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", nil, err
+	}
+	// the length is not trusted, the buffer only grows with the data actually read
+	length := int64(binary.BigEndian.Uint32(header[4:8]))
+	data, err := io.ReadAll(io.LimitReader(r, length))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(data)) < length {
+		return "", nil, fmt.Errorf("chunk %s of %d bytes exceeds the file: %w", header[0:4], length, io.ErrUnexpectedEOF)
+	}
+	return string(header[0:4]), data, nil
+}
+
+func parseTrack(data []byte) (Track, error) {
+	track := Track{}
+	var runningStatus byte
+	offset := 0
+	for offset < len(data) {
+		delta, n, err := readVarLen(data[offset:])
+		if err != nil {
+			return track, err
+		}
+		offset += n
+		if offset >= len(data) {
+			return track, fmt.Errorf("missing event after delta time")
+		}
+
+		status := data[offset]
+		if midi.IsStatus(status) {
+			offset++
+		} else if runningStatus != 0 {
+			status = runningStatus
+		} else {
+			return track, fmt.Errorf("data byte %X without running status", status)
+		}
+
+		e := Event{Delta: delta}
+		switch status {
+		case metaStatus:
+			if offset >= len(data) {
+				return track, fmt.Errorf("missing meta type")
+			}
+			metaType := data[offset]
+			offset++
+			length, n, err := readVarLen(data[offset:])
+			if err != nil {
+				return track, err
+			}
+			offset += n
+			if offset+int(length) > len(data) {
+				return track, fmt.Errorf("meta event exceeds the track")
+			}
+			e.Data = append([]byte{metaStatus, metaType}, data[offset:offset+int(length)]...)
+			offset += int(length)
+			runningStatus = 0
+		case sysExStatus, escapeStatus:
+			length, n, err := readVarLen(data[offset:])
+			if err != nil {
+				return track, err
+			}
+			offset += n
+			if offset+int(length) > len(data) {
+				return track, fmt.Errorf("SysEx event exceeds the track")
+			}
+			e.Data = append([]byte{status}, data[offset:offset+int(length)]...)
+			offset += int(length)
+			runningStatus = 0
+		default:
+			if midi.IsSystemCommon(status) || midi.IsRealtime(status) {
+				return track, fmt.Errorf("unexpected status %X", status)
+			}
+			length := midi.GetDataLength(status)
+			if offset+length > len(data) {
+				return track, fmt.Errorf("MIDI event exceeds the track")
+			}
+			e.Data = append([]byte{status}, data[offset:offset+length]...)
+			offset += length
+			runningStatus = status
+		}
+		track.Events = append(track.Events, e)
+		if e.IsEndOfTrack() {
+			break
+		}
+	}
+	return track, nil
+}
+
+// readVarLen reads a variable length quantity and returns it with the number of bytes read.
+func readVarLen(data []byte) (uint32, int, error) {
+	v := uint32(0)
+	for i := 0; i < 4; i++ {
+		if i >= len(data) {
+			return 0, i, fmt.Errorf("variable length quantity exceeds the track")
+		}
+		v = v<<7 | uint32(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 4, fmt.Errorf("variable length quantity exceeds 4 bytes")
+}
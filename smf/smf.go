@@ -0,0 +1,186 @@
+// Package smf reads and writes Standard MIDI Files (SMF) of format 0 and 1.
+//
+// see https://www.midi.org/specifications/file-format-specifications/standard-midi-files
+package smf
+
+import "fmt"
+
+const (
+	// DefaultDivision is the number of ticks per quarter note used when creating files.
+	DefaultDivision = 480
+	// DefaultTempo is the tempo in microseconds per quarter note (120 BPM) which
+	// applies until the first tempo event.
+	DefaultTempo = 500000
+)
+
+// Meta event types
+const (
+	MetaSequenceNumber    = 0x00
+	MetaText              = 0x01
+	MetaCopyright         = 0x02
+	MetaTrackName         = 0x03
+	MetaInstrumentName    = 0x04
+	MetaLyric             = 0x05
+	MetaMarker            = 0x06
+	MetaCuePoint          = 0x07
+	MetaChannelPrefix     = 0x20
+	MetaEndOfTrack        = 0x2f
+	MetaTempo             = 0x51
+	MetaSMPTEOffset       = 0x54
+	MetaTimeSignature     = 0x58
+	MetaKeySignature      = 0x59
+	MetaSequencerSpecific = 0x7f
+)
+
+const (
+	metaStatus   = 0xff
+	sysExStatus  = 0xf0
+	escapeStatus = 0xf7
+)
+
+// File is a Standard MIDI File.
+type File struct {
+	// Format is 0 (a single track) or 1 (multiple simultaneous tracks).
+	Format uint16
+	// Division is the number of ticks per quarter note (PPQ).
+	Division uint16
+	Tracks   []Track
+}
+
+// Track is a track chunk of a Standard MIDI File.
+type Track struct {
+	Events []Event
+}
+
+// Event is a MIDI, SysEx or meta event of a track.
+type Event struct {
+	// Delta is the number of ticks since the previous event of the track.
+	Delta uint32
+	// Data contains the bytes of the event, always starting with a status byte:
+	//
+	//	MIDI events:   the complete MIDI message (running status is resolved)
+	//	SysEx events:  0xf0 followed by the SysEx data (usually terminated by 0xf7)
+	//	Escape events: 0xf7 followed by arbitrary bytes to be sent as they are
+	//	Meta events:   0xff followed by the meta type and the meta data
+	Data []byte
+}
+
+// NewMetaEvent returns a meta event of the given type.
+func NewMetaEvent(delta uint32, metaType byte, data []byte) Event {
+	return Event{Delta: delta, Data: append([]byte{metaStatus, metaType}, data...)}
+}
+
+// NewTempoEvent returns a tempo meta event with the tempo in microseconds per quarter note.
+func NewTempoEvent(delta uint32, tempo uint32) Event {
+	return NewMetaEvent(delta, MetaTempo, []byte{byte(tempo >> 16), byte(tempo >> 8), byte(tempo)})
+}
+
+// NewTimeSignatureEvent returns a time signature meta event, e.g. 6/8 is numerator 6 and denominator 8.
+func NewTimeSignatureEvent(delta uint32, numerator uint8, denominator uint8) Event {
+	power := byte(0)
+	for d := denominator; d > 1; d >>= 1 {
+		power++
+	}
+	// 24 MIDI clocks per metronome click and 8 notated 32nd notes per quarter note
+	return NewMetaEvent(delta, MetaTimeSignature, []byte{numerator, power, 24, 8})
+}
+
+// NewTrackNameEvent returns a track name meta event.
+func NewTrackNameEvent(delta uint32, name string) Event {
+	return NewMetaEvent(delta, MetaTrackName, []byte(name))
+}
+
+// NewEndOfTrackEvent returns the meta event which ends every track.
+func NewEndOfTrackEvent(delta uint32) Event {
+	return NewMetaEvent(delta, MetaEndOfTrack, nil)
+}
+
+// IsMeta returns true for meta events.
+func (e Event) IsMeta() bool {
+	return len(e.Data) >= 2 && e.Data[0] == metaStatus
+}
+
+// IsMIDI returns true for MIDI and SysEx events which can be sent to a MIDI device.
+func (e Event) IsMIDI() bool {
+	return len(e.Data) > 0 && e.Data[0] != metaStatus
+}
+
+// MetaType returns the type of a meta event.
+func (e Event) MetaType() (byte, bool) {
+	if !e.IsMeta() {
+		return 0, false
+	}
+	return e.Data[1], true
+}
+
+// MetaData returns the data of a meta event.
+func (e Event) MetaData() []byte {
+	if !e.IsMeta() {
+		return nil
+	}
+	return e.Data[2:]
+}
+
+// Tempo returns the tempo in microseconds per quarter note of a tempo event.
+func (e Event) Tempo() (uint32, bool) {
+	t, ok := e.MetaType()
+	data := e.MetaData()
+	if !ok || t != MetaTempo || len(data) != 3 {
+		return 0, false
+	}
+	return uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2]), true
+}
+
+// TimeSignature returns the numerator and the denominator of a time signature event.
+func (e Event) TimeSignature() (numerator uint8, denominator uint8, ok bool) {
+	t, ok := e.MetaType()
+	data := e.MetaData()
+	if !ok || t != MetaTimeSignature || len(data) < 2 {
+		return 0, 0, false
+	}
+	return data[0], 1 << data[1], true
+}
+
+// TrackName returns the name of a track name event.
+func (e Event) TrackName() (string, bool) {
+	t, ok := e.MetaType()
+	if !ok || t != MetaTrackName {
+		return "", false
+	}
+	return string(e.MetaData()), true
+}
+
+// IsEndOfTrack returns true for the end of track meta event.
+func (e Event) IsEndOfTrack() bool {
+	t, ok := e.MetaType()
+	return ok && t == MetaEndOfTrack
+}
+
+// Name returns the name of the track, or an empty string.
+func (t Track) Name() string {
+	for _, e := range t.Events {
+		if name, ok := e.TrackName(); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// maxVarLen is the largest value of a variable length quantity of 4 bytes
+const maxVarLen = 0x0fffffff
+
+// appendVarLen appends the variable length quantity used for delta times and lengths.
+// Values exceeding 4 bytes are rejected.
+func appendVarLen(dst []byte, v uint32) ([]byte, error) {
+	if v > maxVarLen {
+		return dst, fmt.Errorf("%d exceeds the largest variable length quantity %d", v, maxVarLen)
+	}
+	var buf [4]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+	return append(dst, buf[i:]...), nil
+}
@@ -0,0 +1,138 @@
+package smf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// format 0 file with tempo, time signature, running status and SysEx
+var format0 = []byte{
+	'M', 'T', 'h', 'd', 0x00, 0x00, 0x00, 0x06,
+	0x00, 0x00, 0x00, 0x01, 0x01, 0xe0, // format 0, 1 track, 480 PPQ
+	'M', 'T', 'r', 'k', 0x00, 0x00, 0x00, 0x29,
+	0x00, 0xff, 0x03, 0x04, 'l', 'e', 'a', 'd', // track name
+	0x00, 0xff, 0x51, 0x03, 0x07, 0xa1, 0x20, // tempo 500000
+	0x00, 0xff, 0x58, 0x04, 0x06, 0x03, 0x18, 0x08, // time signature 6/8
+	0x00, 0x90, 0x3c, 0x40, // note on
+	0x83, 0x60, 0x3c, 0x00, // running status note on (velocity 0) after 480 ticks
+	0x00, 0xf0, 0x03, 0x7e, 0x01, 0xf7, // SysEx
+	0x00, 0xff, 0x2f, 0x00, // end of track
+}
+
+func Test_Read_format_0(t *testing.T) {
+	// when
+	f, err := Read(bytes.NewReader(format0))
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0), f.Format)
+	assert.Equal(t, uint16(480), f.Division)
+	assert.Equal(t, 1, len(f.Tracks))
+	track := f.Tracks[0]
+	assert.Equal(t, "lead", track.Name())
+	tempo, ok := track.Events[1].Tempo()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(500000), tempo)
+	numerator, denominator, ok := track.Events[2].TimeSignature()
+	assert.True(t, ok)
+	assert.Equal(t, uint8(6), numerator)
+	assert.Equal(t, uint8(8), denominator)
+	assert.Equal(t, Event{Delta: 0, Data: []byte{0x90, 0x3c, 0x40}}, track.Events[3])
+	assert.Equal(t, Event{Delta: 480, Data: []byte{0x90, 0x3c, 0x00}}, track.Events[4])
+	assert.Equal(t, Event{Delta: 0, Data: []byte{0xf0, 0x7e, 0x01, 0xf7}}, track.Events[5])
+	assert.True(t, track.Events[6].IsEndOfTrack())
+}
+
+func Test_Write_format_0(t *testing.T) {
+	// given
+	f, _ := Read(bytes.NewReader(format0))
+	b := new(bytes.Buffer)
+	// when
+	err := f.Write(b)
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, format0, b.Bytes())
+}
+
+func Test_Write_and_Read_format_1(t *testing.T) {
+	// given
+	f := &File{
+		Format:   1,
+		Division: 96,
+		Tracks: []Track{
+			{Events: []Event{NewTempoEvent(0, 600000), NewTimeSignatureEvent(0, 4, 4)}},
+			{Events: []Event{
+				NewTrackNameEvent(0, "bass"),
+				{Delta: 0, Data: []byte{0x91, 0x24, 0x64}},
+				{Delta: 0x0fffffff, Data: []byte{0x81, 0x24, 0x00}},
+				{Delta: 0, Data: []byte{0xf7, 0xf8}},
+			}},
+		},
+	}
+	b := new(bytes.Buffer)
+	// when
+	err := f.Write(b)
+	actual, readErr := Read(b)
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, readErr)
+	assert.Equal(t, 2, len(actual.Tracks))
+	assert.Equal(t, append(f.Tracks[0].Events, NewEndOfTrackEvent(0)), actual.Tracks[0].Events)
+	assert.Equal(t, append(f.Tracks[1].Events, NewEndOfTrackEvent(0)), actual.Tracks[1].Events)
+}
+
+func Test_Read_skips_unknown_chunks(t *testing.T) {
+	// given
+	data := append([]byte{}, format0[:14]...)
+	data = append(data, 'X', 'Y', 'Z', 'W', 0x00, 0x00, 0x00, 0x02, 0x01, 0x02)
+	data = append(data, format0[14:]...)
+	// when
+	f, err := Read(bytes.NewReader(data))
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(f.Tracks))
+}
+
+func Test_Read_rejects_invalid_files(t *testing.T) {
+	invalid := [][]byte{
+		{},
+		[]byte("MThd"),
+		{'M', 'T', 'h', 'd', 0x00, 0x00, 0x00, 0x06, 0x00, 0x02, 0x00, 0x01, 0x01, 0xe0},
+		{'M', 'T', 'h', 'd', 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x01, 0xe7, 0x28},
+		{
+			'M', 'T', 'h', 'd', 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x01, 0x01, 0xe0,
+			'M', 'T', 'r', 'k', 0x00, 0x00, 0x00, 0x03, 0x00, 0x3c, 0x40,
+		},
+	}
+	for _, data := range invalid {
+		_, err := Read(bytes.NewReader(data))
+		assert.NotNil(t, err, "%X", data)
+	}
+}
+
+func Test_Read_rejects_chunk_length_exceeding_the_file(t *testing.T) {
+	// given a track chunk claiming 4 GiB
+	data := append([]byte{}, format0[:14]...)
+	data = append(data, 'M', 'T', 'r', 'k', 0xff, 0xff, 0xff, 0xff, 0x00, 0xff, 0x2f, 0x00)
+	// when
+	_, err := Read(bytes.NewReader(data))
+	// then
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "%v", err)
+}
+
+func Test_Write_rejects_delta_time_exceeding_4_bytes(t *testing.T) {
+	// given
+	f := &File{
+		Format:   0,
+		Division: 96,
+		Tracks:   []Track{{Events: []Event{{Delta: 0x10000000, Data: []byte{0x90, 0x3c, 0x40}}}}},
+	}
+	b := new(bytes.Buffer)
+	// when
+	err := f.Write(b)
+	// then
+	assert.Error(t, err)
+}
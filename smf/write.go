@@ -0,0 +1,98 @@
+package smf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+)
+
+// Write writes the file as Standard MIDI File.
+//
+// Channel messages are written with running status and an end of track event
+// is added to tracks which do not end with one.
+func (f *File) Write(w io.Writer) error {
+	if f.Format > 1 {
+		return fmt.Errorf("unsupported format %d", f.Format)
+	}
+	if f.Format == 0 && len(f.Tracks) != 1 {
+		return fmt.Errorf("format 0 requires exactly one track, got %d", len(f.Tracks))
+	}
+	if f.Division&smpteBit != 0 || f.Division == 0 {
+		return fmt.Errorf("unsupported division %X", f.Division)
+	}
+
+	header := make([]byte, 0, 6)
+	header = binary.BigEndian.AppendUint16(header, f.Format)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(f.Tracks)))
+	header = binary.BigEndian.AppendUint16(header, f.Division)
+	if err := writeChunk(w, headerChunk, header); err != nil {
+		return err
+	}
+	for i, t := range f.Tracks {
+		data, err := t.encode()
+		if err != nil {
+			return fmt.Errorf("track %d: %w", i, err)
+		}
+		if err := writeChunk(w, trackChunk, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeChunk(w io.Writer, id string, data []byte) error {
+	header := make([]byte, 0, 8)
+	header = append(header, id...)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (t Track) encode() ([]byte, error) {
+	var data []byte
+	var runningStatus byte
+	var err error
+	for _, e := range t.Events {
+		if len(e.Data) == 0 {
+			return nil, fmt.Errorf("empty event")
+		}
+		if data, err = appendVarLen(data, e.Delta); err != nil {
+			return nil, fmt.Errorf("delta time: %w", err)
+		}
+		status := e.Data[0]
+		switch {
+		case e.IsMeta():
+			data = append(data, e.Data[:2]...)
+			if data, err = appendVarLen(data, uint32(len(e.Data)-2)); err != nil {
+				return nil, fmt.Errorf("meta event length: %w", err)
+			}
+			data = append(data, e.Data[2:]...)
+			runningStatus = 0
+		case status == sysExStatus || status == escapeStatus:
+			data = append(data, status)
+			if data, err = appendVarLen(data, uint32(len(e.Data)-1)); err != nil {
+				return nil, fmt.Errorf("SysEx event length: %w", err)
+			}
+			data = append(data, e.Data[1:]...)
+			runningStatus = 0
+		case midi.IsStatus(status) && !midi.IsSystemCommon(status) && !midi.IsRealtime(status):
+			if status != runningStatus {
+				data = append(data, status)
+				runningStatus = status
+			}
+			data = append(data, e.Data[1:]...)
+		default:
+			return nil, fmt.Errorf("unsupported event %X", e.Data)
+		}
+		if e.IsEndOfTrack() {
+			return data, nil
+		}
+	}
+	// end of track event with a delta time of 0
+	return append(data, 0x00, metaStatus, MetaEndOfTrack, 0x00), nil
+}
@@ -22,6 +22,14 @@ func Of(t time.Time, start time.Time) Timestamp {
 	return Timestamp(t.Sub(start).Nanoseconds() / int64(rate))
 }
 
+// Time returns the time of the 32 bit timestamp which is closest to the reference time.
+// The timestamp wraps around every 4.97 days, the reference resolves the ambiguity.
+func Time(ts uint32, reference time.Time, start time.Time) time.Time {
+	base := Of(reference, start)
+	diff := int32(ts - base.Uint32())
+	return start.Add(time.Duration(int64(base)+int64(diff)) * rate)
+}
+
 // EncodeDeltaTime writes the encoded delta time onto the writer
 /*
    One-Octet Delta Time:
@@ -46,31 +54,58 @@ func Of(t time.Time, start time.Time) Timestamp {
 
 */
 func EncodeDeltaTime(reference time.Time, start time.Time, delta time.Duration, w io.Writer) {
+	w.Write(AppendDeltaTime(nil, reference, start, delta))
+}
+
+// AppendDeltaTime appends the encoded delta time to dst and returns the extended buffer.
+func AppendDeltaTime(dst []byte, reference time.Time, start time.Time, delta time.Duration) []byte {
 
 	ticks := Of(reference.Add(delta), start).Uint32() - Of(reference, start).Uint32()
 	if ticks >= 0x10000000 {
 		// FIXME pass through the error up to the client
-		// send the highest possible value
-		w.Write([]byte{0xff, 0xff, 0xff, 0x8f})
+		// send the highest possible value, the last octet has no continuation bit
+		return append(dst, 0xff, 0xff, 0xff, 0x7f)
 	} else if ticks >= 0x200000 {
 		low := byte(ticks & 0x7f)
 		byte2 := byte((ticks >> 7) | 0x80)
 		byte3 := byte((ticks >> 14) | 0x80)
 		high := byte((ticks >> 21) | 0x80)
-		w.Write([]byte{high, byte3, byte2, low})
+		return append(dst, high, byte3, byte2, low)
 	} else if ticks >= 0x4000 {
 		low := byte(ticks & 0x7f)
 		middle := byte((ticks >> 7) | 0x80)
 		high := byte((ticks >> 14) | 0x80)
-		w.Write([]byte{high, middle, low})
+		return append(dst, high, middle, low)
 	} else if ticks >= 0x80 {
 		low := byte(ticks & 0x7f)
 		high := byte((ticks >> 7) | 0x80)
-		w.Write([]byte{high, low})
-	} else {
-		w.Write([]byte{byte(ticks)})
+		return append(dst, high, low)
 	}
+	return append(dst, byte(ticks))
+}
+
+// DeltaTimeLength returns the maximum number of octets needed to encode the delta time.
+//
+// The exact encoding depends on the reference time, as the delta is converted into
+// timestamp ticks. The length of one additional tick is taken into account to
+// cover the rounding.
+func DeltaTimeLength(delta time.Duration) int {
+	ticks := delta.Nanoseconds()/int64(rate) + 1
+	switch {
+	case ticks >= 0x200000:
+		return 4
+	case ticks >= 0x4000:
+		return 3
+	case ticks >= 0x80:
+		return 2
+	default:
+		return 1
+	}
+}
 
+// Duration returns the duration of the Timestamp ticks
+func (ts Timestamp) Duration() time.Duration {
+	return time.Duration(ts) * rate
 }
 
 // Uint64 returns the long representation of the Timesteamp
@@ -137,3 +137,46 @@ func Test_Encode_largest_three_four_DeltaTime(t *testing.T) {
 	// then
 	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0x7f}, b.Bytes())
 }
+
+func Test_Encode_DeltaTime_exceeding_four_octets(t *testing.T) {
+	// given
+	b := new(bytes.Buffer)
+	start := time.Now()
+	reference := start.Add(tick)
+	delta := 0x10000000 * tick
+
+	// when
+	EncodeDeltaTime(reference, start, delta, b)
+	// then the largest four octet delta time is sent, its last octet has no continuation bit
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0x7f}, b.Bytes())
+}
+
+func Test_DeltaTimeLength(t *testing.T) {
+	assert.Equal(t, 1, DeltaTimeLength(0))
+	assert.Equal(t, 1, DeltaTimeLength(0x7e*tick))
+	assert.Equal(t, 2, DeltaTimeLength(0x7f*tick))
+	assert.Equal(t, 3, DeltaTimeLength(0x3fff*tick))
+	assert.Equal(t, 4, DeltaTimeLength(0x1fffff*tick))
+}
+
+func Test_Time(t *testing.T) {
+	// given
+	start := time.Now()
+	reference := start.Add(10 * time.Second)
+	// when
+	before := Time(Of(reference, start).Uint32()-10, reference, start)
+	after := Time(Of(reference, start).Uint32()+10, reference, start)
+	// then
+	assert.Equal(t, start.Add(10*time.Second-10*tick), before)
+	assert.Equal(t, start.Add(10*time.Second+10*tick), after)
+}
+
+func Test_Time_around_wrap(t *testing.T) {
+	// given
+	start := time.Now()
+	reference := start.Add(0x100000000 * tick)
+	// when
+	before := Time(0xffffffff, reference, start)
+	// then
+	assert.Equal(t, start.Add(0xffffffff*tick), before)
+}
@@ -0,0 +1,237 @@
+// Package ump models the Universal MIDI Packet (UMP) format of MIDI 2.0 and translates
+// between UMP and MIDI 1.0 messages.
+package ump
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MessageType is the type of a Universal MIDI Packet given by its first 4 bits.
+type MessageType uint8
+
+const (
+	// Utility messages such as NOOP and jitter reduction timestamps.
+	Utility MessageType = 0x0
+	// System messages are the MIDI 1.0 System Common and Real-Time messages.
+	System MessageType = 0x1
+	// MIDI1ChannelVoice messages are MIDI 1.0 Channel Voice messages.
+	MIDI1ChannelVoice MessageType = 0x2
+	// Data64 messages carry 7 bit System Exclusive data.
+	Data64 MessageType = 0x3
+	// MIDI2ChannelVoice messages are MIDI 2.0 Channel Voice messages.
+	MIDI2ChannelVoice MessageType = 0x4
+	// Data128 messages carry 8 bit System Exclusive data and mixed data sets.
+	Data128 MessageType = 0x5
+)
+
+// packetWords is the number of words of a packet by message type
+var packetWords = [16]int{1, 1, 1, 2, 2, 4, 1, 1, 2, 2, 2, 3, 3, 4, 4, 4}
+
+// Words returns the number of 32 bit words of a packet of the message type.
+func (t MessageType) Words() int {
+	return packetWords[t&0x0f]
+}
+
+func (t MessageType) String() string {
+	switch t {
+	case Utility:
+		return "Utility"
+	case System:
+		return "System"
+	case MIDI1ChannelVoice:
+		return "MIDI 1.0 Channel Voice"
+	case Data64:
+		return "Data 64"
+	case MIDI2ChannelVoice:
+		return "MIDI 2.0 Channel Voice"
+	case Data128:
+		return "Data 128"
+	default:
+		return fmt.Sprintf("Reserved %X", uint8(t))
+	}
+}
+
+// utility message status
+const (
+	noop        = 0x0
+	jrClock     = 0x1
+	jrTimestamp = 0x2
+)
+
+// SysEx status of Data64 and Data128 messages
+const (
+	sysExComplete = 0x0
+	sysExStart    = 0x1
+	sysExContinue = 0x2
+	sysExEnd      = 0x3
+)
+
+// sysEx7Size is the number of data bytes of a Data64 packet
+const sysEx7Size = 6
+
+// Packet is a Universal MIDI Packet of 1 to 4 words.
+type Packet []uint32
+
+// Type returns the message type of the packet, 0 for an empty packet.
+func (p Packet) Type() MessageType {
+	return MessageType(p.first() >> 28)
+}
+
+// Group returns the group (0-15) of the packet.
+func (p Packet) Group() uint8 {
+	return uint8(p.first() >> 24 & 0x0f)
+}
+
+// Status returns the status of the packet. For channel voice messages it is the status
+// nibble of the opcode, for system messages the MIDI 1.0 status byte.
+func (p Packet) Status() uint8 {
+	switch p.Type() {
+	case System:
+		return uint8(p.first() >> 16)
+	default:
+		return uint8(p.first() >> 20 & 0x0f)
+	}
+}
+
+// Channel returns the channel (0-15) of channel voice messages.
+func (p Packet) Channel() uint8 {
+	return uint8(p.first() >> 16 & 0x0f)
+}
+
+// first returns the first word of the packet, or 0 if the packet is empty.
+func (p Packet) first() uint32 {
+	if len(p) == 0 {
+		return 0
+	}
+	return p[0]
+}
+
+// Append appends the big endian words of the packet.
+func (p Packet) Append(dst []byte) []byte {
+	for _, w := range p {
+		dst = binary.BigEndian.AppendUint32(dst, w)
+	}
+	return dst
+}
+
+func (p Packet) String() string {
+	return fmt.Sprintf("UMP %s group=%d %08X", p.Type(), p.Group(), []uint32(p))
+}
+
+// Parse returns the packets of a buffer of big endian words.
+func Parse(b []byte) ([]Packet, error) {
+	packets := []Packet{}
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return packets, fmt.Errorf("incomplete word of %d bytes", len(b))
+		}
+		words := MessageType(b[0] >> 4).Words()
+		if len(b) < 4*words {
+			return packets, fmt.Errorf("incomplete packet of %d bytes, expected %d words", len(b), words)
+		}
+		p := make(Packet, words)
+		for i := range p {
+			p[i] = binary.BigEndian.Uint32(b[4*i:])
+		}
+		packets = append(packets, p)
+		b = b[4*words:]
+	}
+	return packets, nil
+}
+
+// NoOp returns a utility message without function.
+func NoOp() Packet {
+	return Packet{uint32(Utility)<<28 | noop<<20}
+}
+
+// JRTimestamp returns a jitter reduction timestamp in units of 1/31250 seconds.
+func JRTimestamp(group uint8, timestamp uint16) Packet {
+	return Packet{uint32(Utility)<<28 | uint32(group&0x0f)<<24 | jrTimestamp<<20 | uint32(timestamp)}
+}
+
+// short returns a packet with a message type containing 3 MIDI 1.0 bytes.
+func short(t MessageType, group uint8, status, data1, data2 byte) Packet {
+	return Packet{uint32(t)<<28 | uint32(group&0x0f)<<24 | uint32(status)<<16 | uint32(data1&0x7f)<<8 | uint32(data2&0x7f)}
+}
+
+// MIDI2 returns a MIDI 2.0 channel voice message.
+func MIDI2(group, status, channel, index1, index2 uint8, data uint32) Packet {
+	return Packet{
+		uint32(MIDI2ChannelVoice)<<28 | uint32(group&0x0f)<<24 | uint32(status&0x0f)<<20 |
+			uint32(channel&0x0f)<<16 | uint32(index1)<<8 | uint32(index2),
+		data,
+	}
+}
+
+// SysEx7 returns the Data64 packets of the System Exclusive data without the
+// enclosing 0xf0 and 0xf7 bytes.
+func SysEx7(group uint8, data []byte) []Packet {
+	packets := []Packet{}
+	for start := 0; start == 0 || start < len(data); start += sysEx7Size {
+		end := start + sysEx7Size
+		if end > len(data) {
+			end = len(data)
+		}
+		status := byte(sysExContinue)
+		switch {
+		case start == 0 && end == len(data):
+			status = sysExComplete
+		case start == 0:
+			status = sysExStart
+		case end == len(data):
+			status = sysExEnd
+		}
+		var bytes [8]byte
+		bytes[0] = byte(Data64)<<4 | group&0x0f
+		bytes[1] = status<<4 | byte(end-start)
+		copy(bytes[2:], data[start:end])
+		packets = append(packets, Packet{binary.BigEndian.Uint32(bytes[0:4]), binary.BigEndian.Uint32(bytes[4:8])})
+	}
+	return packets
+}
+
+// SysEx8 returns the Data128 packets of 8 bit System Exclusive data with the given stream id.
+func SysEx8(group, streamID uint8, data []byte) []Packet {
+	const size = 13
+	packets := []Packet{}
+	for start := 0; start == 0 || start < len(data); start += size {
+		end := start + size
+		if end > len(data) {
+			end = len(data)
+		}
+		status := byte(sysExContinue)
+		switch {
+		case start == 0 && end == len(data):
+			status = sysExComplete
+		case start == 0:
+			status = sysExStart
+		case end == len(data):
+			status = sysExEnd
+		}
+		var bytes [16]byte
+		bytes[0] = byte(Data128)<<4 | group&0x0f
+		// the number of bytes includes the stream id
+		bytes[1] = status<<4 | byte(end-start+1)
+		bytes[2] = streamID
+		copy(bytes[3:], data[start:end])
+		p := make(Packet, 4)
+		for i := range p {
+			p[i] = binary.BigEndian.Uint32(bytes[4*i:])
+		}
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+// sysExData returns the status and the data bytes of a Data64 packet.
+func (p Packet) sysExData() (uint8, []byte) {
+	var bytes [8]byte
+	binary.BigEndian.PutUint32(bytes[0:4], p[0])
+	binary.BigEndian.PutUint32(bytes[4:8], p[1])
+	n := int(bytes[1] & 0x0f)
+	if n > sysEx7Size {
+		n = sysEx7Size
+	}
+	return bytes[1] >> 4, bytes[2 : 2+n]
+}
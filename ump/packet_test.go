@@ -0,0 +1,70 @@
+package ump
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_packet_words(t *testing.T) {
+	assert.Equal(t, 1, Utility.Words())
+	assert.Equal(t, 1, MIDI1ChannelVoice.Words())
+	assert.Equal(t, 2, Data64.Words())
+	assert.Equal(t, 2, MIDI2ChannelVoice.Words())
+	assert.Equal(t, 4, Data128.Words())
+	assert.Equal(t, 3, MessageType(0xb).Words())
+}
+
+func Test_parse_and_append(t *testing.T) {
+	// given
+	packets := []Packet{
+		NoOp(),
+		JRTimestamp(1, 0x1234),
+		MIDI2(2, noteOn, 3, 60, 0, 0xffff0000),
+		SysEx8(0, 7, []byte{1, 2, 3})[0],
+	}
+	b := []byte{}
+	for _, p := range packets {
+		b = p.Append(b)
+	}
+	// when
+	parsed, err := Parse(b)
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, packets, parsed)
+	assert.Equal(t, []byte{0x42, 0x93, 60, 0, 0xff, 0xff, 0, 0}, packets[2].Append(nil))
+	assert.Equal(t, uint8(2), parsed[2].Group())
+	assert.Equal(t, uint8(3), parsed[2].Channel())
+	assert.Equal(t, uint8(noteOn), parsed[2].Status())
+}
+
+func Test_parse_incomplete_packet(t *testing.T) {
+	// when
+	packets, err := Parse([]byte{0x40, 0x90, 0x3c, 0x00, 0x80})
+	// then
+	assert.NotNil(t, err)
+	assert.Empty(t, packets)
+}
+
+func Test_sysex7_packets(t *testing.T) {
+	// when
+	packets := SysEx7(1, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	empty := SysEx7(0, nil)
+	// then
+	assert.Equal(t, []Packet{{0x31160102, 0x03040506}, {0x31320708, 0x00000000}}, packets)
+	assert.Equal(t, []Packet{{0x30000000, 0x00000000}}, empty)
+}
+
+func Test_empty_packet(t *testing.T) {
+	// given
+	p := Packet{}
+	// when
+	messages := NewTranslator().ToMIDI1(p)
+	// then
+	assert.Nil(t, messages)
+	assert.Equal(t, Utility, p.Type())
+	assert.Equal(t, uint8(0), p.Group())
+	assert.Equal(t, uint8(0), p.Status())
+	assert.Equal(t, uint8(0), p.Channel())
+	assert.NotPanics(t, func() { _ = p.String() })
+}
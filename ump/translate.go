@@ -0,0 +1,338 @@
+package ump
+
+import (
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+)
+
+// MIDI 2.0 channel voice status
+const (
+	registeredController = 0x2
+	assignableController = 0x3
+	relativeRegistered   = 0x4
+	relativeAssignable   = 0x5
+	noteOff              = 0x8
+	noteOn               = 0x9
+	polyPressure         = 0xa
+	controlChange        = 0xb
+	programChange        = 0xc
+	channelPressure      = 0xd
+	pitchBend            = 0xe
+)
+
+// controllers translated into the bank of MIDI 2.0 program changes
+const (
+	bankSelectMSB = 0
+	bankSelectLSB = 32
+)
+
+// bankValid is the option flag of a MIDI 2.0 program change with bank
+const bankValid = 0x01
+
+// Protocol is the protocol of the channel voice messages of translated packets.
+type Protocol uint8
+
+const (
+	// ProtocolMIDI1 uses MIDI 1.0 Channel Voice messages.
+	ProtocolMIDI1 Protocol = iota
+	// ProtocolMIDI2 uses MIDI 2.0 Channel Voice messages.
+	ProtocolMIDI2
+)
+
+// ScaleUp scales a value with srcBits to dstBits using the min-center-max algorithm of the
+// MIDI 2.0 specification, which maps the minimum, center and maximum values onto each other.
+func ScaleUp(value uint32, srcBits, dstBits uint) uint32 {
+	scaleBits := dstBits - srcBits
+	shifted := value << scaleBits
+	center := uint32(1) << (srcBits - 1)
+	if value <= center {
+		return shifted
+	}
+	repeatBits := srcBits - 1
+	repeat := value & (1<<repeatBits - 1)
+	if scaleBits > repeatBits {
+		repeat <<= scaleBits - repeatBits
+	} else {
+		repeat >>= repeatBits - scaleBits
+	}
+	for repeat != 0 {
+		shifted |= repeat
+		repeat >>= repeatBits
+	}
+	return shifted
+}
+
+// ScaleDown scales a value with srcBits to dstBits by dropping the least significant bits.
+func ScaleDown(value uint32, srcBits, dstBits uint) uint32 {
+	return value >> (srcBits - dstBits)
+}
+
+// Translator translates between MIDI 1.0 messages and Universal MIDI Packets following the
+// default translation of the MIDI 2.0 specification.
+//
+// The translation of MIDI 1.0 to MIDI 2.0 channel voice messages assembles RPN and NRPN
+// control changes into registered and assignable controllers, and bank selects into the
+// bank of program changes. System Exclusive data is reassembled from Data64 packets.
+type Translator struct {
+	groups [16]groupState
+}
+
+type groupState struct {
+	parameters *midi.ParameterAssembler
+	banks      [16]bank
+	sysEx      []byte
+	inSysEx    bool
+}
+
+type bank struct {
+	msb, lsb uint8
+	valid    bool
+}
+
+// NewTranslator creates a Translator.
+func NewTranslator() *Translator {
+	t := &Translator{}
+	for i := range t.groups {
+		t.groups[i].parameters = midi.NewParameterAssembler()
+	}
+	return t
+}
+
+// FromMIDI1 returns the packets of the MIDI 1.0 message with channel voice messages of the protocol.
+func (t *Translator) FromMIDI1(group uint8, m midi.Message, protocol Protocol) []Packet {
+	switch msg := m.(type) {
+	case midi.SysEx:
+		return SysEx7(group, msg.Data)
+	case midi.ChannelMessage:
+		if protocol == ProtocolMIDI2 {
+			return t.toMIDI2(group, msg)
+		}
+	}
+	b := midi.Encode(m)
+	switch {
+	case len(b) == 0:
+		return nil
+	case b[0] >= 0xf0:
+		return []Packet{short(System, group, b[0], at(b, 1), at(b, 2))}
+	}
+	// parameter changes and 14 bit control changes consist of multiple control changes
+	packets := []Packet{}
+	for _, part := range midi.Split(m) {
+		b := midi.Encode(part)
+		packets = append(packets, short(MIDI1ChannelVoice, group, b[0], at(b, 1), at(b, 2)))
+	}
+	return packets
+}
+
+func at(b []byte, i int) byte {
+	if i < len(b) {
+		return b[i]
+	}
+	return 0
+}
+
+func (t *Translator) toMIDI2(group uint8, m midi.ChannelMessage) []Packet {
+	g := &t.groups[group&0x0f]
+	ch := m.GetChannel()
+	switch msg := m.(type) {
+	case midi.NoteOff:
+		return []Packet{MIDI2(group, noteOff, ch, msg.Key, 0, ScaleUp(uint32(msg.Velocity), 7, 16)<<16)}
+	case midi.NoteOn:
+		if msg.IsNoteOff() {
+			// the release velocity is unknown, 64 is the default of MIDI 1.0
+			return []Packet{MIDI2(group, noteOff, ch, msg.Key, 0, ScaleUp(64, 7, 16)<<16)}
+		}
+		return []Packet{MIDI2(group, noteOn, ch, msg.Key, 0, ScaleUp(uint32(msg.Velocity), 7, 16)<<16)}
+	case midi.PolyPressure:
+		return []Packet{MIDI2(group, polyPressure, ch, msg.Key, 0, ScaleUp(uint32(msg.Pressure), 7, 32))}
+	case midi.ControlChange:
+		switch msg.Controller {
+		case bankSelectMSB:
+			g.banks[ch].msb, g.banks[ch].valid = msg.Value, true
+			return nil
+		case bankSelectLSB:
+			g.banks[ch].lsb, g.banks[ch].valid = msg.Value, true
+			return nil
+		}
+		assembled, ok := g.parameters.Assemble(msg)
+		if !ok {
+			return nil
+		}
+		if p, isParameter := assembled.(midi.ParameterChange); isParameter {
+			return []Packet{parameterPacket(group, p)}
+		}
+		return []Packet{MIDI2(group, controlChange, ch, msg.Controller, 0, ScaleUp(uint32(msg.Value), 7, 32))}
+	case midi.ParameterChange:
+		return []Packet{parameterPacket(group, msg)}
+	case midi.ControlChange14:
+		return []Packet{MIDI2(group, controlChange, ch, msg.Controller, 0, ScaleUp(uint32(msg.Value), 14, 32))}
+	case midi.ProgramChange:
+		b := g.banks[ch]
+		if !b.valid {
+			return []Packet{MIDI2(group, programChange, ch, 0, 0, uint32(msg.Program)<<24)}
+		}
+		return []Packet{MIDI2(group, programChange, ch, 0, bankValid, uint32(msg.Program)<<24|uint32(b.msb)<<8|uint32(b.lsb))}
+	case midi.ChannelPressure:
+		return []Packet{MIDI2(group, channelPressure, ch, 0, 0, ScaleUp(uint32(msg.Pressure), 7, 32))}
+	case midi.PitchBend:
+		return []Packet{MIDI2(group, pitchBend, ch, 0, 0, ScaleUp(uint32(int32(msg.Value)+8192), 14, 32))}
+	}
+	return nil
+}
+
+// parameterPacket returns the registered or assignable controller of the parameter change.
+func parameterPacket(group uint8, p midi.ParameterChange) Packet {
+	status := uint8(registeredController)
+	if p.Kind == midi.NRPN {
+		status = assignableController
+	}
+	bank, index := uint8(p.Parameter>>7&0x7f), uint8(p.Parameter&0x7f)
+	switch p.Op {
+	case midi.Increment:
+		return MIDI2(group, status+2, p.Channel, bank, index, uint32(p.Value))
+	case midi.Decrement:
+		return MIDI2(group, status+2, p.Channel, bank, index, uint32(-int32(p.Value)))
+	default:
+		return MIDI2(group, status, p.Channel, bank, index, ScaleUp(uint32(p.Value), 14, 32))
+	}
+}
+
+// ToMIDI1 returns the MIDI 1.0 messages of the packet.
+// Messages without MIDI 1.0 equivalent, e.g. per note controllers, are dropped.
+func (t *Translator) ToMIDI1(p Packet) []midi.Message {
+	if len(p) == 0 || len(p) < p.Type().Words() {
+		return nil
+	}
+	switch p.Type() {
+	case System, MIDI1ChannelVoice:
+		b := []byte{byte(p[0] >> 16), byte(p[0] >> 8), byte(p[0])}
+		if midi.GetCommandInfo(b[0]) == nil {
+			return nil
+		}
+		m, err := midi.Parse(b[:1+midi.GetDataLength(b[0])])
+		if err != nil {
+			return nil
+		}
+		return []midi.Message{m}
+	case Data64:
+		return t.sysEx(p)
+	case MIDI2ChannelVoice:
+		return fromMIDI2(p)
+	}
+	return nil
+}
+
+func (t *Translator) sysEx(p Packet) []midi.Message {
+	g := &t.groups[p.Group()]
+	status, data := p.sysExData()
+	switch status {
+	case sysExComplete:
+		g.inSysEx = false
+		return []midi.Message{midi.SysEx{Data: append([]byte(nil), data...)}}
+	case sysExStart:
+		g.sysEx, g.inSysEx = append(g.sysEx[:0], data...), true
+	case sysExContinue:
+		if g.inSysEx {
+			g.sysEx = append(g.sysEx, data...)
+		}
+	case sysExEnd:
+		if g.inSysEx {
+			g.inSysEx = false
+			return []midi.Message{midi.SysEx{Data: append(append([]byte(nil), g.sysEx...), data...)}}
+		}
+	}
+	return nil
+}
+
+func fromMIDI2(p Packet) []midi.Message {
+	ch := p.Channel()
+	index1, index2 := uint8(p[0]>>8&0x7f), uint8(p[0]&0x7f)
+	data := p[1]
+	switch p.Status() {
+	case noteOff:
+		return []midi.Message{midi.NoteOff{Channel: ch, Key: index1, Velocity: uint8(ScaleDown(data>>16, 16, 7))}}
+	case noteOn:
+		velocity := uint8(ScaleDown(data>>16, 16, 7))
+		if velocity == 0 {
+			// a MIDI 1.0 note on with velocity 0 would stop the note
+			velocity = 1
+		}
+		return []midi.Message{midi.NoteOn{Channel: ch, Key: index1, Velocity: velocity}}
+	case polyPressure:
+		return []midi.Message{midi.PolyPressure{Channel: ch, Key: index1, Pressure: uint8(ScaleDown(data, 32, 7))}}
+	case controlChange:
+		return []midi.Message{midi.ControlChange{Channel: ch, Controller: index1, Value: uint8(ScaleDown(data, 32, 7))}}
+	case registeredController, assignableController:
+		return []midi.Message{midi.ParameterChange{
+			Channel:   ch,
+			Kind:      parameterKind(p.Status()),
+			Parameter: uint16(index1)<<7 | uint16(index2),
+			Value:     uint16(ScaleDown(data, 32, 14)),
+		}}
+	case relativeRegistered, relativeAssignable:
+		op, step := midi.Increment, int32(data)
+		if step < 0 {
+			op, step = midi.Decrement, -step
+		}
+		if step > 0x7f {
+			step = 0x7f
+		}
+		return []midi.Message{midi.ParameterChange{
+			Channel:   ch,
+			Kind:      parameterKind(p.Status() - 2),
+			Parameter: uint16(index1)<<7 | uint16(index2),
+			Op:        op,
+			Value:     uint16(step),
+		}}
+	case programChange:
+		pc := midi.ProgramChange{Channel: ch, Program: uint8(data >> 24 & 0x7f)}
+		if p[0]&bankValid == 0 {
+			return []midi.Message{pc}
+		}
+		return []midi.Message{
+			midi.ControlChange{Channel: ch, Controller: bankSelectMSB, Value: uint8(data >> 8 & 0x7f)},
+			midi.ControlChange{Channel: ch, Controller: bankSelectLSB, Value: uint8(data & 0x7f)},
+			pc,
+		}
+	case channelPressure:
+		return []midi.Message{midi.ChannelPressure{Channel: ch, Pressure: uint8(ScaleDown(data, 32, 7))}}
+	case pitchBend:
+		return []midi.Message{midi.PitchBend{Channel: ch, Value: int16(ScaleDown(data, 32, 14)) - 8192}}
+	}
+	return nil
+}
+
+func parameterKind(status uint8) midi.ParameterKind {
+	if status == assignableController {
+		return midi.NRPN
+	}
+	return midi.RPN
+}
+
+// FromCommands returns the packets of the MIDI 1.0 commands with channel voice messages of
+// the protocol. Commands which are no valid MIDI messages are dropped.
+func (t *Translator) FromCommands(group uint8, mcs rtp.MIDICommands, protocol Protocol) []Packet {
+	packets := []Packet{}
+	for _, mc := range mcs.Commands {
+		m, err := mc.Payload.Message()
+		if err != nil {
+			continue
+		}
+		packets = append(packets, t.FromMIDI1(group, m, protocol)...)
+	}
+	return packets
+}
+
+// ToCommands returns the MIDI 1.0 commands of the packets at the given time.
+//
+// Parameter changes and 14 bit control changes are sent as several control changes, each
+// control change is a command of its own.
+func (t *Translator) ToCommands(packets []Packet, timestamp time.Time) rtp.MIDICommands {
+	mcs := rtp.MIDICommands{Timestamp: timestamp}
+	for _, p := range packets {
+		mcs.Commands = append(mcs.Commands, rtp.Commands(t.ToMIDI1(p)...)...)
+	}
+	return mcs
+}
@@ -0,0 +1,143 @@
+package ump
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laenzlinger/go-midi-rtp/midi"
+	"github.com/laenzlinger/go-midi-rtp/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scale_up_and_down(t *testing.T) {
+	assert.Equal(t, uint32(0), ScaleUp(0, 7, 16))
+	assert.Equal(t, uint32(0x8000), ScaleUp(64, 7, 16))
+	assert.Equal(t, uint32(0xffff), ScaleUp(127, 7, 16))
+	assert.Equal(t, uint32(0xffffffff), ScaleUp(127, 7, 32))
+	assert.Equal(t, uint32(0xffffffff), ScaleUp(0x3fff, 14, 32))
+	assert.Equal(t, uint32(0x80000000), ScaleUp(0x2000, 14, 32))
+	for v := uint32(0); v < 128; v++ {
+		assert.Equal(t, v, ScaleDown(ScaleUp(v, 7, 32), 32, 7))
+	}
+}
+
+func Test_midi1_to_midi2_channel_voice(t *testing.T) {
+	// given
+	tr := NewTranslator()
+	messages := []midi.Message{
+		midi.NoteOn{Channel: 1, Key: 60, Velocity: 127},
+		midi.NoteOn{Channel: 1, Key: 60},
+		midi.ControlChange{Channel: 2, Controller: 7, Value: 64},
+		midi.PitchBend{Channel: 3, Value: 0},
+		midi.ControlChange{Channel: 4, Controller: 0, Value: 1},
+		midi.ControlChange{Channel: 4, Controller: 32, Value: 2},
+		midi.ProgramChange{Channel: 4, Program: 5},
+	}
+	// when
+	packets := []Packet{}
+	for _, m := range messages {
+		packets = append(packets, tr.FromMIDI1(0, m, ProtocolMIDI2)...)
+	}
+	// then
+	assert.Equal(t, []Packet{
+		{0x40913c00, 0xffff0000},
+		{0x40813c00, 0x80000000},
+		{0x40b20700, 0x80000000},
+		{0x40e30000, 0x80000000},
+		{0x40c40001, 0x05000102},
+	}, packets)
+}
+
+func Test_rpn_to_registered_controller_and_back(t *testing.T) {
+	// given
+	tr := NewTranslator()
+	rpn := midi.ParameterChange{Channel: 0, Kind: midi.RPN, Parameter: 0, Value: 2 << 7}
+	// when
+	packets := []Packet{}
+	b := rpn.Append(nil)
+	for i := 0; i < len(b); i += 3 {
+		m, _ := midi.Parse(b[i : i+3])
+		packets = append(packets, tr.FromMIDI1(0, m, ProtocolMIDI2)...)
+	}
+	// then
+	assert.Equal(t, 2, len(packets))
+	last := packets[len(packets)-1]
+	assert.Equal(t, Packet{0x40200000, ScaleUp(2<<7, 14, 32)}, last)
+	assert.Equal(t, []midi.Message{rpn}, tr.ToMIDI1(last))
+}
+
+func Test_midi2_to_midi1(t *testing.T) {
+	// given
+	tr := NewTranslator()
+	// when
+	quiet := tr.ToMIDI1(MIDI2(0, noteOn, 0, 60, 0, 0x00ff0000))
+	program := tr.ToMIDI1(MIDI2(0, programChange, 1, 0, bankValid, 0x07000203))
+	bend := tr.ToMIDI1(MIDI2(0, pitchBend, 2, 0, 0, 0xffffffff))
+	decrement := tr.ToMIDI1(MIDI2(0, relativeAssignable, 3, 1, 2, uint32(0xfffffffe)))
+	// then
+	assert.Equal(t, []midi.Message{midi.NoteOn{Key: 60, Velocity: 1}}, quiet)
+	assert.Equal(t, []midi.Message{
+		midi.ControlChange{Channel: 1, Controller: 0, Value: 2},
+		midi.ControlChange{Channel: 1, Controller: 32, Value: 3},
+		midi.ProgramChange{Channel: 1, Program: 7},
+	}, program)
+	assert.Equal(t, []midi.Message{midi.PitchBend{Channel: 2, Value: 8191}}, bend)
+	assert.Equal(t, []midi.Message{midi.ParameterChange{Channel: 3, Kind: midi.NRPN, Parameter: 1<<7 | 2, Op: midi.Decrement, Value: 2}}, decrement)
+}
+
+func Test_commands_round_trip_with_midi1_protocol(t *testing.T) {
+	// given
+	tr := NewTranslator()
+	now := time.Now()
+	mcs := rtp.MIDICommands{Timestamp: now, Commands: []rtp.MIDICommand{
+		{Payload: []byte{0x90, 0x3c, 0x40}},
+		{Payload: []byte{0xc0, 0x05}},
+		{Payload: []byte{0xf0, 1, 2, 3, 4, 5, 6, 7, 0xf7}},
+		{Payload: []byte{0xf8}},
+	}}
+	// when
+	packets := tr.FromCommands(0, mcs, ProtocolMIDI1)
+	actual := tr.ToCommands(packets, now)
+	// then
+	assert.Equal(t, 5, len(packets))
+	assert.Equal(t, Packet{0x20c00500}, packets[1])
+	assert.Equal(t, mcs, actual)
+}
+
+func Test_parameter_and_14_bit_controller_commands_round_trip_through_rtp(t *testing.T) {
+	// given
+	tr := NewTranslator()
+	now := time.Now()
+	rpn := midi.ParameterChange{Channel: 1, Kind: midi.RPN, Parameter: 0, Value: 2<<7 | 5}
+	nrpn := midi.ParameterChange{Channel: 2, Kind: midi.NRPN, Parameter: 1<<7 | 2, Value: 0x1234}
+	cc14 := midi.ControlChange14{Channel: 3, Controller: 7, Value: 0x2345}
+	packets := []Packet{}
+	for _, m := range []midi.Message{rpn, nrpn, cc14} {
+		b := midi.Encode(m)
+		for i := 0; i < len(b); i += 3 {
+			cc, _ := midi.Parse(b[i : i+3])
+			packets = append(packets, tr.FromMIDI1(0, cc, ProtocolMIDI2)...)
+		}
+	}
+	// when
+	mcs := tr.ToCommands(packets, now)
+	b, err := rtp.Encode(rtp.MIDIMessage{Commands: mcs}, now)
+	assert.Nil(t, err)
+	decoded, err := rtp.Decode(b)
+	// then
+	assert.Nil(t, err)
+	assembler := midi.NewParameterAssembler(7)
+	messages := []midi.Message{}
+	for _, mc := range decoded.Commands.Commands {
+		assert.Equal(t, 3, len(mc.Payload))
+		m, err := mc.Payload.Message()
+		assert.Nil(t, err)
+		if m, ok := assembler.Assemble(m.(midi.ControlChange)); ok {
+			messages = append(messages, m)
+		}
+	}
+	assert.Equal(t, mcs.Commands, decoded.Commands.Commands)
+	for _, m := range []midi.Message{rpn, nrpn, cc14} {
+		assert.Contains(t, messages, m)
+	}
+}